@@ -5,18 +5,30 @@ const (
 	RunCompleteCondition    = "Complete"
 	WorkspaceReadyCondition = "Ready"
 
-	PodCreatedReason        = "PodCreated"
-	PodPendingReason        = "PodPending"
-	PodUnknownReason        = "PodUnknown"
-	PodSucceededReason      = "PodSucceeded"
-	PodFailedReason         = "PodFailed"
-	PodRunningReason        = "PodRunning"
-	RunQueuedReason         = "Queued"
-	RunUnqueuedReason       = "Unqueued"
-	RunEnqueueTimeoutReason = "EnqueueTimeout"
-	QueueTimeoutReason      = "QueueTimeout"
-	RunPendingTimeoutReason = "PodPendingTimeout"
-	WorkspaceNotFoundReason = "WorkspaceNotFound"
+	PodCreatedReason          = "PodCreated"
+	PodPendingReason          = "PodPending"
+	PodUnknownReason          = "PodUnknown"
+	PodSucceededReason        = "PodSucceeded"
+	PodFailedReason           = "PodFailed"
+	PodRunningReason          = "PodRunning"
+	RunQueuedReason           = "Queued"
+	RunUnqueuedReason         = "Unqueued"
+	RunEnqueueTimeoutReason   = "EnqueueTimeout"
+	QueueTimeoutReason        = "QueueTimeout"
+	RunPendingTimeoutReason   = "PodPendingTimeout"
+	WorkspaceNotFoundReason   = "WorkspaceNotFound"
+	CLIConfigErrorReason      = "CLIConfigError"
+	PolicyErrorReason         = "PolicyError"
+	DirtyWorkingTreeReason    = "DirtyWorkingTree"
+	VariableSourceErrorReason = "VariableSourceError"
+	CredentialsErrorReason    = "CredentialsError"
+
+	// Policy conditions record the result of evaluating a run's plan against
+	// a policy. The condition type is the prefix followed by the policy name.
+	PolicyConditionTypePrefix = "policy.etok.dev/"
+	PolicyPassedReason        = "PolicyPassed"
+	PolicyWarnedReason        = "PolicyWarned"
+	PolicyFailedReason        = "PolicyFailed"
 
 	// Pending means whatever is being observed is reported to be progressing
 	// towards a non-failure state.
@@ -36,3 +48,9 @@ const (
 	// Ready means the resource and all its components are fully functional
 	ReadyReason = "AllSystemsOperational"
 )
+
+// PolicyConditionType returns the type of condition recording the result of
+// evaluating a run's plan against the named policy.
+func PolicyConditionType(policy string) string {
+	return PolicyConditionTypePrefix + policy
+}
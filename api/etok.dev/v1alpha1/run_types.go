@@ -24,6 +24,15 @@ func init() {
 // +kubebuilder:printcolumn:name="Command",type="string",JSONPath=".spec.command"
 // +kubebuilder:printcolumn:name="Workspace",type="string",JSONPath=".spec.workspace"
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Add",type="integer",JSONPath=".status.plan.add"
+// +kubebuilder:printcolumn:name="Change",type="integer",JSONPath=".status.plan.change"
+// +kubebuilder:printcolumn:name="Destroy",type="integer",JSONPath=".status.plan.destroy"
+// +kubebuilder:printcolumn:name="Import",type="integer",JSONPath=".status.plan.import",priority=1
+// +kubebuilder:printcolumn:name="Branch",type="string",JSONPath=".spec.provenance.branch"
+// +kubebuilder:printcolumn:name="Commit",type="string",JSONPath=".spec.provenance.commit",priority=1
+// +kubebuilder:printcolumn:name="Dirty",type="boolean",JSONPath=".spec.provenance.dirty",priority=1
+// +kubebuilder:printcolumn:name="Message",type="string",JSONPath=".spec.provenance.message",priority=1
+// +kubebuilder:printcolumn:name="Terraform",type="string",JSONPath=".status.terraformVersion",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 type Run struct {
@@ -72,6 +81,33 @@ type RunSpec struct {
 
 	// AttachSpec defines behaviour for clients attaching to the pod's TTY
 	AttachSpec `json:",inline"`
+
+	// Provenance of the run, recorded by the client that created it
+	Provenance *Provenance `json:"provenance,omitempty"`
+}
+
+// Provenance records the origin of a run's configuration
+type Provenance struct {
+	// SHA of the git commit checked out on the client
+	Commit string `json:"commit,omitempty"`
+
+	// Git branch checked out on the client
+	Branch string `json:"branch,omitempty"`
+
+	// Whether the git working tree had uncommitted changes
+	Dirty bool `json:"dirty,omitempty"`
+
+	// Author of the git commit
+	Author string `json:"author,omitempty"`
+
+	// Message provided by the user describing the run
+	Message string `json:"message,omitempty"`
+
+	// SHA256 digest of the archive containing the configuration
+	ArchiveDigest string `json:"archiveDigest,omitempty"`
+
+	// Version of the etok client
+	EtokVersion string `json:"etokVersion,omitempty"`
 }
 
 // AttachSpec defines behaviour for clients attaching to the pod's TTY
@@ -113,6 +149,25 @@ func RunLockFileConfigMapName(name string) string {
 	return name + "-lockfile"
 }
 
+// CLIConfigSecretName is the name of the secret containing the run's rendered
+// terraform CLI configuration.
+func (r *Run) CLIConfigSecretName() string {
+	return r.Name + "-cliconfig"
+}
+
+// PoliciesConfigMapName is the name of the config map containing the policies
+// against which the run's plan is evaluated.
+func (r *Run) PoliciesConfigMapName() string {
+	return r.Name + "-policies"
+}
+
+// PolicyModuleKey is the key in the run's policies config map for a rego module
+// belonging to a policy. Policy names cannot contain underscores, so the key
+// is split on the first underscore to retrieve the policy name and module.
+func PolicyModuleKey(policy, module string) string {
+	return policy + "_" + module
+}
+
 // RunStatus defines the observed state of Run
 type RunStatus struct {
 	// Current phase of the run's lifecycle.
@@ -122,6 +177,102 @@ type RunStatus struct {
 
 	// Exit code of run pod's runner container
 	ExitCode *int `json:"exitCode,omitempty"`
+
+	// True once the runner has received the handshake from a client attached
+	// to its TTY. Only applicable to runs that await a handshake.
+	HandshakeReceived bool `json:"handshakeReceived,omitempty"`
+
+	// Results of hooks executed by the runner
+	Hooks []HookResult `json:"hooks,omitempty"`
+
+	// Summary of the changes in the run's plan. Only set for plans, and for
+	// applies of saved plans.
+	Plan *PlanSummary `json:"plan,omitempty"`
+
+	// Version of terraform that executed the run's command
+	TerraformVersion string `json:"terraformVersion,omitempty"`
+
+	// Providers recorded in the dependency lock file, along with their
+	// hashes
+	Providers []ProviderLock `json:"providers,omitempty"`
+
+	// Variables whose values were resolved by the operator when the run's pod
+	// was created, along with their sources
+	Variables []ResolvedVariable `json:"variables,omitempty"`
+}
+
+// ResolvedVariable records the source from which the operator resolved the
+// value of a variable. The value itself is not recorded.
+type ResolvedVariable struct {
+	// Variable name
+	Key string `json:"key"`
+
+	// EnvironmentVariable denotes if the variable is an environment variable
+	EnvironmentVariable bool `json:"environmentVariable,omitempty"`
+
+	// Source of the value
+	Source VariableSource `json:"source"`
+
+	// Resource version of the object from which the value was read
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+// ProviderLock is a provider selected in the dependency lock file
+type ProviderLock struct {
+	// Source address of the provider, e.g. registry.terraform.io/hashicorp/aws
+	Address string `json:"address"`
+
+	// Selected version of the provider
+	Version string `json:"version"`
+
+	// Checksums of the provider's packages
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// PlanSummary summarises the changes in a plan
+type PlanSummary struct {
+	// Number of resources to be created
+	Add int `json:"add"`
+
+	// Number of resources to be updated in-place
+	Change int `json:"change"`
+
+	// Number of resources to be destroyed
+	Destroy int `json:"destroy"`
+
+	// Number of resources to be imported
+	Import int `json:"import"`
+
+	// Resources with changes
+	Resources []ResourceChange `json:"resources,omitempty"`
+}
+
+// ResourceChange is a change to a resource in a plan
+type ResourceChange struct {
+	// Address of the resource
+	Address string `json:"address"`
+
+	// +kubebuilder:validation:Enum={"create","update","delete","replace","import"}
+
+	// Action to be performed on the resource
+	Action string `json:"action"`
+}
+
+// HasChanges determines whether the plan has any changes
+func (s *PlanSummary) HasChanges() bool {
+	return len(s.Resources) > 0
+}
+
+// HookResult is the outcome of executing a hook
+type HookResult struct {
+	// Name of the hook
+	Name string `json:"name"`
+
+	// Phase in which the hook was executed
+	Phase HookPhase `json:"phase"`
+
+	// Exit code of the hook's script
+	ExitCode int `json:"exitCode"`
 }
 
 func (r *Run) IsReconciled() bool {
@@ -0,0 +1,71 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func init() {
+	SchemeBuilder.Register(&VariableSet{}, &VariableSetList{})
+}
+
+// VariableSet holds variables shared by workspaces in its namespace. A
+// workspace's own variables take precedence over those of a variable set with
+// the same key and kind. Where variable sets conflict, the set whose name comes
+// later in alphabetical order takes precedence.
+// +genclient
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=variablesets,scope=Namespaced,shortName={vs}
+// +kubebuilder:printcolumn:name="Workspaces",type="string",JSONPath=".spec.workspaces"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type VariableSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec VariableSetSpec `json:"spec,omitempty"`
+}
+
+// VariableSetSpec defines the variables of a variable set and the workspaces to
+// which they apply
+type VariableSetSpec struct {
+	// Variables to apply to the selected workspaces
+	Variables []*Variable `json:"variables,omitempty"`
+
+	// Select workspaces by label. An empty selector selects all workspaces in
+	// the namespace.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Names of workspaces to which the variables apply, in addition to those
+	// selected by label.
+	Workspaces []string `json:"workspaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// VariableSetList contains a list of VariableSet
+type VariableSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VariableSet `json:"items"`
+}
+
+// Selects determines whether the variable set applies to the workspace
+func (vs *VariableSet) Selects(ws *Workspace) (bool, error) {
+	if vs.Namespace != ws.Namespace {
+		return false, nil
+	}
+	for _, name := range vs.Spec.Workspaces {
+		if name == ws.Name {
+			return true, nil
+		}
+	}
+	if vs.Spec.Selector == nil {
+		return false, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(vs.Spec.Selector)
+	if err != nil {
+		return false, err
+	}
+	return selector.Matches(labels.Set(ws.Labels)), nil
+}
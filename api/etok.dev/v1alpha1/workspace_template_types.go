@@ -0,0 +1,76 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// WorkspaceTemplateLabelKey is the key of the label which, set on a
+	// namespace, names the template from which workspaces are created in that
+	// namespace unless another template is specified
+	WorkspaceTemplateLabelKey = "etok.dev/workspace-template"
+
+	// WorkspaceTemplateAnnotationKey is the key of the annotation recording
+	// the template from which a workspace was created, in the form
+	// <kind>/<name>
+	WorkspaceTemplateAnnotationKey = "etok.dev/template"
+)
+
+func init() {
+	SchemeBuilder.Register(&WorkspaceTemplate{}, &WorkspaceTemplateList{})
+	SchemeBuilder.Register(&ClusterWorkspaceTemplate{}, &ClusterWorkspaceTemplateList{})
+}
+
+// WorkspaceTemplate holds defaults for workspaces created in its namespace.
+// The template is applied only when a workspace is created: later changes to
+// the template are not propagated to existing workspaces.
+// +genclient
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=workspacetemplates,scope=Namespaced,shortName={wst}
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.terraformVersion"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type WorkspaceTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Defaults for the spec of workspaces created from the template
+	Spec WorkspaceSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WorkspaceTemplateList contains a list of WorkspaceTemplate
+type WorkspaceTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WorkspaceTemplate `json:"items"`
+}
+
+// ClusterWorkspaceTemplate holds defaults for workspaces created in any
+// namespace. A namespaced WorkspaceTemplate takes precedence over a
+// ClusterWorkspaceTemplate of the same name. As with a WorkspaceTemplate,
+// later changes are not propagated to existing workspaces.
+// +genclient
+// +genclient:nonNamespaced
+// +genclient:noStatus
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=clusterworkspacetemplates,scope=Cluster,shortName={cwst}
+// +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".spec.terraformVersion"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+type ClusterWorkspaceTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	// Defaults for the spec of workspaces created from the template
+	Spec WorkspaceSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// ClusterWorkspaceTemplateList contains a list of ClusterWorkspaceTemplate
+type ClusterWorkspaceTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterWorkspaceTemplate `json:"items"`
+}
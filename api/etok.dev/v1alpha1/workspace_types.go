@@ -69,10 +69,258 @@ type WorkspaceSpec struct {
 	// Variables as inputs to module
 	Variables []*Variable `json:"variables,omitempty"`
 
+	// Namespaces whose workspaces may source the values of variables from
+	// this workspace's outputs. Workspaces in the same namespace may always
+	// do so.
+	ShareOutputsWith []string `json:"shareOutputsWith,omitempty"`
+
 	// +kubebuilder:validation:Pattern=`^[0-9a-z][0-9a-z\-_]{0,61}[0-9a-z]$`
 
 	// GCS bucket to which to backup state file
 	BackupBucket string `json:"backupBucket,omitempty"`
+
+	// Terraform CLI configuration to make available to runs
+	CLIConfig *CLIConfig `json:"cliConfig,omitempty"`
+
+	// Sources of credentials to make available to runs. If empty, the keys
+	// of a secret named 'etok', if it exists, are set as environment
+	// variables.
+	Credentials []CredentialsSource `json:"credentials,omitempty"`
+
+	// Hooks to execute before and after a run's command, on the run's pod.
+	Hooks []Hook `json:"hooks,omitempty"`
+
+	// Policies against which the plans of plan and apply runs are evaluated.
+	// An apply is blocked if its plan violates a policy.
+	Policies []PolicyReference `json:"policies,omitempty"`
+
+	// Refuse apply and destroy runs created from a git working tree with
+	// uncommitted changes, or without the provenance of a git commit.
+	RefuseDirtyApplies bool `json:"refuseDirtyApplies,omitempty"`
+
+	// +kubebuilder:default="Delete"
+
+	// What happens to the workspace's state, and the infrastructure it
+	// records, when the workspace is deleted.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DeletionPolicy determines what happens to a workspace's state, and the
+// infrastructure it records, when the workspace is deleted.
+// +kubebuilder:validation:Enum={"Delete","Protect","Retain","Destroy"}
+type DeletionPolicy string
+
+const (
+	// State is deleted along with the workspace, regardless of the resources
+	// it records
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	// Deletion is refused while the state records any managed resources,
+	// unless the workspace is annotated with the force delete annotation
+	DeletionPolicyProtect DeletionPolicy = "Protect"
+	// State, along with its backups, is retained once the workspace is
+	// deleted
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// Resources recorded in the state are destroyed by a run before the
+	// workspace is deleted. Deletion is blocked until the run succeeds, unless
+	// the workspace is annotated with the force delete annotation.
+	DeletionPolicyDestroy DeletionPolicy = "Destroy"
+)
+
+const (
+	// Finalizer with which the operator enforces a workspace's deletion
+	// policy
+	DeletionPolicyFinalizer = "etok.dev/deletion-policy"
+
+	// ForceDeleteAnnotationKey is the key of the annotation which, set to
+	// "true", permits a workspace to be deleted without first destroying the
+	// resources recorded in its state, regardless of its deletion policy
+	ForceDeleteAnnotationKey = "etok.dev/force-delete"
+
+	// QueueBlockedAnnotationKey is the key of the annotation which, set to
+	// "true", prevents a workspace's queued runs from becoming active. A run
+	// that is already active is unaffected.
+	QueueBlockedAnnotationKey = "etok.dev/queue-blocked"
+)
+
+// PolicyScope determines where the config map containing a policy is found.
+// +kubebuilder:validation:Enum={"Namespace","Cluster"}
+type PolicyScope string
+
+const (
+	// Config map is in the workspace's namespace
+	PolicyScopeNamespace PolicyScope = "Namespace"
+	// Config map is in the operator's namespace, permitting the policy to be
+	// shared by workspaces across the cluster
+	PolicyScopeCluster PolicyScope = "Cluster"
+)
+
+// PolicyReference references a config map containing a policy. Each key with a
+// .rego suffix is loaded as a rego module. The policy's rules are defined in
+// package main: a plan is denied by any 'deny' rule, and warnings are emitted
+// for any 'warn' rule.
+type PolicyReference struct {
+	// Name of the config map
+	Name string `json:"name"`
+
+	// +kubebuilder:default="Namespace"
+
+	// Scope of the config map
+	Scope PolicyScope `json:"scope,omitempty"`
+}
+
+// PolicyName is the name by which a policy's results are reported. Cluster
+// scoped policies are prefixed to distinguish them from namespaced policies of
+// the same name.
+func (p *PolicyReference) PolicyName() string {
+	if p.Scope == PolicyScopeCluster {
+		return "cluster." + p.Name
+	}
+	return p.Name
+}
+
+// HookPhase determines when a hook is executed relative to a run's command.
+// +kubebuilder:validation:Enum={"pre","post","on-failure"}
+type HookPhase string
+
+const (
+	// Hook is executed before the command. A failing pre-hook aborts the run.
+	HookPhasePre HookPhase = "pre"
+	// Hook is executed after the command completes successfully.
+	HookPhasePost HookPhase = "post"
+	// Hook is executed after the command fails.
+	HookPhaseOnFailure HookPhase = "on-failure"
+)
+
+// Hook is a script executed on a run's pod before or after the run's command,
+// with the same environment as the command.
+type Hook struct {
+	// Name of the hook, used to prefix its output and to record its result
+	Name string `json:"name"`
+
+	// Commands for which the hook is executed, e.g. plan, apply. If empty,
+	// the hook is executed for all commands.
+	Commands []string `json:"commands,omitempty"`
+
+	// When the hook is executed
+	Phase HookPhase `json:"phase"`
+
+	// Shell script to execute, e.g. 'tflint' or 'terraform fmt -check'
+	Script string `json:"script"`
+}
+
+// AppliesTo determines whether the hook is to be executed for the given
+// command
+func (h *Hook) AppliesTo(command string) bool {
+	return len(h.Commands) == 0 || slice.ContainsString(h.Commands, command)
+}
+
+// CredentialsSource is a source of credentials for a run. Only one of its
+// fields may be set.
+type CredentialsSource struct {
+	// Credentials contained in a secret
+	Secret *SecretCredentials `json:"secret,omitempty"`
+
+	// Projected service account token, for use with workload identity
+	// federation
+	ServiceAccountToken *ServiceAccountTokenCredentials `json:"serviceAccountToken,omitempty"`
+}
+
+// CredentialsMode determines how credentials in a secret are made available to
+// a run.
+// +kubebuilder:validation:Enum={"env","file"}
+type CredentialsMode string
+
+const (
+	// Secret keys are set as environment variables
+	CredentialsModeEnv CredentialsMode = "env"
+	// Secret keys are mounted as files
+	CredentialsModeFile CredentialsMode = "file"
+)
+
+// SecretCredentials makes the keys of a secret available to a run, either as
+// environment variables or as mounted files.
+type SecretCredentials struct {
+	// Name of the secret
+	Name string `json:"name"`
+
+	// +kubebuilder:default="env"
+
+	// Whether to set keys as environment variables or mount them as files.
+	// Files are mounted in /credentials/secrets/<name>/.
+	Mode CredentialsMode `json:"mode,omitempty"`
+
+	// Keys to make available. If empty, all keys are made available. Only
+	// with explicitly listed keys are environment variables set to the path
+	// of mounted files.
+	Items []SecretCredentialsItem `json:"items,omitempty"`
+}
+
+// SecretCredentialsItem is a key in a secret containing credentials.
+type SecretCredentialsItem struct {
+	// Key in the secret
+	Key string `json:"key"`
+
+	// Name of the environment variable. For mode 'env' it is set to the
+	// value of the key; for mode 'file' it is set to the path of the mounted
+	// file. Defaults to the name of the key.
+	EnvVar string `json:"envVar,omitempty"`
+}
+
+// CredentialsProvider is a cloud provider supporting workload identity
+// federation
+// +kubebuilder:validation:Enum={"aws","azure","gcp"}
+type CredentialsProvider string
+
+const (
+	CredentialsProviderAWS   CredentialsProvider = "aws"
+	CredentialsProviderAzure CredentialsProvider = "azure"
+	CredentialsProviderGCP   CredentialsProvider = "gcp"
+)
+
+// ServiceAccountTokenCredentials is a projected service account token with a
+// custom audience. The token is mounted in /credentials/tokens/token-<n>, where
+// n is the index of the source in the workspace's list of credentials sources.
+type ServiceAccountTokenCredentials struct {
+	// Intended audience of the token
+	Audience string `json:"audience"`
+
+	// +kubebuilder:validation:Minimum=600
+
+	// Requested validity of the token
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+
+	// Set environment variables expected by the provider to the path of the
+	// token: AWS_WEB_IDENTITY_TOKEN_FILE for aws; AZURE_FEDERATED_TOKEN_FILE
+	// and ARM_OIDC_TOKEN_FILE_PATH for azure; none for gcp, whose credential
+	// configuration file references the path instead.
+	Provider CredentialsProvider `json:"provider,omitempty"`
+
+	// Name of an additional environment variable to set to the path of the
+	// token
+	EnvVar string `json:"envVar,omitempty"`
+}
+
+// CLIConfig is terraform CLI configuration (the contents of a .terraformrc
+// file). It is rendered into a file on a run's pod, and TF_CLI_CONFIG_FILE is
+// set to its path.
+type CLIConfig struct {
+	// Inline terraform CLI configuration in HCL, e.g. provider_installation
+	// blocks, plugin_cache_may_break_dependency_lock_file, etc.
+	Inline string `json:"inline,omitempty"`
+
+	// Credentials for private registry hosts. Each host's token is read from a
+	// secret at the time a run is created and is never persisted in the
+	// workspace.
+	Credentials []RegistryCredentials `json:"credentials,omitempty"`
+}
+
+// RegistryCredentials references the API token for a private registry host.
+type RegistryCredentials struct {
+	// Hostname of the registry, e.g. app.terraform.io
+	Host string `json:"host"`
+
+	// Secret key containing the API token for the registry host
+	SecretKeyRef corev1.SecretKeySelector `json:"secretKeyRef"`
 }
 
 // WorkspaceSpec defines the desired state of Workspace's cache storage
@@ -119,12 +367,69 @@ type Variable struct {
 	// Variable value
 	Value string `json:"value"`
 	// Source for the variable's value. Cannot be used if value is not empty.
-	ValueFrom *corev1.EnvVarSource `json:"valueFrom,omitempty"`
+	ValueFrom *VariableSource `json:"valueFrom,omitempty"`
+	// HCL denotes if the value is an HCL expression, permitting values of
+	// any type, e.g. lists, maps and objects. Such variables are passed to
+	// terraform in a tfvars file rather than as environment variables, and
+	// so take precedence over the configuration's terraform.tfvars file.
+	HCL bool `json:"hcl,omitempty"`
 	// EnvironmentVariable denotes if this variable should be created as
 	// environment variable
 	EnvironmentVariable bool `json:"environmentVariable,omitempty"`
 }
 
+// VariableSource is a source for the value of a variable. In addition to the
+// sources of an environment variable, a value can be sourced from an output of
+// a workspace or from a field of a Kubernetes object. These are resolved by
+// the operator when a run's pod is created.
+type VariableSource struct {
+	corev1.EnvVarSource `json:",inline"`
+
+	// Selects an output of a workspace
+	WorkspaceOutput *WorkspaceOutputSelector `json:"workspaceOutput,omitempty"`
+
+	// Selects a field of a Kubernetes object in the namespace of the run
+	ObjectField *ObjectFieldSelector `json:"objectField,omitempty"`
+}
+
+// IsResolved determines whether the value is resolved by the operator rather
+// than by kubernetes
+func (s *VariableSource) IsResolved() bool {
+	return s.WorkspaceOutput != nil || s.ObjectField != nil
+}
+
+// WorkspaceOutputSelector selects an output of a workspace
+type WorkspaceOutputSelector struct {
+	// Namespace of the workspace. Defaults to the namespace of the run. A
+	// workspace in another namespace must share its outputs with the
+	// namespace of the run.
+	Namespace string `json:"namespace,omitempty"`
+
+	// Name of the workspace
+	Workspace string `json:"workspace"`
+
+	// Key of the output
+	Key string `json:"key"`
+}
+
+// ObjectFieldSelector selects a field of a Kubernetes object in the namespace
+// of the run. The object's kind must be namespaced and among the kinds the
+// operator permits.
+type ObjectFieldSelector struct {
+	// API version of the object, e.g. v1 or apps/v1
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object, e.g. Service
+	Kind string `json:"kind"`
+
+	// Name of the object
+	Name string `json:"name"`
+
+	// JSONPath expression selecting the field, e.g.
+	// {.status.loadBalancer.ingress[0].ip}
+	JSONPath string `json:"jsonPath"`
+}
+
 // Output outputs the values of Terraform output
 type Output struct {
 	// Attribute name in module
@@ -165,6 +470,38 @@ func (ws *Workspace) BackupObjectName() string {
 	return fmt.Sprintf("%s/%s.yaml", ws.Namespace, ws.Name)
 }
 
+// DestroyRunName returns the name of the run created to destroy the
+// workspace's resources upon its deletion.
+func (ws *Workspace) DestroyRunName() string {
+	return ws.Name + "-destroy"
+}
+
+// IsForceDeleted determines whether the workspace is annotated to permit its
+// deletion regardless of its deletion policy.
+func (ws *Workspace) IsForceDeleted() bool {
+	return ws.Annotations[ForceDeleteAnnotationKey] == "true"
+}
+
+// IsQueueBlocked determines whether the workspace is annotated to prevent its
+// queued runs from becoming active.
+func (ws *Workspace) IsQueueBlocked() bool {
+	return ws.Annotations[QueueBlockedAnnotationKey] == "true"
+}
+
+// SharesOutputsWith determines whether workspaces in the namespace may source
+// the values of variables from the workspace's outputs.
+func (ws *Workspace) SharesOutputsWith(namespace string) bool {
+	if namespace == ws.Namespace {
+		return true
+	}
+	for _, ns := range ws.Spec.ShareOutputsWith {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 func (ws *Workspace) BuiltinsConfigMapName() string {
 	return WorkspaceBuiltinsConfigMapName(ws.Name)
 }
@@ -173,6 +510,16 @@ func WorkspaceBuiltinsConfigMapName(name string) string {
 	return name + "-builtins"
 }
 
+// VariablesSecretName retrieves the name of the secret containing the values
+// of the workspace's sensitive variables.
+func (ws *Workspace) VariablesSecretName() string {
+	return WorkspaceVariablesSecretName(ws.Name)
+}
+
+func WorkspaceVariablesSecretName(name string) string {
+	return name + "-variables"
+}
+
 func (ws *Workspace) IsPrivilegedCommand(cmd string) bool {
 	return slice.ContainsString(ws.Spec.PrivilegedCommands, cmd)
 }
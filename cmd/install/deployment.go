@@ -106,6 +106,14 @@ func deployment(namespace string, opts ...podTemplateOption) *appsv1.Deployment
 									Name:  "ETOK_IMAGE",
 									Value: c.image,
 								},
+								{
+									Name: "ETOK_POLICIES_NAMESPACE",
+									ValueFrom: &corev1.EnvVarSource{
+										FieldRef: &corev1.ObjectFieldSelector{
+											FieldPath: "metadata.namespace",
+										},
+									},
+								},
 							},
 							TerminationMessagePolicy: "FallbackToLogsOnError",
 						},
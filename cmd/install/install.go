@@ -42,6 +42,9 @@ var (
 	crdPaths = []string{
 		"config/crd/bases/etok.dev_workspaces.yaml",
 		"config/crd/bases/etok.dev_runs.yaml",
+		"config/crd/bases/etok.dev_workspacetemplates.yaml",
+		"config/crd/bases/etok.dev_clusterworkspacetemplates.yaml",
+		"config/crd/bases/etok.dev_variablesets.yaml",
 	}
 	// Relative paths to the cluster roles to be installed. Paths relative to
 	// the root of the repo.
@@ -49,6 +52,7 @@ var (
 		"config/rbac/role.yaml",
 		"config/rbac/user.yaml",
 		"config/rbac/admin.yaml",
+		"config/rbac/sensitive_variables.yaml",
 	}
 
 	// Interval between polling deployment status
@@ -146,6 +150,7 @@ func (o *installOptions) install(ctx context.Context) error {
 		resources = append(resources, operatorClusterRoleBinding(o.namespace))
 		resources = append(resources, userClusterRoleBinding())
 		resources = append(resources, adminClusterRoleBinding())
+		resources = append(resources, sensitiveVariablesClusterRoleBinding())
 		resources = append(resources, namespace(o.namespace))
 		resources = append(resources, serviceAccount(o.namespace, o.serviceAccountAnnotations))
 
@@ -183,7 +183,7 @@ func TestInstallDryRun(t *testing.T) {
 		require.NoError(t, opts.install(context.Background()))
 
 		docs := strings.Split(out.String(), "---\n")
-		assert.Equal(t, 11, len(docs))
+		assert.Equal(t, 16, len(docs))
 	})
 }
 
@@ -199,6 +199,9 @@ func convertObjs(objs ...runtimeclient.Object) (converted []runtime.Object) {
 func wantedCRDs() (resources []runtimeclient.Object) {
 	resources = append(resources, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "workspaces.etok.dev"}})
 	resources = append(resources, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "runs.etok.dev"}})
+	resources = append(resources, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "workspacetemplates.etok.dev"}})
+	resources = append(resources, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "clusterworkspacetemplates.etok.dev"}})
+	resources = append(resources, &apiextv1.CustomResourceDefinition{ObjectMeta: metav1.ObjectMeta{Name: "variablesets.etok.dev"}})
 	return
 }
 
@@ -209,9 +212,11 @@ func wantedResources() (resources []runtimeclient.Object) {
 	resources = append(resources, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "etok"}})
 	resources = append(resources, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "etok-user"}})
 	resources = append(resources, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "etok-admin"}})
+	resources = append(resources, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "etok-sensitive-variables"}})
 	resources = append(resources, &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "etok"}})
 	resources = append(resources, &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "etok-user"}})
 	resources = append(resources, &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "etok-admin"}})
+	resources = append(resources, &rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "etok-sensitive-variables"}})
 	resources = append(resources, &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "etok", Name: "etok"}})
 	return
 }
@@ -90,6 +90,23 @@ func adminClusterRoleBinding() *rbacv1.ClusterRoleBinding {
 	}
 }
 
+func sensitiveVariablesClusterRoleBinding() *rbacv1.ClusterRoleBinding {
+	return &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "etok-sensitive-variables",
+		},
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "ClusterRoleBinding",
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+		},
+		RoleRef: rbacv1.RoleRef{
+			Kind:     "ClusterRole",
+			Name:     "etok-sensitive-variables",
+			APIGroup: "rbac.authorization.k8s.io",
+		},
+	}
+}
+
 func secret(namespace string, key []byte) *corev1.Secret {
 	secret := &corev1.Secret{
 		TypeMeta: metav1.TypeMeta{
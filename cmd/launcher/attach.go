@@ -0,0 +1,114 @@
+package launcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/spf13/cobra"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubectl/pkg/util/term"
+)
+
+var (
+	errRunNotFound = errors.New("run not found")
+	errTTYRequired = errors.New("run is awaiting a handshake and can only be attached to with a tty")
+)
+
+// AttachCmd resumes a run, typically one launched with --detach, or one whose
+// client was disconnected. It attaches to the run's TTY if the run is awaiting
+// a handshake or running interactively, otherwise it streams its logs. It then
+// awaits the run's completion, reporting its exit code.
+func AttachCmd(f *cmdutil.Factory) *cobra.Command {
+	o := &launcherOptions{Factory: f, namespace: defaultNamespace}
+
+	cmd := &cobra.Command{
+		Use:   "attach <run>",
+		Short: "Attach to a run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			o.runName = args[0]
+
+			// Defaults include the kube context, so look them up before
+			// creating the client
+			if err := o.lookupDefaults(cmd); err != nil {
+				return err
+			}
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.attach(cmd.Context())
+		},
+	}
+
+	flags.AddPathFlag(cmd, &o.path)
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+
+	cmd.Flags().BoolVar(&o.disableTTY, "no-tty", false, "disable tty")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "text", "output format: text or json. With json, lifecycle events are emitted on stderr")
+	cmd.Flags().StringVar(&o.summaryFile, "summary-file", "", "write summary of plan in markdown to file")
+
+	return cmd
+}
+
+func (o *launcherOptions) attach(ctx context.Context) error {
+	run, err := o.RunsClient(o.namespace).Get(ctx, o.runName, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return fmt.Errorf("%w: %s/%s", errRunNotFound, o.namespace, o.runName)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Adopt the run's command and workspace, which determine what is
+	// reported upon completion
+	o.command = run.Command
+	o.workspace = run.Workspace
+
+	if err := o.setEmitter(); err != nil {
+		return err
+	}
+
+	// Wait for the run's pod to be running, or to have completed
+	if err := o.watchRun(ctx, run, false); err != nil {
+		return err
+	}
+
+	// Retrieve the run again now that its pod is running
+	run, err = o.RunsClient(o.namespace).Get(ctx, o.runName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	if run.Handshake && isPodRunning(run) {
+		// Run is either awaiting a handshake or running interactively
+		if !o.disableTTY && term.IsTerminal(o.In) {
+			// Only send handshake if the runner is still awaiting it
+			handshake := ""
+			if !run.HandshakeReceived {
+				handshake = cmdutil.HandshakeString
+			}
+			return o.connect(ctx, true, handshake)
+		}
+		if !run.HandshakeReceived {
+			return fmt.Errorf("%w: %s", errTTYRequired, o.runName)
+		}
+	}
+
+	return o.connect(ctx, false, "")
+}
+
+// isPodRunning determines whether the run reports its pod is running
+func isPodRunning(run *v1alpha1.Run) bool {
+	complete := meta.FindStatusCondition(run.Conditions, v1alpha1.RunCompleteCondition)
+	return complete != nil && complete.Reason == v1alpha1.PodRunningReason
+}
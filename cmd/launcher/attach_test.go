@@ -0,0 +1,209 @@
+package launcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/creack/pty"
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/globals"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+func TestAttach(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  error
+		objs []runtime.Object
+		// Mock a tty on the client
+		tty bool
+		// Mock exit code of runner container
+		code int
+		// Override run status
+		overrideStatus func(*v1alpha1.RunStatus)
+		// Assertions against output and the handshake sent upon attaching
+		assertions func(t *testutil.T, out, handshake string)
+	}{
+		{
+			name: "stream logs",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply")},
+			assertions: func(t *testutil.T, out, _ string) {
+				assert.Equal(t, "fake logs", out)
+			},
+		},
+		{
+			name: "stream logs with tty",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply")},
+			tty:  true,
+			assertions: func(t *testutil.T, out, _ string) {
+				// Run is not awaiting a handshake so there is nothing to attach
+				// to
+				assert.Equal(t, "fake logs", out)
+			},
+		},
+		{
+			name: "attach and send handshake",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply", withHandshake)},
+			tty:  true,
+			assertions: func(t *testutil.T, out, handshake string) {
+				assert.Equal(t, "fake attach", out)
+				assert.Equal(t, cmdutil.HandshakeString, handshake)
+			},
+		},
+		{
+			name: "attach to interactive run",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply", withHandshake)},
+			tty:  true,
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.HandshakeReceived = true
+			},
+			assertions: func(t *testutil.T, out, handshake string) {
+				assert.Equal(t, "fake attach", out)
+				// Handshake should not be sent again
+				assert.Equal(t, "", handshake)
+			},
+		},
+		{
+			name: "stream logs of interactive run without tty",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply", withHandshake)},
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.HandshakeReceived = true
+			},
+			assertions: func(t *testutil.T, out, _ string) {
+				assert.Equal(t, "fake logs", out)
+			},
+		},
+		{
+			name: "run awaiting handshake without tty",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply", withHandshake)},
+			err:  errTTYRequired,
+		},
+		{
+			name: "completed run awaiting handshake",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "apply", withHandshake)},
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.Conditions[0].Reason = v1alpha1.PodFailedReason
+			},
+			code: 1,
+			err:  etokerrors.NewExitError(1),
+			assertions: func(t *testutil.T, out, _ string) {
+				// Logs of a completed run can always be retrieved
+				assert.Equal(t, "fake logs", out)
+			},
+		},
+		{
+			name: "plan summary",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{testobj.Run("default", "run-12345", "plan")},
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.Plan = &v1alpha1.PlanSummary{}
+			},
+			assertions: func(t *testutil.T, out, _ string) {
+				assert.Contains(t, out, "Summary: no changes\n")
+			},
+		},
+		{
+			name: "lock file",
+			args: []string{"run-12345"},
+			objs: []runtime.Object{
+				testobj.Run("default", "run-12345", "init"),
+				testobj.ConfigMap("default", "run-12345-lockfile", testobj.WithBinaryData(globals.LockFile, []byte("hashes"))),
+			},
+			assertions: func(t *testutil.T, out, _ string) {
+				lock, err := ioutil.ReadFile(globals.LockFile)
+				require.NoError(t, err)
+				assert.Equal(t, "hashes", string(lock))
+			},
+		},
+		{
+			name: "run not found",
+			args: []string{"run-12345"},
+			err:  errRunNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			t.NewTempDir().Chdir()
+
+			// Mock the run controller by setting status up front
+			for _, obj := range tt.objs {
+				if run, ok := obj.(*v1alpha1.Run); ok {
+					code := tt.code
+					run.RunStatus = v1alpha1.RunStatus{
+						Conditions: []metav1.Condition{
+							{
+								Type:   v1alpha1.RunCompleteCondition,
+								Status: metav1.ConditionFalse,
+								Reason: v1alpha1.PodRunningReason,
+							},
+						},
+						Phase:    v1alpha1.RunPhaseRunning,
+						ExitCode: &code,
+					}
+					if tt.overrideStatus != nil {
+						tt.overrideStatus(&run.RunStatus)
+					}
+				}
+			}
+
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			if tt.tty {
+				var err error
+				f.In, _, err = pty.Open()
+				require.NoError(t, err)
+			}
+
+			// Record handshake sent upon attaching
+			var handshake string
+			f.AttachFunc = func(out io.Writer, _ rest.Config, _, _ string, _ *os.File, hs, _ string) error {
+				handshake = hs
+				out.Write([]byte("fake attach"))
+				return nil
+			}
+
+			cmd := AttachCmd(f)
+			cmd.SetOut(out)
+			cmd.SetArgs(tt.args)
+			// Only check output of the run
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			err := cmd.ExecuteContext(context.Background())
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			if tt.assertions != nil {
+				tt.assertions(t, out.String(), handshake)
+			}
+		})
+	}
+}
+
+func withHandshake(run *v1alpha1.Run) {
+	run.Handshake = true
+}
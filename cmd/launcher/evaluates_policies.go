@@ -0,0 +1,13 @@
+package launcher
+
+import "github.com/leg100/etok/pkg/util/slice"
+
+// Commands whose plan is evaluated against a workspace's policies
+var evaluatesPolicies = []string{
+	"apply",
+	"plan",
+}
+
+func EvaluatesPolicies(cmd string) bool {
+	return slice.ContainsString(evaluatesPolicies, cmd)
+}
@@ -0,0 +1,385 @@
+package launcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/util/slice"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	defaultParallelism = 5
+)
+
+var (
+	errFanOutWorkspace     = errors.New("--workspace cannot be combined with --workspaces or --selector")
+	errInvalidParallelism  = errors.New("--parallelism must be at least 1")
+	errInvalidPattern      = errors.New("invalid workspaces pattern")
+	errNoWorkspacesMatched = errors.New("no workspaces matched")
+	errFanOutFailed        = errors.New("runs failed")
+)
+
+// deployedArchive is an archive deployed in a config map
+type deployedArchive struct {
+	// Name of the config map
+	configMap string
+	// Relative path to root module within the archive
+	root string
+	// Provenance of the config in the archive
+	provenance *v1alpha1.Provenance
+}
+
+// fanOutResult is the outcome of a workspace's run when fanning out
+type fanOutResult struct {
+	workspace string
+	run       string
+	// Whether the run was created
+	created bool
+	// Error returned from launching the run, including a non-zero exit code
+	err  error
+	plan *v1alpha1.PlanSummary
+}
+
+// fanningOut determines whether the command is to be fanned out across
+// workspaces
+func (o *launcherOptions) fanningOut() bool {
+	return o.workspacesPattern != "" || o.selector != ""
+}
+
+func (o *launcherOptions) validateFanOut(cmd *cobra.Command) error {
+	if flags.IsFlagPassed(cmd.Flags(), "workspace") {
+		return errFanOutWorkspace
+	}
+	if o.parallelism < 1 {
+		return errInvalidParallelism
+	}
+	if _, err := filepath.Match(o.workspacesPattern, ""); err != nil {
+		return fmt.Errorf("%w: %s", errInvalidPattern, o.workspacesPattern)
+	}
+	return nil
+}
+
+// fanOut uploads the config once and runs the command on each matching
+// workspace, concurrently up to the parallelism limit. Each run's output is
+// prefixed with its workspace, or written to a file per workspace. A summary
+// of the runs is printed once they are done, and the highest exit code is
+// returned.
+func (o *launcherOptions) fanOut(ctx context.Context) error {
+	workspaces, err := o.matchWorkspaces(ctx)
+	if err != nil {
+		return err
+	}
+
+	if o.outputDir != "" {
+		if err := os.MkdirAll(o.outputDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	tarball, root, err := o.buildArchive()
+	if err != nil {
+		return err
+	}
+
+	if err := o.createConfigMap(ctx, tarball, o.runName, v1alpha1.RunDefaultConfigMapKey); err != nil {
+		return err
+	}
+	shared := &deployedArchive{
+		configMap:  o.runName,
+		root:       root,
+		provenance: o.provenance(tarball),
+	}
+
+	// Runs share stdout and stderr
+	out := &syncWriter{w: o.Out}
+	errOut := &syncWriter{w: o.ErrOut}
+
+	results := make([]fanOutResult, len(workspaces))
+	sem := make(chan struct{}, o.parallelism)
+	var wg sync.WaitGroup
+	for i, ws := range workspaces {
+		wg.Add(1)
+		go func(i int, ws string) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = o.runWorkspace(ctx, ws, fmt.Sprintf("%s-%d", o.runName, i), i == 0, shared, out, errOut)
+		}(i, ws)
+	}
+	wg.Wait()
+
+	var created bool
+	for _, r := range results {
+		created = created || r.created
+	}
+	if !created && !o.disableResourceCleanup {
+		// The archive is deleted along with the runs that own it, but there
+		// are no such runs
+		o.cleanup()
+	}
+
+	if o.detach {
+		return aggregateResults(results)
+	}
+
+	if o.output == "text" {
+		o.printFanOutSummary(results)
+	}
+
+	if o.summaryFile != "" {
+		if err := ioutil.WriteFile(o.summaryFile, []byte(markdownFanOutSummary(results)), 0644); err != nil {
+			return fmt.Errorf("unable to write summary file: %w", err)
+		}
+		klog.V(1).Infof("Written %s", o.summaryFile)
+	}
+
+	return aggregateResults(results)
+}
+
+// matchWorkspaces returns the names of workspaces matching the glob pattern
+// and the label selector, in order of name
+func (o *launcherOptions) matchWorkspaces(ctx context.Context) ([]string, error) {
+	list, err := o.WorkspacesClient(o.namespace).List(ctx, metav1.ListOptions{LabelSelector: o.selector})
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, ws := range list.Items {
+		if o.workspacesPattern != "" {
+			if matched, _ := filepath.Match(o.workspacesPattern, ws.Name); !matched {
+				continue
+			}
+		}
+		names = append(names, ws.Name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w in namespace %s", errNoWorkspacesMatched, o.namespace)
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// runWorkspace launches a run on a workspace, using an archive already
+// deployed. Only the first workspace's run retrieves the lock file, to avoid
+// several runs writing it at once.
+func (o *launcherOptions) runWorkspace(ctx context.Context, workspace, runName string, first bool, shared *deployedArchive, out, errOut io.Writer) fanOutResult {
+	result := fanOutResult{workspace: workspace, run: runName}
+
+	child := *o
+	child.workspace = workspace
+	child.runName = runName
+	child.sharedArchive = shared
+	child.skipLockFile = !first
+	// There is no TTY to share between runs
+	child.disableTTY = true
+	// Summaries are written to the summary file once all runs are done
+	child.summaryFile = ""
+	child.createdRun = false
+	child.createdArchive = false
+
+	// Give the run its own output
+	f := *o.Factory
+	child.Factory = &f
+	child.ErrOut = errOut
+	if o.outputDir != "" {
+		file, err := os.Create(filepath.Join(o.outputDir, workspace+".log"))
+		if err != nil {
+			result.err = err
+			return result
+		}
+		defer file.Close()
+		child.Out = file
+	} else {
+		lw := &lineWriter{w: out, prefix: fmt.Sprintf("[%s] ", workspace)}
+		defer lw.Flush()
+		child.Out = lw
+	}
+
+	if err := child.setEmitter(); err != nil {
+		result.err = err
+		return result
+	}
+
+	result.err = child.run(ctx)
+	result.created = child.createdRun
+	if result.err != nil {
+		var exit etokerrors.ExitError
+		if !errors.As(result.err, &exit) && !o.disableResourceCleanup {
+			child.cleanup()
+			result.created = false
+		}
+	}
+
+	if result.created && slice.ContainsString(summarisesPlan, o.command) {
+		if run, err := o.RunsClient(o.namespace).Get(ctx, runName, metav1.GetOptions{}); err == nil {
+			result.plan = run.Plan
+		}
+	}
+
+	return result
+}
+
+// aggregateResults returns an error if any run failed to complete, otherwise
+// the highest exit code of the runs.
+func aggregateResults(results []fanOutResult) error {
+	var failed, code int
+	for _, r := range results {
+		if r.err == nil {
+			continue
+		}
+		var exit etokerrors.ExitError
+		if errors.As(r.err, &exit) {
+			if exit.ExitCode() > code {
+				code = exit.ExitCode()
+			}
+			continue
+		}
+		failed++
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d workspaces", errFanOutFailed, failed, len(results))
+	}
+	if code != 0 {
+		return etokerrors.NewExitError(code)
+	}
+	return nil
+}
+
+// printFanOutSummary prints a table summarising the outcome of each
+// workspace's run
+func (o *launcherOptions) printFanOutSummary(results []fanOutResult) {
+	withPlan := slice.ContainsString(summarisesPlan, o.command)
+
+	fmt.Fprintln(o.Out)
+	tw := tabwriter.NewWriter(o.Out, 0, 8, 2, ' ', 0)
+	header := "WORKSPACE\tRUN\tEXIT\tRESULT"
+	if withPlan {
+		header += "\tPLAN"
+	}
+	fmt.Fprintln(tw, header)
+	for _, r := range results {
+		run := r.run
+		if !r.created {
+			run = "-"
+		}
+		line := fmt.Sprintf("%s\t%s\t%s\t%s", r.workspace, run, r.exitCode(), r.outcome())
+		if withPlan {
+			plan := "-"
+			if r.plan != nil {
+				plan = planSummaryCounts(r.plan)
+			}
+			line += "\t" + plan
+		}
+		fmt.Fprintln(tw, line)
+	}
+	tw.Flush()
+}
+
+// markdownFanOutSummary renders the plan summary of each workspace's run in
+// markdown
+func markdownFanOutSummary(results []fanOutResult) string {
+	b := new(strings.Builder)
+	for i, r := range results {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "### %s\n\n", r.workspace)
+		if r.plan != nil {
+			b.WriteString(markdownPlanSummary(r.plan))
+		} else {
+			fmt.Fprintf(b, "%s\n", r.outcome())
+		}
+	}
+	return b.String()
+}
+
+func (r *fanOutResult) exitCode() string {
+	if code, ok := exitCode(r.err); ok {
+		return fmt.Sprint(code)
+	}
+	return "-"
+}
+
+func (r *fanOutResult) outcome() string {
+	if r.err == nil {
+		return "succeeded"
+	}
+	var exit etokerrors.ExitError
+	if errors.As(r.err, &exit) {
+		return "failed"
+	}
+	return "error: " + r.err.Error()
+}
+
+// syncWriter serialises writes to a writer shared by several runs
+type syncWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (sw *syncWriter) Write(p []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.w.Write(p)
+}
+
+// lineWriter prefixes each line written to the underlying writer, writing only
+// whole lines so that the output of several runs can be interleaved. Call
+// Flush to write any remaining partial line.
+type lineWriter struct {
+	w      io.Writer
+	prefix string
+	// Partial line awaiting a newline
+	buf []byte
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+
+	i := strings.LastIndexByte(string(lw.buf), '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	var lines strings.Builder
+	for _, line := range strings.SplitAfter(string(lw.buf[:i+1]), "\n") {
+		if line != "" {
+			lines.WriteString(lw.prefix + line)
+		}
+	}
+	lw.buf = lw.buf[i+1:]
+
+	if _, err := io.WriteString(lw.w, lines.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (lw *lineWriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(lw.w, lw.prefix+string(lw.buf)+"\n")
+	lw.buf = nil
+	return err
+}
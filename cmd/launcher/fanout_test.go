@@ -0,0 +1,243 @@
+package launcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestFanOut(t *testing.T) {
+	workspaces := []runtime.Object{
+		testobj.Workspace("default", "prod-eu", testobj.WithLabels("env", "prod")),
+		testobj.Workspace("default", "prod-us", testobj.WithLabels("env", "prod")),
+		testobj.Workspace("default", "dev", testobj.WithLabels("env", "dev")),
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		objs           []runtime.Object
+		overrideStatus func(*v1alpha1.RunStatus)
+		err            error
+		assertions     func(*testutil.T, *launcherOptions)
+	}{
+		{
+			name: "pattern",
+			args: []string{"--workspaces", "prod-*"},
+			objs: workspaces,
+			assertions: func(t *testutil.T, o *launcherOptions) {
+				for i, ws := range []string{"prod-eu", "prod-us"} {
+					run, err := o.RunsClient("default").Get(context.Background(), fmt.Sprintf("run-12345-%d", i), metav1.GetOptions{})
+					require.NoError(t, err)
+					assert.Equal(t, ws, run.Workspace)
+					assert.Equal(t, "run-12345", run.ConfigMap)
+				}
+				_, err := o.RunsClient("default").Get(context.Background(), "run-12345-2", metav1.GetOptions{})
+				assert.Error(t, err)
+
+				// Archive is uploaded once
+				_, err = o.ConfigMapsClient("default").Get(context.Background(), "run-12345", metav1.GetOptions{})
+				assert.NoError(t, err)
+
+				out := o.Out.(*bytes.Buffer).String()
+				assert.Contains(t, out, "[prod-eu] fake logs\n")
+				assert.Contains(t, out, "[prod-us] fake logs\n")
+				assert.NotContains(t, out, "[dev]")
+				assert.Regexp(t, `WORKSPACE\s+RUN\s+EXIT\s+RESULT\s+PLAN`, out)
+				assert.Regexp(t, `prod-eu\s+run-12345-0\s+0\s+succeeded`, out)
+				assert.Regexp(t, `prod-us\s+run-12345-1\s+0\s+succeeded`, out)
+			},
+		},
+		{
+			name: "selector",
+			args: []string{"--selector", "env=dev"},
+			objs: workspaces,
+			assertions: func(t *testutil.T, o *launcherOptions) {
+				run, err := o.RunsClient("default").Get(context.Background(), "run-12345-0", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "dev", run.Workspace)
+
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "[dev] fake logs\n")
+			},
+		},
+		{
+			name: "output directory",
+			args: []string{"--workspaces", "prod-*", "--output-dir", "logs"},
+			objs: workspaces,
+			assertions: func(t *testutil.T, o *launcherOptions) {
+				for _, ws := range []string{"prod-eu", "prod-us"} {
+					logs, err := ioutil.ReadFile(filepath.Join("logs", ws+".log"))
+					require.NoError(t, err)
+					assert.Contains(t, string(logs), "fake logs")
+				}
+				assert.NotContains(t, o.Out.(*bytes.Buffer).String(), "fake logs")
+			},
+		},
+		{
+			name: "summary file",
+			args: []string{"--workspaces", "prod-*", "--summary-file", "summary.md"},
+			objs: workspaces,
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.Plan = &v1alpha1.PlanSummary{
+					Add:       1,
+					Resources: []v1alpha1.ResourceChange{{Address: "random_id.a", Action: "create"}},
+				}
+			},
+			assertions: func(t *testutil.T, o *launcherOptions) {
+				summary, err := ioutil.ReadFile("summary.md")
+				require.NoError(t, err)
+				assert.Contains(t, string(summary), "### prod-eu\n\n#### Plan: 1 to add")
+				assert.Contains(t, string(summary), "### prod-us\n\n#### Plan: 1 to add")
+			},
+		},
+		{
+			name: "highest exit code",
+			args: []string{"--workspaces", "prod-*"},
+			objs: workspaces,
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				code := 2
+				status.ExitCode = &code
+			},
+			err: etokerrors.NewExitError(2),
+			assertions: func(t *testutil.T, o *launcherOptions) {
+				assert.Regexp(t, `prod-eu\s+run-12345-0\s+2\s+failed`, o.Out.(*bytes.Buffer).String())
+			},
+		},
+		{
+			name: "no workspaces matched",
+			args: []string{"--workspaces", "staging-*"},
+			objs: workspaces,
+			err:  errNoWorkspacesMatched,
+		},
+		{
+			name: "combined with workspace flag",
+			args: []string{"--workspaces", "prod-*", "--workspace", "dev"},
+			objs: workspaces,
+			err:  errFanOutWorkspace,
+		},
+		{
+			name: "invalid parallelism",
+			args: []string{"--workspaces", "prod-*", "--parallelism", "0"},
+			objs: workspaces,
+			err:  errInvalidParallelism,
+		},
+		{
+			name: "invalid pattern",
+			args: []string{"--workspaces", "prod-["},
+			objs: workspaces,
+			err:  errInvalidPattern,
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			t.NewTempDir().Chdir().WriteRandomFile("test.bin", 0)
+
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			opts := &launcherOptions{command: "plan", runName: "run-12345"}
+
+			// Mock the workspace controller by setting status up front
+			var code int
+			status := v1alpha1.RunStatus{
+				Conditions: []metav1.Condition{
+					{
+						Type:   v1alpha1.RunCompleteCondition,
+						Status: metav1.ConditionFalse,
+						Reason: v1alpha1.PodRunningReason,
+					},
+				},
+				Phase:    v1alpha1.RunPhaseRunning,
+				ExitCode: &code,
+			}
+			if tt.overrideStatus != nil {
+				tt.overrideStatus(&status)
+			}
+			opts.status = &status
+
+			cmd := launcherCommand(f, opts)
+			cmd.SetOut(out)
+			cmd.SetArgs(tt.args)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			err := cmd.ExecuteContext(context.Background())
+			if tt.err != nil {
+				var exit etokerrors.ExitError
+				if errors.As(tt.err, &exit) {
+					assert.Equal(t, tt.err, err)
+				} else {
+					assert.True(t, errors.Is(err, tt.err), "unexpected error: %v", err)
+				}
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tt.assertions != nil {
+				tt.assertions(t, opts)
+			}
+		})
+	}
+}
+
+func TestAggregateResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []fanOutResult
+		err     error
+	}{
+		{
+			name:    "all succeeded",
+			results: []fanOutResult{{}, {}},
+		},
+		{
+			name:    "highest exit code",
+			results: []fanOutResult{{err: etokerrors.NewExitError(1)}, {err: etokerrors.NewExitError(3)}, {}},
+			err:     etokerrors.NewExitError(3),
+		},
+		{
+			name:    "failed to complete",
+			results: []fanOutResult{{err: etokerrors.NewExitError(1)}, {err: errors.New("timed out")}},
+			err:     errFanOutFailed,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			err := aggregateResults(tt.results)
+			if tt.err == errFanOutFailed {
+				assert.True(t, errors.Is(err, errFanOutFailed))
+			} else {
+				assert.Equal(t, tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	lw := &lineWriter{w: out, prefix: "[dev] "}
+
+	lw.Write([]byte("first line\nsecond "))
+	assert.Equal(t, "[dev] first line\n", out.String())
+
+	lw.Write([]byte("line\n\nthird"))
+	assert.Equal(t, "[dev] first line\n[dev] second line\n[dev] \n", out.String())
+
+	require.NoError(t, lw.Flush())
+	assert.Equal(t, "[dev] first line\n[dev] second line\n[dev] \n[dev] third\n", out.String())
+}
@@ -18,14 +18,19 @@ import (
 	"github.com/leg100/etok/pkg/client"
 	"github.com/leg100/etok/pkg/env"
 	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/events"
 	"github.com/leg100/etok/pkg/globals"
 	"github.com/leg100/etok/pkg/handlers"
 	"github.com/leg100/etok/pkg/k8s"
 	"github.com/leg100/etok/pkg/labels"
 	"github.com/leg100/etok/pkg/logstreamer"
 	"github.com/leg100/etok/pkg/monitors"
+	"github.com/leg100/etok/pkg/project"
 	"github.com/leg100/etok/pkg/util"
+	"github.com/leg100/etok/pkg/util/slice"
+	"github.com/leg100/etok/pkg/variables"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"golang.org/x/sync/errgroup"
 
 	corev1 "k8s.io/api/core/v1"
@@ -33,6 +38,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	watchtools "k8s.io/client-go/tools/watch"
 	"k8s.io/klog/v2"
 	"k8s.io/kubectl/pkg/util/term"
@@ -47,10 +53,12 @@ const (
 )
 
 var (
-	errNotAuthorised     = errors.New("you are not authorised")
-	errWorkspaceNotFound = errors.New("workspace not found")
-	errWorkspaceNotReady = errors.New("workspace not ready")
-	errReconcileTimeout  = errors.New("timed out waiting for run to be reconciled")
+	errNotAuthorised      = errors.New("you are not authorised")
+	errWorkspaceNotFound  = errors.New("workspace not found")
+	errWorkspaceNotReady  = errors.New("workspace not ready")
+	errReconcileTimeout   = errors.New("timed out waiting for run to be reconciled")
+	errInvalidOutput      = errors.New("invalid output format")
+	errInvalidFlagDefault = errors.New("invalid value for flag")
 )
 
 // launcherOptions deploys a new Run. It monitors not only its progress, but
@@ -93,6 +101,47 @@ type launcherOptions struct {
 	// Disable TTY detection
 	disableTTY bool
 
+	// Return once the run has been created and reconciled, rather than
+	// connecting to its pod and awaiting its completion
+	detach bool
+
+	// Path to which to write plan summary in markdown
+	summaryFile string
+
+	// Paths to files and directories to include in the archive, in addition
+	// to modules and paths referenced in args
+	includes []string
+	// Patterns of paths to exclude from the archive, in addition to those in
+	// .terraformignore
+	excludes []string
+
+	// Clone remote git modules on the client and include them in the archive
+	vendorModules bool
+
+	// Message describing the run, recorded in its provenance
+	message string
+
+	// Fan out the command across workspaces with names matching the glob
+	// pattern and/or labels matching the selector
+	workspacesPattern string
+	selector          string
+	// Maximum number of runs to execute concurrently when fanning out
+	parallelism int
+	// Directory to which to write the output of each workspace's run when
+	// fanning out, rather than to stdout
+	outputDir string
+
+	// Archive already deployed, shared with the runs of other workspaces when
+	// fanning out
+	sharedArchive *deployedArchive
+	// Skip retrieving the lock file
+	skipLockFile bool
+
+	// Output format: text or json. With json, lifecycle events are emitted
+	// on stderr.
+	output string
+	events events.Emitter
+
 	// Recall if resources are created so that if error occurs they can be cleaned up
 	createdRun     bool
 	createdArchive bool
@@ -116,15 +165,28 @@ func launcherCommand(f *cmdutil.Factory, o *launcherOptions) *cobra.Command {
 				o.runName = fmt.Sprintf("run-%s", util.GenerateRandomString(5))
 			}
 
+			// Defaults include the kube context, so look them up before
+			// creating the client
+			if err := o.lookupDefaults(cmd); err != nil {
+				return err
+			}
+
 			o.Client, err = f.Create(o.kubeContext)
 			if err != nil {
 				return err
 			}
 
-			if err := o.lookupEnvFile(cmd); err != nil {
+			if err := o.setEmitter(); err != nil {
 				return err
 			}
 
+			if o.fanningOut() {
+				if err := o.validateFanOut(cmd); err != nil {
+					return err
+				}
+				return o.fanOut(cmd.Context())
+			}
+
 			err = o.run(cmd.Context())
 			if err != nil {
 				// Cleanup resources upon error. An exit code error means the
@@ -149,15 +211,68 @@ func launcherCommand(f *cmdutil.Factory, o *launcherOptions) *cobra.Command {
 	flags.AddDisableResourceCleanupFlag(cmd, &o.disableResourceCleanup)
 
 	cmd.Flags().BoolVar(&o.disableTTY, "no-tty", false, "disable tty")
+	cmd.Flags().BoolVar(&o.detach, "detach", false, "return once run is created, printing its name. Use 'etok attach' to resume")
+	cmd.Flags().StringVarP(&o.output, "output", "o", "text", "output format: text or json. With json, lifecycle events are emitted on stderr")
 	cmd.Flags().DurationVar(&o.podTimeout, "pod-timeout", time.Hour, "timeout for pod to be ready and running")
 	cmd.Flags().DurationVar(&o.handshakeTimeout, "handshake-timeout", v1alpha1.DefaultHandshakeTimeout, "timeout waiting for handshake")
 
 	cmd.Flags().DurationVar(&o.reconcileTimeout, "reconcile-timeout", defaultReconcileTimeout, "timeout for resource to be reconciled")
+	cmd.Flags().StringArrayVar(&o.includes, "include", nil, "path to file or directory to upload along with the config. Can be specified multiple times")
+	cmd.Flags().BoolVar(&o.vendorModules, "vendor-modules", false, "clone remote git modules using local git credentials and upload them along with the config")
+	cmd.Flags().StringVarP(&o.message, "message", "m", "", "message describing the run, recorded along with its provenance")
+
+	cmd.Flags().StringVar(&o.workspacesPattern, "workspaces", "", "run command on each workspace with a name matching the glob pattern, e.g. 'prod-*'")
+	cmd.Flags().StringVarP(&o.selector, "selector", "l", "", "run command on each workspace with labels matching the selector, e.g. 'env=prod'")
+	cmd.Flags().IntVar(&o.parallelism, "parallelism", defaultParallelism, "maximum number of runs to execute concurrently across workspaces")
+	cmd.Flags().StringVar(&o.outputDir, "output-dir", "", "write the output of each workspace's run to <dir>/<workspace>.log rather than to stdout")
+
+	if slice.ContainsString(summarisesPlan, o.command) {
+		cmd.Flags().StringVar(&o.summaryFile, "summary-file", "", "write summary of plan in markdown to file")
+	}
 
 	return cmd
 }
 
-func (o *launcherOptions) lookupEnvFile(cmd *cobra.Command) error {
+// lookupDefaults sets the namespace, workspace and kube context, unless set
+// by flag or env var. The namespace and workspace are read from the
+// environment file, falling back to the project config file, etok.yaml, which
+// also sets the kube context, defaults for other flags, and paths to include
+// and exclude from the archive.
+func (o *launcherOptions) lookupDefaults(cmd *cobra.Command) error {
+	// Record flags set by the user before setting defaults from the config
+	// file
+	passed := make(map[string]bool)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		passed[f.Name] = true
+	})
+
+	cfg, err := project.Load(o.path)
+	if err != nil {
+		return err
+	}
+	if cfg != nil {
+		defaults, err := cfg.DefaultsFor(o.path)
+		if err != nil {
+			return err
+		}
+		if !passed["namespace"] && defaults.Namespace != "" {
+			o.namespace = defaults.Namespace
+		}
+		if !passed["workspace"] && defaults.Workspace != "" {
+			o.workspace = defaults.Workspace
+		}
+		if !passed["context"] && defaults.Context != "" {
+			o.kubeContext = defaults.Context
+		}
+
+		if err := setFlagDefaults(cmd, cfg.Flags, passed); err != nil {
+			return err
+		}
+
+		o.includes = append(o.includes, cfg.Include...)
+		o.excludes = append(o.excludes, cfg.Exclude...)
+	}
+
 	etokenv, err := env.Read(o.path)
 	if err != nil {
 		// It's ok for envfile to not exist
@@ -165,26 +280,79 @@ func (o *launcherOptions) lookupEnvFile(cmd *cobra.Command) error {
 			return err
 		}
 	} else {
-		if !flags.IsFlagPassed(cmd.Flags(), "namespace") {
+		if !passed["namespace"] {
 			o.namespace = etokenv.Namespace
 		}
-		if !flags.IsFlagPassed(cmd.Flags(), "workspace") {
+		if !passed["workspace"] {
 			o.workspace = etokenv.Workspace
 		}
 	}
 	return nil
 }
 
+// setFlagDefaults sets flags from the project config file, skipping those
+// already set and those the command does not have. The flags' values are set
+// directly so that they are not deemed to have been passed by the user.
+func setFlagDefaults(cmd *cobra.Command, defaults map[string]interface{}, passed map[string]bool) error {
+	for name, val := range defaults {
+		if passed[name] {
+			continue
+		}
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			klog.V(1).Infof("ignoring flag %s in %s: not a flag of this command", name, project.ConfigFile)
+			continue
+		}
+
+		// A list sets a flag that can be specified multiple times
+		vals, ok := val.([]interface{})
+		if !ok {
+			vals = []interface{}{val}
+		}
+		for _, v := range vals {
+			if err := f.Value.Set(fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%w %s in %s: %s", errInvalidFlagDefault, name, project.ConfigFile, err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+// setEmitter sets the emitter of lifecycle events according to the output
+// format
+func (o *launcherOptions) setEmitter() error {
+	switch o.output {
+	case "text":
+		o.events = events.NopEmitter{}
+	case "json":
+		o.events = events.NewJSONEmitter(o.ErrOut, o.namespace, o.workspace, o.runName)
+	default:
+		return fmt.Errorf("%w: %s", errInvalidOutput, o.output)
+	}
+	return nil
+}
+
 func (o *launcherOptions) run(ctx context.Context) error {
-	isTTY := !o.disableTTY && term.IsTerminal(o.In)
+	// A detached run has no client to send it a handshake, so don't request
+	// one
+	isTTY := !o.disableTTY && !o.detach && term.IsTerminal(o.In)
+
+	// Check variables before creating any resources, so that an invalid value
+	// is reported before the run starts rather than by terraform
+	if ReadsVariables(o.command) {
+		if err := o.checkVariables(ctx); err != nil {
+			return err
+		}
+	}
 
 	// Tar up local config and deploy k8s resources
 	run, err := o.deploy(ctx, isTTY)
 	if err != nil {
 		return err
 	}
+	o.events.Emit(events.Event{Type: events.Created})
 
-	if IsQueueable(o.command) {
+	if IsQueueable(o.command) && !o.detach {
 		// Watch and log queue updates
 		o.watchQueue(ctx, run)
 	}
@@ -196,13 +364,19 @@ func (o *launcherOptions) run(ctx context.Context) error {
 	// either not installed or malfunctioning then the user would be none the
 	// wiser until the much longer PodTimeout had expired).
 	g.Go(func() error {
-		return o.waitForReconcile(gctx, run)
+		if err := o.waitForReconcile(gctx, run); err != nil {
+			return err
+		}
+		o.events.Emit(events.Event{Type: events.Reconciled})
+		return nil
 	})
 
-	// Wait for run to indicate pod is running
-	g.Go(func() error {
-		return o.watchRun(gctx, run, isTTY)
-	})
+	if !o.detach {
+		// Wait for run to indicate pod is running
+		g.Go(func() error {
+			return o.watchRun(gctx, run, isTTY)
+		})
+	}
 
 	// Check workspace exists and is healthy
 	if err := o.checkWorkspace(ctx, run); err != nil {
@@ -214,16 +388,39 @@ func (o *launcherOptions) run(ctx context.Context) error {
 		return err
 	}
 
+	if o.detach {
+		fmt.Fprintln(o.Out, run.Name)
+		return nil
+	}
+
+	handshake := ""
+	if isTTY {
+		handshake = cmdutil.HandshakeString
+	}
+	return o.connect(ctx, isTTY, handshake)
+}
+
+// connect connects to the run's pod, attaching to its TTY if isTTY is true,
+// otherwise streaming its logs. The handshake, if non-empty, is sent upon
+// attaching. It then awaits the run's exit code, reporting its plan summary and
+// retrieving its lock file where applicable.
+func (o *launcherOptions) connect(ctx context.Context, isTTY bool, handshake string) error {
 	// Watch the run for the container's exit code. Non-blocking.
 	exit := monitors.RunExitMonitor(ctx, o.EtokClient, o.namespace, o.runName)
 
+	// Emit a log event for each chunk of output
+	out := o.Out
+	if o.output == "json" {
+		out = events.NewLogWriter(o.Out, o.events)
+	}
+
 	// Connect to pod
 	if isTTY {
-		if err := o.AttachFunc(o.Out, *o.Config, o.namespace, o.runName, o.In.(*os.File), cmdutil.HandshakeString, globals.RunnerContainerName); err != nil {
+		if err := o.AttachFunc(out, *o.Config, o.namespace, o.runName, o.In.(*os.File), handshake, globals.RunnerContainerName); err != nil {
 			return err
 		}
 	} else {
-		if err := logstreamer.Stream(ctx, o.GetLogsFunc, o.Out, o.PodsClient(o.namespace), o.runName, globals.RunnerContainerName); err != nil {
+		if err := logstreamer.Stream(ctx, o.GetLogsFunc, out, o.PodsClient(o.namespace), o.runName, globals.RunnerContainerName); err != nil {
 			return err
 		}
 	}
@@ -233,17 +430,27 @@ func (o *launcherOptions) run(ctx context.Context) error {
 	case <-time.After(10 * time.Second):
 		return fmt.Errorf("timed out waiting for exit code")
 	case code := <-exit:
+		if exitCode, ok := exitCode(code); ok {
+			o.events.Emit(events.Event{Type: events.Completed, ExitCode: &exitCode})
+		}
+		if slice.ContainsString(summarisesPlan, o.command) {
+			// Report plan summary regardless of exit code, e.g. a plan that
+			// violates a policy has a summary but a non-zero exit code
+			if err := o.reportPlanSummary(ctx); err != nil {
+				return err
+			}
+		}
 		if code != nil {
 			return code
 		}
 	}
 
-	if UpdatesLockFile(o.command) {
+	if UpdatesLockFile(o.command) && !o.skipLockFile {
 		// Some commands (e.g. terraform init) update the lock file,
 		// .terraform.lock.hcl, and it's recommended that this be committed to
 		// version control. So the runner copies it to a config map, and it is
 		// here that that config map is retrieved.
-		lock, err := o.ConfigMapsClient(o.namespace).Get(ctx, v1alpha1.RunLockFileConfigMapName(run.Name), metav1.GetOptions{})
+		lock, err := o.ConfigMapsClient(o.namespace).Get(ctx, v1alpha1.RunLockFileConfigMapName(o.runName), metav1.GetOptions{})
 		if err != nil {
 			return err
 		}
@@ -255,6 +462,7 @@ func (o *launcherOptions) run(ctx context.Context) error {
 		}
 
 		klog.V(1).Infof("Written %s", lockFilePath)
+		o.events.Emit(events.Event{Type: events.LockFileWritten, Path: lockFilePath})
 	}
 
 	return nil
@@ -262,20 +470,60 @@ func (o *launcherOptions) run(ctx context.Context) error {
 
 func (o *launcherOptions) watchRun(ctx context.Context, run *v1alpha1.Run, isTTY bool) error {
 	lw := &k8s.RunListWatcher{Client: o.EtokClient, Name: run.Name, Namespace: run.Namespace}
-	_, err := watchtools.UntilWithSync(ctx, lw, &v1alpha1.Run{}, nil, handlers.RunConnectable(run.Name, isTTY))
+	connectable := handlers.RunConnectable(run.Name, isTTY)
+
+	// Emit an event upon the run entering the provisioning or running phase
+	var lastPhase v1alpha1.RunPhase
+	_, err := watchtools.UntilWithSync(ctx, lw, &v1alpha1.Run{}, nil, func(event watch.Event) (bool, error) {
+		if r, ok := event.Object.(*v1alpha1.Run); ok && r.Name == run.Name && r.Phase != lastPhase {
+			lastPhase = r.Phase
+			switch r.Phase {
+			case v1alpha1.RunPhaseProvisioning:
+				o.events.Emit(events.Event{Type: events.Provisioning})
+			case v1alpha1.RunPhaseRunning:
+				o.events.Emit(events.Event{Type: events.Running})
+			}
+		}
+		return connectable(event)
+	})
 	return err
 }
 
 func (o *launcherOptions) watchQueue(ctx context.Context, run *v1alpha1.Run) {
+	hdlr := handlers.LogQueuePosition(o.Out, run.Name)
+	if o.output == "json" {
+		// Emit an event whenever the queue position changes
+		var lastPosition int
+		hdlr = handlers.QueuePosition(run.Name, func(ws *v1alpha1.Workspace, position int) {
+			if position != lastPosition {
+				lastPosition = position
+				o.events.Emit(events.Event{Type: events.Queued, Position: position, Active: ws.Status.Active})
+			}
+		})
+	}
+
 	go func() {
 		lw := &k8s.WorkspaceListWatcher{Client: o.EtokClient, Name: o.workspace, Namespace: o.namespace}
 		// Ignore errors TODO: the current logger has no warning level. We
 		// should probably upgrade the logger to something that does, and then
 		// log any error here as a warning.
-		_, _ = watchtools.UntilWithSync(ctx, lw, &v1alpha1.Workspace{}, nil, handlers.LogQueuePosition(run.Name))
+		_, _ = watchtools.UntilWithSync(ctx, lw, &v1alpha1.Workspace{}, nil, hdlr)
 	}()
 }
 
+// exitCode derives the exit code from the error reported by the exit monitor.
+// False is returned if the exit code could not be retrieved.
+func exitCode(err error) (int, bool) {
+	if err == nil {
+		return 0, true
+	}
+	var exit etokerrors.ExitError
+	if errors.As(err, &exit) {
+		return exit.ExitCode(), true
+	}
+	return 0, false
+}
+
 func (o *launcherOptions) checkWorkspace(ctx context.Context, run *v1alpha1.Run) error {
 	ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
 	if kerrors.IsNotFound(err) {
@@ -304,50 +552,123 @@ func (o *launcherOptions) checkWorkspace(ctx context.Context, run *v1alpha1.Run)
 	return nil
 }
 
-// Deploy configmap and run resources in parallel
-func (o *launcherOptions) deploy(ctx context.Context, isTTY bool) (run *v1alpha1.Run, err error) {
-	g, ctx := errgroup.WithContext(ctx)
+// checkVariables checks the values of the workspace's variables, including
+// those of variable sets that apply to it, against the types of the variables
+// declared in the root module
+func (o *launcherOptions) checkVariables(ctx context.Context) error {
+	ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		// Leave it to checkWorkspace to report the missing workspace
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 
-	// Construct new archive
-	arc, err := archive.NewArchive(o.path)
+	sets, err := o.ListVariableSets(ctx, o.namespace)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Add local module references to archive
-	if err := arc.Walk(); err != nil {
-		return nil, err
+	return variables.Check(variables.Effective(ws, sets), o.path)
+}
+
+// Deploy configmap and run resources in parallel
+func (o *launcherOptions) deploy(ctx context.Context, isTTY bool) (run *v1alpha1.Run, err error) {
+	if o.sharedArchive != nil {
+		// Archive has already been deployed, so only the run is to be
+		// deployed
+		return o.createRun(ctx, o.runName, o.sharedArchive.configMap, isTTY, o.sharedArchive.root, o.sharedArchive.provenance)
 	}
 
-	// Get relative path to root module within archive
-	root, err := arc.RootPath()
+	tarball, root, err := o.buildArchive()
 	if err != nil {
 		return nil, err
 	}
 
-	// Compile tarball of local terraform modules, embed in configmap and deploy
-	g.Go(func() error {
-		w := new(bytes.Buffer)
-		meta, err := arc.Pack(w)
-		if err != nil {
-			return err
-		}
+	// Record where the config came from
+	provenance := o.provenance(tarball)
 
-		klog.V(1).Infof("slug created: %d files; %d (%d) bytes (compressed)\n", len(meta.Files), meta.Size, meta.CompressedSize)
+	g, ctx := errgroup.WithContext(ctx)
 
-		// Construct and deploy ConfigMap resource
-		return o.createConfigMap(ctx, w.Bytes(), o.runName, v1alpha1.RunDefaultConfigMapKey)
+	// Embed tarball in configmap and deploy
+	g.Go(func() error {
+		return o.createConfigMap(ctx, tarball, o.runName, v1alpha1.RunDefaultConfigMapKey)
 	})
 
 	// Construct and deploy command resource
 	g.Go(func() error {
-		run, err = o.createRun(ctx, o.runName, o.runName, isTTY, root)
+		run, err = o.createRun(ctx, o.runName, o.runName, isTTY, root, provenance)
 		return err
 	})
 
 	return run, g.Wait()
 }
 
+// buildArchive compiles a tarball of the local terraform modules, along with
+// any other paths to be uploaded, returning the tarball and the relative path
+// to the root module within it. Path args are rewritten to their path within
+// the archive.
+func (o *launcherOptions) buildArchive() ([]byte, string, error) {
+	// Construct new archive
+	arc, err := archive.NewArchive(o.path, archive.VendorModules(o.vendorModules), archive.Exclude(o.excludes...))
+	if err != nil {
+		return nil, "", err
+	}
+	defer arc.Close()
+
+	// Add local module references to archive
+	if err := arc.Walk(); err != nil {
+		return nil, "", err
+	}
+
+	// Warn of paths referenced in the config that could not be determined.
+	// With json output, stderr is reserved for events.
+	if o.output == "text" {
+		for _, w := range arc.Warnings() {
+			fmt.Fprintf(o.ErrOut, "Warning: %s; use --include to upload it\n", w)
+		}
+	}
+
+	// Add paths explicitly requested by the user
+	if err := arc.Include(o.includes...); err != nil {
+		return nil, "", err
+	}
+
+	// Add local paths referenced in terraform args, e.g.
+	// -var-file=../prod.tfvars, and rewrite them to their path within the
+	// archive. The args of the shell command are left alone because they are
+	// not necessarily paths on the client.
+	if o.command != "sh" {
+		o.args, err = rewritePathArgs(o.args, func(path string) (string, error) {
+			if err := arc.Include(path); err != nil {
+				return "", err
+			}
+			return arc.ArchivePath(path)
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Get relative path to root module within archive
+	root, err := arc.RootPath()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Compile tarball of local terraform modules
+	tarball := new(bytes.Buffer)
+	meta, err := arc.Pack(tarball)
+	if err != nil {
+		return nil, "", err
+	}
+
+	klog.V(1).Infof("slug created: %d files; %d (%d) bytes (compressed)\n", len(meta.Files), meta.Size, meta.CompressedSize)
+
+	return tarball.Bytes(), root, nil
+}
+
 func (o *launcherOptions) cleanup() {
 	if o.createdRun {
 		o.RunsClient(o.namespace).Delete(context.Background(), o.runName, metav1.DeleteOptions{})
@@ -375,11 +696,12 @@ func (o *launcherOptions) approveRun(ctx context.Context, ws *v1alpha1.Workspace
 		}
 	}
 	klog.V(1).Info("successfully approved run with workspace")
+	o.events.Emit(events.Event{Type: events.Approved})
 
 	return nil
 }
 
-func (o *launcherOptions) createRun(ctx context.Context, name, configMapName string, isTTY bool, relPathToRoot string) (*v1alpha1.Run, error) {
+func (o *launcherOptions) createRun(ctx context.Context, name, configMapName string, isTTY bool, relPathToRoot string, provenance *v1alpha1.Provenance) (*v1alpha1.Run, error) {
 	run := &v1alpha1.Run{}
 	run.SetNamespace(o.namespace)
 	run.SetName(name)
@@ -403,6 +725,8 @@ func (o *launcherOptions) createRun(ctx context.Context, name, configMapName str
 
 	run.Verbosity = o.Verbosity
 
+	run.Provenance = provenance
+
 	if o.status != nil {
 		// For testing purposes seed status
 		run.RunStatus = *o.status
@@ -439,8 +763,11 @@ func (o *launcherOptions) createConfigMap(ctx context.Context, tarball []byte, n
 	labels.SetCommonLabels(configMap)
 	// Permit filtering archives by command
 	labels.SetLabel(configMap, labels.Command(o.command))
-	// Permit filtering archives by workspace
-	labels.SetLabel(configMap, labels.Workspace(o.workspace))
+	// Permit filtering archives by workspace, unless the archive is shared by
+	// the runs of several workspaces
+	if !o.fanningOut() {
+		labels.SetLabel(configMap, labels.Workspace(o.workspace))
+	}
 	// Permit filtering etok resources by component
 	labels.SetLabel(configMap, labels.RunComponent)
 
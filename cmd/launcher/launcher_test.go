@@ -1,22 +1,33 @@
 package launcher
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
 	cmdutil "github.com/leg100/etok/cmd/util"
 	"github.com/leg100/etok/pkg/archive"
 	"github.com/leg100/etok/pkg/env"
 	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/events"
+	"github.com/leg100/etok/pkg/globals"
 	"github.com/leg100/etok/pkg/handlers"
 	"github.com/leg100/etok/pkg/logstreamer"
 	"github.com/leg100/etok/pkg/testobj"
 	"github.com/leg100/etok/pkg/testutil"
+	"github.com/leg100/etok/pkg/variables"
+	"github.com/leg100/etok/pkg/version"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
@@ -42,7 +53,9 @@ func TestLauncher(t *testing.T) {
 		// Override run status
 		overrideStatus   func(*v1alpha1.RunStatus)
 		factoryOverrides func(*cmdutil.Factory)
-		assertions       func(*launcherOptions)
+		// Setup files in working directory
+		setup      func(*testutil.T)
+		assertions func(*launcherOptions)
 	}{
 		{
 			name: "plan",
@@ -92,6 +105,69 @@ func TestLauncher(t *testing.T) {
 				assert.Equal(t, "bar", o.workspace)
 			},
 		},
+		{
+			name: "project config file",
+			objs: []runtime.Object{testobj.Workspace("foo", "bar", testobj.WithCombinedQueue("run-12345"))},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("etok.yaml", []byte("namespace: foo\nworkspace: bar\nflags:\n  reconcile-timeout: 20s\n"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Equal(t, "foo", o.namespace)
+				assert.Equal(t, "bar", o.workspace)
+				assert.Equal(t, 20*time.Second, o.reconcileTimeout)
+			},
+		},
+		{
+			name: "environment file overrides project config file",
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default", testobj.WithCombinedQueue("run-12345"))},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("etok.yaml", []byte("namespace: foo\nworkspace: bar\n"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Equal(t, "default", o.namespace)
+				assert.Equal(t, "default", o.workspace)
+			},
+		},
+		{
+			name: "flags override project config file",
+			args: []string{"--namespace", "default", "--reconcile-timeout", "5s"},
+			objs: []runtime.Object{testobj.Workspace("default", "bar", testobj.WithCombinedQueue("run-12345"))},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("etok.yaml", []byte("namespace: foo\nworkspace: bar\nflags:\n  reconcile-timeout: 20s\n"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Equal(t, "default", o.namespace)
+				assert.Equal(t, "bar", o.workspace)
+				assert.Equal(t, 5*time.Second, o.reconcileTimeout)
+			},
+		},
+		{
+			name: "project config file includes and excludes paths",
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			setup: func(t *testutil.T) {
+				require.NoError(t, os.MkdirAll("policies", 0755))
+				require.NoError(t, ioutil.WriteFile("policies/policy.json", []byte("{}"), 0644))
+				require.NoError(t, ioutil.WriteFile("terraform.tfstate.backup", []byte("{}"), 0644))
+				require.NoError(t, ioutil.WriteFile("etok.yaml", []byte("include:\n- policies\nexclude:\n- \"*.backup\"\n"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				configMap, err := o.ConfigMapsClient(o.namespace).Get(context.Background(), o.runName, metav1.GetOptions{})
+				require.NoError(t, err)
+				dst := testutil.NewTempDir(t)
+				require.NoError(t, archive.Unpack(bytes.NewReader(configMap.BinaryData[v1alpha1.RunDefaultConfigMapKey]), dst.Root()))
+				assert.FileExists(t, dst.Path("policies/policy.json"))
+				assert.NoFileExists(t, dst.Path("terraform.tfstate.backup"))
+			},
+		},
+		{
+			name: "invalid project config file",
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("etok.yaml", []byte("flags:\n  reconcile-timeout: soon\n"), 0644))
+			},
+			err: errInvalidFlagDefault,
+		},
 		{
 			name: "arbitrary terraform flag",
 			args: []string{"--", "-input", "false"},
@@ -230,6 +306,104 @@ func TestLauncher(t *testing.T) {
 				assert.False(t, run.Handshake)
 			},
 		},
+		{
+			name: "paths outside root module",
+			args: []string{"--path", "mod", "--include", "policies", "--", "-var-file=envs/prod.tfvars", "-state", "missing.tfstate"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			setup: func(t *testutil.T) {
+				require.NoError(t, os.MkdirAll("mod", 0755))
+				require.NoError(t, os.MkdirAll("envs", 0755))
+				require.NoError(t, os.MkdirAll("policies", 0755))
+				require.NoError(t, ioutil.WriteFile("mod/main.tf", []byte("# empty"), 0644))
+				require.NoError(t, ioutil.WriteFile("envs/prod.tfvars", []byte("foo = \"bar\""), 0644))
+				require.NoError(t, ioutil.WriteFile("policies/policy.json", []byte("{}"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				run, err := o.RunsClient(o.namespace).Get(context.Background(), o.runName, metav1.GetOptions{})
+				require.NoError(t, err)
+				// Paths are relative to root module within archive, and
+				// non-existent paths are left alone
+				assert.Equal(t, []string{"-var-file=../envs/prod.tfvars", "-state", "missing.tfstate"}, run.Args)
+				assert.Equal(t, "mod", run.ConfigMapPath)
+
+				// Check paths are in archive
+				configMap, err := o.ConfigMapsClient(o.namespace).Get(context.Background(), o.runName, metav1.GetOptions{})
+				require.NoError(t, err)
+				dst := testutil.NewTempDir(t)
+				require.NoError(t, archive.Unpack(bytes.NewReader(configMap.BinaryData[v1alpha1.RunDefaultConfigMapKey]), dst.Root()))
+				assert.FileExists(t, dst.Path("mod/main.tf"))
+				assert.FileExists(t, dst.Path("envs/prod.tfvars"))
+				assert.FileExists(t, dst.Path("policies/policy.json"))
+			},
+		},
+		{
+			name: "provenance",
+			args: []string{"-m", "resize vpc"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			setup: func(t *testutil.T) {
+				if _, err := exec.LookPath("git"); err != nil {
+					t.Skip("git not installed")
+				}
+				for _, args := range [][]string{
+					{"init", "--quiet"},
+					{"checkout", "--quiet", "-b", "main"},
+					{"add", "."},
+					{"-c", "user.name=etok", "-c", "user.email=etok@example.com", "commit", "--quiet", "-m", "initial commit"},
+				} {
+					require.NoError(t, exec.Command("git", args...).Run())
+				}
+				// Make working tree dirty
+				require.NoError(t, ioutil.WriteFile("main.tf", []byte("# uncommitted"), 0644))
+			},
+			assertions: func(o *launcherOptions) {
+				run, err := o.RunsClient(o.namespace).Get(context.Background(), o.runName, metav1.GetOptions{})
+				require.NoError(t, err)
+				if assert.NotNil(t, run.Provenance) {
+					assert.Len(t, run.Provenance.Commit, 40)
+					assert.Equal(t, "main", run.Provenance.Branch)
+					assert.True(t, run.Provenance.Dirty)
+					assert.Equal(t, "etok <etok@example.com>", run.Provenance.Author)
+					assert.Equal(t, "resize vpc", run.Provenance.Message)
+					assert.Regexp(t, "^sha256:[0-9a-f]{64}$", run.Provenance.ArchiveDigest)
+					assert.Equal(t, version.Version, run.Provenance.EtokVersion)
+				}
+			},
+		},
+		{
+			name: "warn of undetermined paths",
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("main.tf", []byte("locals {\n  foo = file(var.path)\n}\n"), 0644))
+			},
+			factoryOverrides: func(f *cmdutil.Factory) {
+				f.ErrOut = new(bytes.Buffer)
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Equal(t, "Warning: main.tf:2,14-22: unable to determine path referenced by file(); use --include to upload it\n", o.ErrOut.(*bytes.Buffer).String())
+			},
+		},
+		{
+			name: "detach",
+			args: []string{"--detach"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			factoryOverrides: func(f *cmdutil.Factory) {
+				// Ensure detaching overrides tty
+				var err error
+				_, f.In, err = pty.Open()
+				require.NoError(t, err)
+			},
+			assertions: func(o *launcherOptions) {
+				// Detaching prints the run name rather than connecting to
+				// the pod
+				assert.Equal(t, "run-12345\n", o.Out.(*bytes.Buffer).String())
+
+				// Get run
+				run, err := o.RunsClient(o.namespace).Get(context.Background(), o.runName, metav1.GetOptions{})
+				require.NoError(t, err)
+				// There is no client to send a handshake
+				assert.False(t, run.Handshake)
+			},
+		},
 		{
 			name: "pod completed with no tty",
 			objs: []runtime.Object{testobj.Workspace("default", "default", testobj.WithCombinedQueue("run-12345"))},
@@ -288,6 +462,107 @@ func TestLauncher(t *testing.T) {
 			},
 			err: handlers.ErrRunFailed,
 		},
+		{
+			name: "plan summary",
+			args: []string{"--summary-file", "summary.md"},
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.Plan = &v1alpha1.PlanSummary{
+					Add:     1,
+					Destroy: 1,
+					Resources: []v1alpha1.ResourceChange{
+						{Address: "random_id.a", Action: "create"},
+						{Address: "random_id.b", Action: "delete"},
+					},
+				}
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "Summary: 1 to add, 0 to change, 1 to destroy, 0 to import\n  create   random_id.a\n  delete   random_id.b\n")
+
+				summary, err := ioutil.ReadFile("summary.md")
+				require.NoError(t, err)
+				assert.Equal(t, "#### Plan: 1 to add, 0 to change, 1 to destroy, 0 to import\n\n| Action | Resource |\n| ------ | -------- |\n| create | `random_id.a` |\n| delete | `random_id.b` |\n", string(summary))
+			},
+		},
+		{
+			name: "plan with no changes",
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			overrideStatus: func(status *v1alpha1.RunStatus) {
+				status.Plan = &v1alpha1.PlanSummary{}
+			},
+			assertions: func(o *launcherOptions) {
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "Summary: no changes\n")
+			},
+		},
+		{
+			name: "json output",
+			cmd:  "init",
+			args: []string{"--output", "json"},
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default", testobj.WithCombinedQueue("run-12345")), testobj.ConfigMap("default", "run-12345-lockfile", testobj.WithBinaryData(globals.LockFile, []byte("hashes")))},
+			factoryOverrides: func(f *cmdutil.Factory) {
+				f.ErrOut = new(bytes.Buffer)
+			},
+			assertions: func(o *launcherOptions) {
+				var types []string
+				scanner := bufio.NewScanner(o.ErrOut.(*bytes.Buffer))
+				for scanner.Scan() {
+					var ev events.Event
+					require.NoError(t, json.Unmarshal(scanner.Bytes(), &ev))
+					assert.Equal(t, "run-12345", ev.Run)
+					types = append(types, string(ev.Type))
+				}
+				assert.Subset(t, types, []string{"created", "reconciled", "running", "log", "completed", "lockFileWritten"})
+				assert.Equal(t, "completed", types[len(types)-2])
+				assert.Equal(t, "lockFileWritten", types[len(types)-1])
+			},
+		},
+		{
+			name: "invalid variable",
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default", testobj.WithVariables("zones", "a,b"))},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("variables.tf", []byte("variable \"zones\" {\n  type = list(string)\n}\n"), 0644))
+			},
+			err: variables.ErrInvalidValue,
+			assertions: func(o *launcherOptions) {
+				// Run is not created
+				_, err := o.RunsClient("default").Get(context.Background(), "run-12345", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
+		{
+			name: "invalid variable of variable set",
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "default"),
+				testobj.VariableSet("default", "shared", v1alpha1.VariableSetSpec{
+					Workspaces: []string{"default"},
+					Variables:  []*v1alpha1.Variable{{Key: "zones", Value: "a,b"}},
+				}),
+			},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("variables.tf", []byte("variable \"zones\" {\n  type = list(string)\n}\n"), 0644))
+			},
+			err: variables.ErrInvalidValue,
+		},
+		{
+			name: "valid HCL variable",
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default", testobj.WithHCLVariables("zones", `["a", "b"]`))},
+			setup: func(t *testutil.T) {
+				require.NoError(t, ioutil.WriteFile("variables.tf", []byte("variable \"zones\" {\n  type = list(string)\n}\n"), 0644))
+			},
+		},
+		{
+			name: "invalid output",
+			args: []string{"--output", "yaml"},
+			env:  &env.Env{Namespace: "default", Workspace: "default"},
+			objs: []runtime.Object{testobj.Workspace("default", "default")},
+			err:  errInvalidOutput,
+		},
 	}
 
 	// Run tests for each command
@@ -300,6 +575,10 @@ func TestLauncher(t *testing.T) {
 				require.NoError(t, tt.env.Write(path))
 			}
 
+			if tt.setup != nil {
+				tt.setup(t)
+			}
+
 			out := new(bytes.Buffer)
 			f := cmdutil.NewFakeFactory(out, tt.objs...)
 
@@ -351,3 +630,43 @@ func TestLauncher(t *testing.T) {
 		})
 	}
 }
+
+func TestSetFlagDefaults(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		defaults map[string]interface{}
+		timeout  time.Duration
+		includes []string
+		passed   bool
+	}{
+		{
+			name:     "defaults are not deemed passed",
+			defaults: map[string]interface{}{"reconcile-timeout": "20s", "include": []interface{}{"a", "b"}},
+			timeout:  20 * time.Second,
+			includes: []string{"a", "b"},
+		},
+		{
+			name:     "flags passed take precedence",
+			args:     []string{"--reconcile-timeout", "5s"},
+			defaults: map[string]interface{}{"reconcile-timeout": "20s"},
+			timeout:  5 * time.Second,
+			passed:   true,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			opts := &launcherOptions{command: "plan"}
+			cmd := launcherCommand(cmdutil.NewFakeFactory(new(bytes.Buffer)), opts)
+			require.NoError(t, cmd.Flags().Parse(tt.args))
+
+			passed := map[string]bool{"reconcile-timeout": flags.IsFlagPassed(cmd.Flags(), "reconcile-timeout")}
+			require.NoError(t, setFlagDefaults(cmd, tt.defaults, passed))
+
+			assert.Equal(t, tt.timeout, opts.reconcileTimeout)
+			assert.Equal(t, tt.includes, opts.includes)
+			assert.Equal(t, tt.passed, flags.IsFlagPassed(cmd.Flags(), "reconcile-timeout"))
+			assert.False(t, flags.IsFlagPassed(cmd.Flags(), "include"))
+		})
+	}
+}
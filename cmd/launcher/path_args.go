@@ -0,0 +1,109 @@
+package launcher
+
+import (
+	"os"
+	"strings"
+
+	"github.com/leg100/etok/pkg/util/slice"
+)
+
+// Terraform flags that take a value, which may be passed as a separate arg
+var valueFlags = []string{
+	"-backend-config",
+	"-backup",
+	"-chdir",
+	"-config",
+	"-from-module",
+	"-lock-timeout",
+	"-lockfile",
+	"-out",
+	"-parallelism",
+	"-plugin-dir",
+	"-replace",
+	"-state",
+	"-state-out",
+	"-target",
+	"-var",
+	"-var-file",
+}
+
+// Terraform flags whose value may be a path to a local file or directory
+var pathFlags = []string{
+	"-backend-config",
+	"-backup",
+	"-config",
+	"-state",
+	"-state-out",
+	"-var-file",
+}
+
+func IsValueFlag(flag string) bool {
+	return slice.ContainsString(valueFlags, flag)
+}
+
+// rewritePathArgs detects args that are paths to existing local files or
+// directories, be they the values of flags that take a path (e.g. -var-file),
+// or positional args (e.g. the state file passed to state push). Each path is
+// passed to the rewrite func, and is replaced with the path it returns.
+func rewritePathArgs(args []string, rewrite func(string) (string, error)) ([]string, error) {
+	rewritten := make([]string, 0, len(args))
+
+	// rewriteIfExists rewrites a path only if it exists
+	rewriteIfExists := func(path string) (string, error) {
+		if _, err := os.Stat(path); err != nil {
+			return path, nil
+		}
+		return rewrite(path)
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			// Positional arg
+			path, err := rewriteIfExists(arg)
+			if err != nil {
+				return nil, err
+			}
+			rewritten = append(rewritten, path)
+			continue
+		}
+
+		// Terraform permits flags to be prefixed with either one or two
+		// dashes
+		name := "-" + strings.TrimLeft(arg, "-")
+		var value string
+		var hasValue bool
+		if parts := strings.SplitN(name, "=", 2); len(parts) == 2 {
+			name, value, hasValue = parts[0], parts[1], true
+		}
+
+		if !hasValue && IsValueFlag(name) && i+1 < len(args) {
+			// Value is passed as separate arg
+			rewritten = append(rewritten, arg)
+			i++
+			value = args[i]
+			if slice.ContainsString(pathFlags, name) {
+				var err error
+				value, err = rewriteIfExists(value)
+				if err != nil {
+					return nil, err
+				}
+			}
+			rewritten = append(rewritten, value)
+			continue
+		}
+
+		if hasValue && slice.ContainsString(pathFlags, name) {
+			path, err := rewriteIfExists(value)
+			if err != nil {
+				return nil, err
+			}
+			arg = arg[:len(arg)-len(value)] + path
+		}
+
+		rewritten = append(rewritten, arg)
+	}
+
+	return rewritten, nil
+}
@@ -0,0 +1,81 @@
+package launcher
+
+import (
+	"testing"
+
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewritePathArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		// Paths wanted to be passed to rewrite func
+		paths []string
+	}{
+		{
+			name:  "var file flag with equals",
+			args:  []string{"-var-file=prod.tfvars"},
+			want:  []string{"-var-file=archive/prod.tfvars"},
+			paths: []string{"prod.tfvars"},
+		},
+		{
+			name:  "var file flag with separate value",
+			args:  []string{"-var-file", "prod.tfvars", "-input=false"},
+			want:  []string{"-var-file", "archive/prod.tfvars", "-input=false"},
+			paths: []string{"prod.tfvars"},
+		},
+		{
+			name:  "double dash flag",
+			args:  []string{"--var-file=prod.tfvars"},
+			want:  []string{"--var-file=archive/prod.tfvars"},
+			paths: []string{"prod.tfvars"},
+		},
+		{
+			name:  "positional path",
+			args:  []string{"backup.tfstate"},
+			want:  []string{"archive/backup.tfstate"},
+			paths: []string{"backup.tfstate"},
+		},
+		{
+			name: "non-existent paths",
+			args: []string{"-var-file=missing.tfvars", "-state-out", "new.tfstate", "aws_instance.foo"},
+			want: []string{"-var-file=missing.tfvars", "-state-out", "new.tfstate", "aws_instance.foo"},
+		},
+		{
+			name: "value of non-path flag",
+			args: []string{"-var", "prod.tfvars", "-target=prod.tfvars"},
+			want: []string{"-var", "prod.tfvars", "-target=prod.tfvars"},
+		},
+		{
+			name: "plan out flag with existing file",
+			args: []string{"-out", "plan.out", "-out=plan.out"},
+			want: []string{"-out", "plan.out", "-out=plan.out"},
+		},
+		{
+			name:  "backend config",
+			args:  []string{"-backend-config=backend.hcl", "-backend-config=bucket=foo"},
+			want:  []string{"-backend-config=archive/backend.hcl", "-backend-config=bucket=foo"},
+			paths: []string{"backend.hcl"},
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			t.NewTempDir().Chdir().Touch("prod.tfvars", "backup.tfstate", "backend.hcl", "plan.out")
+
+			var paths []string
+			got, err := rewritePathArgs(tt.args, func(path string) (string, error) {
+				paths = append(paths, path)
+				return "archive/" + path, nil
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.paths, paths)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package launcher
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/util/git"
+	"github.com/leg100/etok/pkg/version"
+	"k8s.io/klog/v2"
+)
+
+// provenance records the origin of the run's config: the state of the git
+// working tree in which it is found, if any, the digest of the tarball, the
+// user's message and the version of the client.
+func (o *launcherOptions) provenance(tarball []byte) *v1alpha1.Provenance {
+	provenance := &v1alpha1.Provenance{
+		Message:       o.message,
+		ArchiveDigest: fmt.Sprintf("sha256:%x", sha256.Sum256(tarball)),
+		EtokVersion:   version.Version,
+	}
+
+	info, err := git.GetInfo(o.path)
+	if err != nil {
+		// Config need not be in a git repository, and failing to determine
+		// its state is not fatal
+		if !errors.Is(err, git.ErrNotRepo) {
+			klog.Warningf("unable to determine state of git working tree: %s", err.Error())
+		}
+		return provenance
+	}
+
+	provenance.Commit = info.Commit
+	provenance.Branch = info.Branch
+	provenance.Dirty = info.Dirty
+	provenance.Author = info.Author
+
+	return provenance
+}
@@ -0,0 +1,17 @@
+package launcher
+
+import "github.com/leg100/etok/pkg/util/slice"
+
+// Commands that read the values of terraform variables
+var readsVariables = []string{
+	"apply",
+	"console",
+	"destroy",
+	"import",
+	"plan",
+	"refresh",
+}
+
+func ReadsVariables(cmd string) bool {
+	return slice.ContainsString(readsVariables, cmd)
+}
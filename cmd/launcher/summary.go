@@ -0,0 +1,76 @@
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Commands for which the runner may record a plan summary
+var summarisesPlan = []string{
+	"apply",
+	"plan",
+}
+
+// reportPlanSummary prints the plan summary recorded in the run's status, and
+// writes it in markdown to the summary file if one is specified. It does
+// nothing if there is no summary.
+func (o *launcherOptions) reportPlanSummary(ctx context.Context) error {
+	run, err := o.RunsClient(o.namespace).Get(ctx, o.runName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if run.Plan == nil {
+		return nil
+	}
+
+	printPlanSummary(o.Out, run.Plan)
+
+	if o.summaryFile != "" {
+		if err := ioutil.WriteFile(o.summaryFile, []byte(markdownPlanSummary(run.Plan)), 0644); err != nil {
+			return fmt.Errorf("unable to write summary file: %w", err)
+		}
+		klog.V(1).Infof("Written %s", o.summaryFile)
+	}
+
+	return nil
+}
+
+func planSummaryCounts(summary *v1alpha1.PlanSummary) string {
+	return fmt.Sprintf("%d to add, %d to change, %d to destroy, %d to import", summary.Add, summary.Change, summary.Destroy, summary.Import)
+}
+
+func printPlanSummary(out io.Writer, summary *v1alpha1.PlanSummary) {
+	if !summary.HasChanges() {
+		fmt.Fprintln(out, "\nSummary: no changes")
+		return
+	}
+
+	fmt.Fprintf(out, "\nSummary: %s\n", planSummaryCounts(summary))
+	for _, rc := range summary.Resources {
+		fmt.Fprintf(out, "  %-8s %s\n", rc.Action, rc.Address)
+	}
+}
+
+// markdownPlanSummary renders the plan summary in markdown, suitable for
+// posting as a comment on a pull request
+func markdownPlanSummary(summary *v1alpha1.PlanSummary) string {
+	if !summary.HasChanges() {
+		return "#### Plan: no changes\n"
+	}
+
+	b := new(strings.Builder)
+	fmt.Fprintf(b, "#### Plan: %s\n\n", planSummaryCounts(summary))
+	b.WriteString("| Action | Resource |\n")
+	b.WriteString("| ------ | -------- |\n")
+	for _, rc := range summary.Resources {
+		fmt.Fprintf(b, "| %s | `%s` |\n", rc.Action, rc.Address)
+	}
+	return b.String()
+}
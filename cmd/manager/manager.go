@@ -13,6 +13,7 @@ import (
 	"github.com/leg100/etok/pkg/scheme"
 	"github.com/leg100/etok/pkg/version"
 	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -37,6 +38,13 @@ type ManagerOptions struct {
 	// Toggle operator leader election
 	EnableLeaderElection bool
 
+	// Namespace in which to find cluster scoped policies
+	PoliciesNamespace string
+
+	// Kinds of objects from whose fields variables may be sourced, in the
+	// form <kind>[.<group>]
+	ObjectFieldKinds []string
+
 	args []string
 }
 
@@ -78,8 +86,19 @@ func ManagerCmd(f *cmdutil.Factory) *cobra.Command {
 				return fmt.Errorf("unable to create workspace controller: %w", err)
 			}
 
+			var kinds []schema.GroupKind
+			for _, kind := range o.ObjectFieldKinds {
+				kinds = append(kinds, schema.ParseGroupKind(kind))
+			}
+
 			// Setup run ctrl with mgr
-			if err := controllers.NewRunReconciler(mgr.GetClient(), o.Image).SetupWithManager(mgr); err != nil {
+			if err := controllers.NewRunReconciler(
+				mgr.GetClient(),
+				o.Image,
+				controllers.WithPoliciesNamespace(o.PoliciesNamespace),
+				controllers.WithAPIReader(mgr.GetAPIReader()),
+				controllers.WithRESTMapper(mgr.GetRESTMapper()),
+				controllers.WithObjectFieldKinds(kinds)).SetupWithManager(mgr); err != nil {
 				return fmt.Errorf("unable to create run controller: %w", err)
 			}
 
@@ -100,6 +119,8 @@ func ManagerCmd(f *cmdutil.Factory) *cobra.Command {
 	cmd.Flags().BoolVar(&o.EnableLeaderElection, "enable-leader-election", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	cmd.Flags().StringVar(&o.PoliciesNamespace, "policies-namespace", "etok", "Namespace in which to find cluster scoped policies")
+	cmd.Flags().StringSliceVar(&o.ObjectFieldKinds, "object-field-kinds", []string{"Service"}, "Kinds of objects, in the form <kind>[.<group>], from whose fields variables may be sourced. Only namespaced kinds are permitted, and the operator must be granted permission to get them.")
 	cmd.Flags().StringVar(&o.Image, "image", version.Image, "Docker image used for both the operator and the runner")
 
 	return cmd
@@ -47,6 +47,8 @@ func RootCmd(f *cmdutil.Factory) *cobra.Command {
 	launcher.AddToRoot(cmd, f)
 	// terraform fmt
 	cmd.AddCommand(launcher.FmtCmd(&executor.Exec{IOStreams: f.IOStreams}))
+	// Attach to existing run
+	cmd.AddCommand(launcher.AttachCmd(f))
 
 	return cmd
 }
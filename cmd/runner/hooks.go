@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+// parseHooks decodes the JSON-encoded hooks passed to the runner by the
+// operator
+func parseHooks(encoded string) ([]v1alpha1.Hook, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+
+	var hooks []v1alpha1.Hook
+	if err := json.Unmarshal([]byte(encoded), &hooks); err != nil {
+		return nil, fmt.Errorf("unable to decode hooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// runHooks executes the hooks for the given phase in order, recording their
+// results in the run's status. Execution stops at the first failing hook, and
+// its error is returned.
+func (o *RunnerOptions) runHooks(ctx context.Context, phase v1alpha1.HookPhase) error {
+	var hookErr error
+	var executed bool
+
+	for _, h := range o.hooks {
+		if h.Phase != phase {
+			continue
+		}
+		executed = true
+
+		err := o.exec.Execute(ctx, []string{"sh", "-c", h.Script}, hookOutput(h.Name, o.Out))
+
+		o.hookResults = append(o.hookResults, v1alpha1.HookResult{
+			Name:     h.Name,
+			Phase:    phase,
+			ExitCode: hookExitCode(err),
+		})
+
+		if err != nil {
+			hookErr = fmt.Errorf("%s hook %s failed: %w", phase, h.Name, err)
+			break
+		}
+	}
+
+	if !executed {
+		return nil
+	}
+
+	if err := o.recordHookResults(ctx); err != nil {
+		if hookErr != nil {
+			klog.Errorf("unable to record hook results: %s", err.Error())
+			return hookErr
+		}
+		return fmt.Errorf("unable to record hook results: %w", err)
+	}
+
+	return hookErr
+}
+
+// recordHookResults updates the run's status with the results of the hooks
+// executed so far.
+func (o *RunnerOptions) recordHookResults(ctx context.Context) error {
+	if o.runName == "" {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"hooks": o.hookResults,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = o.RunsClient(o.namespace).Patch(ctx, o.runName, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// hookExitCode derives the exit code from the error returned from executing a
+// hook
+func hookExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exiterr *exec.ExitError
+	if errors.As(err, &exiterr) {
+		return exiterr.ExitCode()
+	}
+	return -1
+}
+
+// hookOutput directs a hook's stdout and stderr to the given writer, prefixing
+// each line with the name of the hook. Hooks are not interactive and receive no
+// stdin.
+func hookOutput(name string, out io.Writer) func(*exec.Cmd) {
+	return func(cmd *exec.Cmd) {
+		w := &prefixWriter{w: out, prefix: []byte(fmt.Sprintf("[%s] ", name))}
+		cmd.Stdin = nil
+		cmd.Stdout = w
+		cmd.Stderr = w
+	}
+}
+
+// prefixWriter prefixes each line written to the underlying writer
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	// Whether the last write ended part way through a line
+	midLine bool
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if !pw.midLine {
+			buf.Write(pw.prefix)
+		}
+		buf.Write(line)
+		pw.midLine = line[len(line)-1] != '\n'
+	}
+
+	if _, err := pw.w.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
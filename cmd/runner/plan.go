@@ -0,0 +1,307 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/launcher"
+	"github.com/leg100/etok/pkg/util/slice"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+)
+
+var errApplyCancelled = errors.New("apply cancelled")
+
+// savesPlan determines whether the command is executed with a saved plan,
+// which is necessary in order to export the plan in JSON.
+func (o *RunnerOptions) savesPlan() bool {
+	switch o.command {
+	case "plan":
+		return true
+	case "apply":
+		return o.policies != "" || savedPlanFile(o.args) != ""
+	default:
+		return false
+	}
+}
+
+// Flags of an apply that only apply a saved plan, rather than plan it
+var applyOnlyFlags = []string{"-auto-approve", "-backup", "-state-out"}
+
+// Flags of an apply that both plan and apply a saved plan
+var planAndApplyFlags = []string{"-compact-warnings", "-input", "-lock", "-lock-timeout", "-no-color", "-parallelism", "-state"}
+
+// executeWithSavedPlan executes a plan or apply with a saved plan, which is
+// exported in JSON, summarised, and evaluated against any policies before it
+// can be applied. Unless an apply is provided with a saved plan, the plan is
+// first saved to a file, and then applied from the file, ensuring the plan
+// that is evaluated is the plan that is applied. Applying a saved plan does not
+// prompt for approval, so unless -auto-approve is specified the user is
+// prompted once the plan has passed evaluation.
+func (o *RunnerOptions) executeWithSavedPlan(ctx context.Context) error {
+	planFile := savedPlanFile(o.args)
+
+	// Args for applying the saved plan
+	applyArgs := o.args
+
+	if o.command == "plan" || planFile == "" {
+		args := o.args
+		if o.command == "apply" {
+			args, applyArgs = splitApplyArgs(o.args)
+		}
+
+		planFile = flagValue(args, "-out")
+		if planFile == "" {
+			f, err := ioutil.TempFile("", "etok-*.tfplan")
+			if err != nil {
+				return err
+			}
+			f.Close()
+			defer os.Remove(f.Name())
+
+			planFile = f.Name()
+			args = append(args, "-out="+planFile)
+		}
+
+		if err := o.exec.Execute(ctx, prepareArgs("plan", args...)); err != nil {
+			return err
+		}
+	}
+
+	plan, err := o.showPlan(ctx, planFile)
+	if err != nil {
+		// Failing to export the plan is only fatal if it is to be evaluated
+		// against policies
+		if o.policies != "" {
+			return err
+		}
+		klog.Warningf("unable to summarize plan: %s", err.Error())
+	} else if err := o.summarizePlan(ctx, plan); err != nil {
+		// Failing to summarise the plan is not fatal
+		klog.Warningf("unable to summarize plan: %s", err.Error())
+	}
+
+	if o.policies != "" {
+		if err := o.evaluatePolicies(ctx, plan); err != nil {
+			return err
+		}
+	}
+
+	if o.command == "apply" {
+		if savedPlanFile(o.args) != "" {
+			return o.exec.Execute(ctx, prepareArgs(o.command, o.args...))
+		}
+
+		if !hasFlag(applyArgs, "-auto-approve") {
+			if err := o.approve(ctx, planFile); err != nil {
+				return err
+			}
+		}
+		applyArgs = removeFlag(applyArgs, "-auto-approve")
+
+		return o.exec.Execute(ctx, prepareArgs("apply", append(applyArgs, planFile)...))
+	}
+	return nil
+}
+
+// approve shows the saved plan and prompts the user to approve it, in the same
+// manner as terraform does for an apply without a saved plan
+func (o *RunnerOptions) approve(ctx context.Context, planFile string) error {
+	if err := o.exec.Execute(ctx, prepareArgs("show", planFile)); err != nil {
+		return err
+	}
+
+	fmt.Fprint(o.Out, "\nDo you want to perform these actions?\n  Only 'yes' will be accepted to approve.\n\n  Enter a value: ")
+
+	answer, err := bufio.NewReader(o.In).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	fmt.Fprintln(o.Out)
+
+	if strings.TrimSpace(answer) != "yes" {
+		return errApplyCancelled
+	}
+	return nil
+}
+
+// showPlan exports a saved plan in JSON
+func (o *RunnerOptions) showPlan(ctx context.Context, planFile string) ([]byte, error) {
+	var out bytes.Buffer
+	err := o.exec.Execute(ctx, prepareArgs("show", "-json", planFile), func(cmd *exec.Cmd) {
+		cmd.Stdout = &out
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to export plan: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// jsonPlan is the subset of terraform's JSON plan format needed to summarise a
+// plan
+type jsonPlan struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions   []string    `json:"actions"`
+			Importing interface{} `json:"importing"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// summarizePlan records a summary of the plan, in JSON, in the run's status
+func (o *RunnerOptions) summarizePlan(ctx context.Context, plan []byte) error {
+	summary, err := newPlanSummary(plan)
+	if err != nil {
+		return err
+	}
+
+	if o.runName == "" {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"plan": summary,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = o.RunsClient(o.namespace).Patch(ctx, o.runName, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// newPlanSummary summarises a plan in JSON. Replacing a resource counts as
+// both an addition and a destruction, as it does in terraform's own summary.
+func newPlanSummary(plan []byte) (*v1alpha1.PlanSummary, error) {
+	var p jsonPlan
+	if err := json.Unmarshal(plan, &p); err != nil {
+		return nil, fmt.Errorf("unable to decode plan: %w", err)
+	}
+
+	summary := &v1alpha1.PlanSummary{}
+	for _, rc := range p.ResourceChanges {
+		var action string
+		switch strings.Join(rc.Change.Actions, ",") {
+		case "create":
+			summary.Add++
+			action = "create"
+		case "update":
+			summary.Change++
+			action = "update"
+		case "delete":
+			summary.Destroy++
+			action = "delete"
+		case "delete,create", "create,delete":
+			summary.Add++
+			summary.Destroy++
+			action = "replace"
+		}
+
+		if rc.Change.Importing != nil {
+			summary.Import++
+			if action == "" {
+				action = "import"
+			}
+		}
+
+		if action != "" {
+			summary.Resources = append(summary.Resources, v1alpha1.ResourceChange{
+				Address: rc.Address,
+				Action:  action,
+			})
+		}
+	}
+	return summary, nil
+}
+
+// savedPlanFile returns the saved plan file passed to an apply, or an empty
+// string if there is none.
+func savedPlanFile(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	last := args[len(args)-1]
+	if strings.HasPrefix(last, "-") {
+		return ""
+	}
+	if len(args) > 1 && launcher.IsValueFlag(args[len(args)-2]) {
+		// Last arg is the value of a flag
+		return ""
+	}
+	return last
+}
+
+// flagValue returns the value of a flag, in either the form -flag=value or
+// -flag value
+func flagValue(args []string, flag string) string {
+	for i, arg := range args {
+		if strings.HasPrefix(arg, flag+"=") {
+			return strings.TrimPrefix(arg, flag+"=")
+		}
+		if arg == flag && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// splitApplyArgs splits the args of an apply into those for planning and those
+// for applying the saved plan
+func splitApplyArgs(args []string) (planArgs, applyArgs []string) {
+	for i := 0; i < len(args); i++ {
+		name := strings.SplitN(args[i], "=", 2)[0]
+
+		group := []string{args[i]}
+		if !strings.Contains(args[i], "=") && launcher.IsValueFlag(name) && i+1 < len(args) {
+			// Value is passed as separate arg
+			i++
+			group = append(group, args[i])
+		}
+
+		switch {
+		case slice.ContainsString(applyOnlyFlags, name):
+			applyArgs = append(applyArgs, group...)
+		case slice.ContainsString(planAndApplyFlags, name):
+			planArgs = append(planArgs, group...)
+			applyArgs = append(applyArgs, group...)
+		default:
+			planArgs = append(planArgs, group...)
+		}
+	}
+	return planArgs, applyArgs
+}
+
+// hasFlag determines whether the boolean flag is among the args
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == flag || arg == flag+"=true" {
+			return true
+		}
+	}
+	return false
+}
+
+// removeFlag removes a boolean flag from args
+func removeFlag(args []string, flag string) (filtered []string) {
+	for _, arg := range args {
+		if arg == flag || strings.HasPrefix(arg, flag+"=") {
+			continue
+		}
+		filtered = append(filtered, arg)
+	}
+	return filtered
+}
@@ -0,0 +1,124 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/envvars"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/executor"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewPlanSummary(t *testing.T) {
+	plan := `{"resource_changes":[
+		{"address":"random_id.a","change":{"actions":["create"]}},
+		{"address":"random_id.b","change":{"actions":["update"]}},
+		{"address":"random_id.c","change":{"actions":["delete"]}},
+		{"address":"random_id.d","change":{"actions":["delete","create"]}},
+		{"address":"random_id.e","change":{"actions":["no-op"],"importing":{"id":"abc"}}},
+		{"address":"random_id.f","change":{"actions":["no-op"]}},
+		{"address":"data.random_id.g","change":{"actions":["read"]}}
+	]}`
+
+	summary, err := newPlanSummary([]byte(plan))
+	require.NoError(t, err)
+
+	assert.Equal(t, &v1alpha1.PlanSummary{
+		Add:     2,
+		Change:  1,
+		Destroy: 2,
+		Import:  1,
+		Resources: []v1alpha1.ResourceChange{
+			{Address: "random_id.a", Action: "create"},
+			{Address: "random_id.b", Action: "update"},
+			{Address: "random_id.c", Action: "delete"},
+			{Address: "random_id.d", Action: "replace"},
+			{Address: "random_id.e", Action: "import"},
+		},
+	}, summary)
+}
+
+func TestRunnerPlanSummary(t *testing.T) {
+	testutil.Run(t, "plan summary recorded in run status", func(t *testutil.T) {
+		out := new(bytes.Buffer)
+		f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", "plan"))
+		cmd, o := RunnerCmd(f)
+		cmd.SetOut(out)
+		cmd.SetArgs([]string{"--", "-out", "plan.out"})
+
+		// Set flag via env var since that's how runner is invoked on a pod
+		t.SetEnvs(map[string]string{
+			"ETOK_NAMESPACE": "dev",
+			"ETOK_COMMAND":   "plan",
+			"ETOK_RUN_NAME":  "run-12345",
+		})
+		envvars.SetFlagsFromEnvVariables(cmd)
+
+		o.exec = &executor.FakeExecutorPlan{Plan: planWithCreation}
+
+		require.NoError(t, cmd.ExecuteContext(context.Background()))
+
+		run, err := o.RunsClient("dev").Get(context.Background(), "run-12345", metav1.GetOptions{})
+		require.NoError(t, err)
+		assert.Equal(t, &v1alpha1.PlanSummary{
+			Add:       1,
+			Resources: []v1alpha1.ResourceChange{{Address: "random_id.test", Action: "create"}},
+		}, run.Plan)
+	})
+}
+
+func TestRunnerPlanShowFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		policies bool
+		wantErr  bool
+	}{
+		{
+			name: "plan succeeds without summary",
+		},
+		{
+			name:     "plan fails when plan is to be evaluated against policies",
+			policies: true,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", "plan"))
+			cmd, o := RunnerCmd(f)
+			cmd.SetOut(out)
+			cmd.SetArgs([]string{"--", "-out", "plan.out"})
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			envs := map[string]string{
+				"ETOK_NAMESPACE": "dev",
+				"ETOK_COMMAND":   "plan",
+				"ETOK_RUN_NAME":  "run-12345",
+			}
+			if tt.policies {
+				envs["ETOK_POLICIES"] = t.NewTempDir().Root()
+			}
+			t.SetEnvs(envs)
+			envvars.SetFlagsFromEnvVariables(cmd)
+
+			o.exec = &executor.FakeExecutorPlan{ShowErr: errors.New("show failed")}
+
+			err := cmd.ExecuteContext(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
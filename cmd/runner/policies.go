@@ -0,0 +1,255 @@
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/open-policy-agent/opa/rego"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// Package in which policy rules are defined
+	policyPackage = "main"
+)
+
+// policyResult is the result of evaluating a plan against a policy
+type policyResult struct {
+	name     string
+	denials  []string
+	warnings []string
+}
+
+func (r *policyResult) reason() string {
+	switch {
+	case len(r.denials) > 0:
+		return v1alpha1.PolicyFailedReason
+	case len(r.warnings) > 0:
+		return v1alpha1.PolicyWarnedReason
+	default:
+		return v1alpha1.PolicyPassedReason
+	}
+}
+
+func (r *policyResult) condition() metav1.Condition {
+	status := metav1.ConditionTrue
+	if len(r.denials) > 0 {
+		status = metav1.ConditionFalse
+	}
+	var msgs []string
+	msgs = append(msgs, r.denials...)
+	msgs = append(msgs, r.warnings...)
+	return metav1.Condition{
+		Type:    v1alpha1.PolicyConditionType(r.name),
+		Status:  status,
+		Reason:  r.reason(),
+		Message: strings.Join(msgs, "; "),
+	}
+}
+
+// evaluatePolicies evaluates the plan, in JSON, against policies, printing and
+// recording the results. An error is returned if the plan violates a policy.
+func (o *RunnerOptions) evaluatePolicies(ctx context.Context, plan []byte) error {
+	var input interface{}
+	if err := json.Unmarshal(plan, &input); err != nil {
+		return fmt.Errorf("unable to decode plan: %w", err)
+	}
+
+	policies, err := loadPolicies(o.policies)
+	if err != nil {
+		return err
+	}
+
+	// Evaluate policies in order of name
+	var names []string
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var results []policyResult
+	var failed []string
+	for _, name := range names {
+		result, err := evaluatePolicy(ctx, name, policies[name], input)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+		o.printPolicyResult(result)
+
+		if len(result.denials) > 0 {
+			failed = append(failed, name)
+		}
+	}
+
+	if err := o.recordPolicyResults(ctx, results); err != nil {
+		return fmt.Errorf("unable to record policy results: %w", err)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("plan violates policies: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (o *RunnerOptions) printPolicyResult(result policyResult) {
+	switch result.reason() {
+	case v1alpha1.PolicyFailedReason:
+		fmt.Fprintf(o.Out, "Policy %s: fail\n", result.name)
+	case v1alpha1.PolicyWarnedReason:
+		fmt.Fprintf(o.Out, "Policy %s: warn\n", result.name)
+	default:
+		fmt.Fprintf(o.Out, "Policy %s: pass\n", result.name)
+	}
+	for _, msg := range result.denials {
+		fmt.Fprintf(o.Out, "  deny: %s\n", msg)
+	}
+	for _, msg := range result.warnings {
+		fmt.Fprintf(o.Out, "  warn: %s\n", msg)
+	}
+}
+
+// recordPolicyResults sets a condition on the run for each policy result.
+func (o *RunnerOptions) recordPolicyResults(ctx context.Context, results []policyResult) error {
+	if o.runName == "" {
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		run, err := o.RunsClient(o.namespace).Get(ctx, o.runName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, result := range results {
+			meta.SetStatusCondition(&run.Conditions, result.condition())
+		}
+
+		// Include resource version to detect conflicting updates to
+		// conditions
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"resourceVersion": run.ResourceVersion,
+			},
+			"status": map[string]interface{}{
+				"conditions": run.Conditions,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = o.RunsClient(o.namespace).Patch(ctx, o.runName, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+		return err
+	})
+}
+
+// loadPolicies loads rego modules from the policies directory, returning a map
+// of policy name to its modules, keyed by filename.
+func loadPolicies(dir string) (map[string]map[string]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read policies: %w", err)
+	}
+
+	policies := make(map[string]map[string]string)
+	for _, f := range files {
+		// Skip the hidden files and directories created by a config map
+		// volume mount
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+
+		parts := strings.SplitN(f.Name(), "_", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		policy, module := parts[0], parts[1]
+
+		src, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read policy: %w", err)
+		}
+
+		if policies[policy] == nil {
+			policies[policy] = make(map[string]string)
+		}
+		policies[policy][module] = string(src)
+	}
+	return policies, nil
+}
+
+// evaluatePolicy evaluates the deny and warn rules of a policy's modules
+// against the input.
+func evaluatePolicy(ctx context.Context, name string, modules map[string]string, input interface{}) (result policyResult, err error) {
+	result.name = name
+
+	result.denials, err = evaluateRule(ctx, "deny", modules, input)
+	if err != nil {
+		return result, fmt.Errorf("unable to evaluate policy %s: %w", name, err)
+	}
+
+	result.warnings, err = evaluateRule(ctx, "warn", modules, input)
+	if err != nil {
+		return result, fmt.Errorf("unable to evaluate policy %s: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// evaluateRule evaluates a rule in the policy package, returning its messages.
+// An undefined rule produces no messages.
+func evaluateRule(ctx context.Context, rule string, modules map[string]string, input interface{}) ([]string, error) {
+	opts := []func(*rego.Rego){
+		rego.Query(fmt.Sprintf("data.%s.%s", policyPackage, rule)),
+		rego.Input(input),
+	}
+	for filename, src := range modules {
+		opts = append(opts, rego.Module(filename, src))
+	}
+
+	rs, err := rego.New(opts...).Eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []string
+	for _, r := range rs {
+		for _, expr := range r.Expressions {
+			values, ok := expr.Value.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, v := range values {
+				msgs = append(msgs, policyMessage(v))
+			}
+		}
+	}
+	sort.Strings(msgs)
+	return msgs, nil
+}
+
+// policyMessage converts a value produced by a rule into a message. Rules
+// usually produce strings, but may produce objects with a msg field.
+func policyMessage(v interface{}) string {
+	switch msg := v.(type) {
+	case string:
+		return msg
+	case map[string]interface{}:
+		if s, ok := msg["msg"].(string); ok {
+			return s
+		}
+	}
+	encoded, _ := json.Marshal(v)
+	return string(encoded)
+}
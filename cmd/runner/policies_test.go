@@ -0,0 +1,289 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/envvars"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/executor"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	approvalPrompt = "\nDo you want to perform these actions?\n  Only 'yes' will be accepted to approve.\n\n  Enter a value: \n"
+
+	planWithDeletion = `{"resource_changes":[{"address":"random_id.test","change":{"actions":["delete"]}}]}`
+	planWithCreation = `{"resource_changes":[{"address":"random_id.test","change":{"actions":["create"]}}]}`
+
+	denyDeletions = `package main
+
+deny[msg] {
+	rc := input.resource_changes[_]
+	rc.change.actions[_] == "delete"
+	msg := sprintf("%s is deleted", [rc.address])
+}
+`
+	warnCreations = `package main
+
+warn[msg] {
+	rc := input.resource_changes[_]
+	rc.change.actions[_] == "create"
+	msg := sprintf("%s is created", [rc.address])
+}
+`
+)
+
+func TestRunnerPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+		plan    string
+		// Input from the user
+		in string
+		// Policy modules, keyed by config map key
+		policies map[string]string
+		wantErr  bool
+		// Wanted output
+		out string
+		// Wanted commands executed
+		wantArgs func(planFile string) [][]string
+		// Wanted policy condition reasons, keyed by policy name
+		wantReasons map[string]string
+	}{
+		{
+			name:    "plan violates policy",
+			command: "plan",
+			plan:    planWithDeletion,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			wantErr: true,
+			out:     "Policy deletions: fail\n  deny: random_id.test is deleted\n",
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+				}
+			},
+			wantReasons: map[string]string{
+				"deletions": v1alpha1.PolicyFailedReason,
+			},
+		},
+		{
+			name:    "plan with user-specified plan file",
+			command: "plan",
+			args:    []string{"-out", "my.plan"},
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+				"creations_warn.rego": warnCreations,
+			},
+			out: "Policy creations: warn\n  warn: random_id.test is created\nPolicy deletions: pass\n",
+			wantArgs: func(string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-out", "my.plan"},
+					{"terraform", "show", "-json", "my.plan"},
+				}
+			},
+			wantReasons: map[string]string{
+				"creations": v1alpha1.PolicyWarnedReason,
+				"deletions": v1alpha1.PolicyPassedReason,
+			},
+		},
+		{
+			name:    "apply plans then applies saved plan",
+			command: "apply",
+			args:    []string{"-auto-approve", "-var", "foo=bar"},
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			out: "Policy deletions: pass\n",
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-var", "foo=bar", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+					{"terraform", "apply", planFile},
+				}
+			},
+			wantReasons: map[string]string{
+				"deletions": v1alpha1.PolicyPassedReason,
+			},
+		},
+		{
+			name:    "apply prompts for approval of saved plan",
+			command: "apply",
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			in:  "yes\n",
+			out: "Policy deletions: pass\n" + approvalPrompt,
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+					{"terraform", "show", planFile},
+					{"terraform", "apply", planFile},
+				}
+			},
+			wantReasons: map[string]string{
+				"deletions": v1alpha1.PolicyPassedReason,
+			},
+		},
+		{
+			name:    "apply not approved",
+			command: "apply",
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			in:      "no\n",
+			wantErr: true,
+			out:     "Policy deletions: pass\n" + approvalPrompt,
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+					{"terraform", "show", planFile},
+				}
+			},
+		},
+		{
+			name:    "apply splits flags between plan and apply",
+			command: "apply",
+			args:    []string{"-auto-approve", "-backup", "backup.tfstate", "-lock=false", "-target", "random_id.test"},
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			out: "Policy deletions: pass\n",
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-lock=false", "-target", "random_id.test", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+					{"terraform", "apply", "-backup", "backup.tfstate", "-lock=false", planFile},
+				}
+			},
+		},
+		{
+			name:    "apply blocked",
+			command: "apply",
+			plan:    planWithDeletion,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			wantErr: true,
+			out:     "Policy deletions: fail\n  deny: random_id.test is deleted\n",
+			wantArgs: func(planFile string) [][]string {
+				return [][]string{
+					{"terraform", "plan", "-out=" + planFile},
+					{"terraform", "show", "-json", planFile},
+				}
+			},
+			wantReasons: map[string]string{
+				"deletions": v1alpha1.PolicyFailedReason,
+			},
+		},
+		{
+			name:    "apply saved plan",
+			command: "apply",
+			args:    []string{"my.plan"},
+			plan:    planWithCreation,
+			policies: map[string]string{
+				"deletions_deny.rego": denyDeletions,
+			},
+			out: "Policy deletions: pass\n",
+			wantArgs: func(string) [][]string {
+				return [][]string{
+					{"terraform", "show", "-json", "my.plan"},
+					{"terraform", "apply", "my.plan"},
+				}
+			},
+			wantReasons: map[string]string{
+				"deletions": v1alpha1.PolicyPassedReason,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", tt.command))
+			f.In = strings.NewReader(tt.in)
+			cmd, o := RunnerCmd(f)
+			cmd.SetOut(out)
+			cmd.SetArgs(append([]string{"--"}, tt.args...))
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			policies := t.NewTempDir()
+			for k, v := range tt.policies {
+				policies.Write(k, []byte(v))
+			}
+
+			// Set flag via env var since that's how runner is invoked on a pod
+			t.SetEnvs(map[string]string{
+				"ETOK_NAMESPACE": "dev",
+				"ETOK_COMMAND":   tt.command,
+				"ETOK_RUN_NAME":  "run-12345",
+				"ETOK_POLICIES":  policies.Root(),
+			})
+			envvars.SetFlagsFromEnvVariables(cmd)
+
+			exec := &executor.FakeExecutorPlan{Plan: tt.plan}
+			o.exec = exec
+
+			err := cmd.ExecuteContext(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.out, out.String())
+
+			// Retrieve name of temporary plan file from the args passed to
+			// terraform show
+			var planFile string
+			for _, args := range exec.Args {
+				if args[1] == "show" && args[2] == "-json" {
+					planFile = args[3]
+				}
+			}
+			// Terraform's version is retrieved once the command completes
+			wantArgs := append(tt.wantArgs(planFile), []string{"terraform", "version", "-json"})
+			assert.Equal(t, wantArgs, exec.Args)
+			if planFile != "my.plan" {
+				assert.Equal(t, "etok-", filepath.Base(planFile)[:5])
+			}
+
+			run, err := o.RunsClient("dev").Get(context.Background(), "run-12345", metav1.GetOptions{})
+			require.NoError(t, err)
+			for policy, reason := range tt.wantReasons {
+				cond := meta.FindStatusCondition(run.Conditions, v1alpha1.PolicyConditionType(policy))
+				if assert.NotNil(t, cond) {
+					assert.Equal(t, reason, cond.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestSavedPlanFile(t *testing.T) {
+	assert.Equal(t, "my.plan", savedPlanFile([]string{"-auto-approve", "my.plan"}))
+	assert.Equal(t, "", savedPlanFile([]string{"-auto-approve"}))
+	assert.Equal(t, "", savedPlanFile([]string{"-var", "foo=bar"}))
+	assert.Equal(t, "", savedPlanFile(nil))
+}
@@ -0,0 +1,114 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/gohcl"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/globals"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// lockFile is the subset of the dependency lock file needed to record the
+// providers selected
+type lockFile struct {
+	Providers []struct {
+		Address string   `hcl:"address,label"`
+		Version string   `hcl:"version"`
+		Hashes  []string `hcl:"hashes,optional"`
+		Remain  hcl.Body `hcl:",remain"`
+	} `hcl:"provider,block"`
+	Remain hcl.Body `hcl:",remain"`
+}
+
+// recordVersions records the versions of terraform and of the providers
+// selected in the lock file in the run's status.
+func (o *RunnerOptions) recordVersions(ctx context.Context) error {
+	if o.runName == "" {
+		return nil
+	}
+
+	version, err := o.terraformVersion(ctx)
+	if err != nil {
+		return err
+	}
+
+	providers, err := readLockFile(globals.LockFile)
+	if err != nil {
+		return err
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"terraformVersion": version,
+			"providers":        providers,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = o.RunsClient(o.namespace).Patch(ctx, o.runName, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// terraformVersion retrieves the version of terraform
+func (o *RunnerOptions) terraformVersion(ctx context.Context) (string, error) {
+	var out bytes.Buffer
+	err := o.exec.Execute(ctx, []string{"terraform", "version", "-json"}, func(cmd *exec.Cmd) {
+		cmd.Stdin = nil
+		cmd.Stdout = &out
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var version struct {
+		TerraformVersion string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &version); err != nil {
+		return "", fmt.Errorf("unable to decode terraform version: %w", err)
+	}
+	return version.TerraformVersion, nil
+}
+
+// readLockFile reads the providers selected in a dependency lock file. If the
+// lock file does not exist then no providers are returned.
+func readLockFile(path string) ([]v1alpha1.ProviderLock, error) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	file, diags := hclsyntax.ParseConfig(src, path, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, diags
+	}
+
+	var lf lockFile
+	if diags := gohcl.DecodeBody(file.Body, nil, &lf); diags.HasErrors() {
+		return nil, diags
+	}
+
+	var providers []v1alpha1.ProviderLock
+	for _, p := range lf.Providers {
+		providers = append(providers, v1alpha1.ProviderLock{
+			Address: p.Address,
+			Version: p.Version,
+			Hashes:  p.Hashes,
+		})
+	}
+	return providers, nil
+}
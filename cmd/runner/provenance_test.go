@@ -0,0 +1,110 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/envvars"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/executor"
+	"github.com/leg100/etok/pkg/globals"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const lockFileContents = `# This file is maintained automatically by "terraform init".
+# Manual edits may be lost in future updates.
+
+provider "registry.terraform.io/hashicorp/random" {
+  version     = "3.0.1"
+  constraints = "~> 3.0"
+  hashes = [
+    "h1:0QaSbRBgBi8vI/8IRwec1INdOqBxXbgsSFElx1O4k4g=",
+    "zh:0d4f683868324af056a9eb2b06306feef7c202c88dbbe6a4ad7517146a22fb50",
+  ]
+}
+
+provider "registry.terraform.io/hashicorp/null" {
+  version = "3.1.0"
+}
+`
+
+func TestRunnerRecordsVersions(t *testing.T) {
+	tests := []struct {
+		name string
+		// Etok command
+		command string
+		// Contents of lock file; empty means no lock file
+		lockFile  string
+		version   string
+		providers []v1alpha1.ProviderLock
+	}{
+		{
+			name:     "with lock file",
+			command:  "plan",
+			lockFile: lockFileContents,
+			version:  executor.FakeTerraformVersion,
+			providers: []v1alpha1.ProviderLock{
+				{
+					Address: "registry.terraform.io/hashicorp/random",
+					Version: "3.0.1",
+					Hashes: []string{
+						"h1:0QaSbRBgBi8vI/8IRwec1INdOqBxXbgsSFElx1O4k4g=",
+						"zh:0d4f683868324af056a9eb2b06306feef7c202c88dbbe6a4ad7517146a22fb50",
+					},
+				},
+				{
+					Address: "registry.terraform.io/hashicorp/null",
+					Version: "3.1.0",
+				},
+			},
+		},
+		{
+			name:    "without lock file",
+			command: "plan",
+			version: executor.FakeTerraformVersion,
+		},
+		{
+			name:     "not recorded for shell",
+			command:  "sh",
+			lockFile: lockFileContents,
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", tt.command))
+			cmd, o := RunnerCmd(f)
+			cmd.SetOut(out)
+			cmd.SetArgs([]string{"--", "true"})
+
+			dir := t.NewTempDir().Chdir()
+			if tt.lockFile != "" {
+				dir.Write(globals.LockFile, []byte(tt.lockFile))
+			}
+
+			// Set flag via env var since that's how runner is invoked on a pod
+			t.SetEnvs(map[string]string{
+				"ETOK_NAMESPACE": "dev",
+				"ETOK_COMMAND":   tt.command,
+				"ETOK_RUN_NAME":  "run-12345",
+			})
+			envvars.SetFlagsFromEnvVariables(cmd)
+
+			o.exec = &executor.FakeExecutorPlan{Plan: "{}"}
+
+			require.NoError(t, cmd.ExecuteContext(context.Background()))
+
+			run, err := o.RunsClient("dev").Get(context.Background(), "run-12345", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.version, run.TerraformVersion)
+			assert.Equal(t, tt.providers, run.Providers)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package runner
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -24,6 +25,7 @@ import (
 	"golang.org/x/sync/errgroup"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/klog/v2"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
@@ -51,6 +53,14 @@ type RunnerOptions struct {
 	handshake        bool
 	handshakeTimeout time.Duration
 
+	// JSON-encoded hooks
+	encodedHooks string
+	hooks        []v1alpha1.Hook
+	hookResults  []v1alpha1.HookResult
+
+	// Path to directory containing policies
+	policies string
+
 	args []string
 }
 
@@ -72,6 +82,11 @@ func RunnerCmd(opts *cmdutil.Factory) (*cobra.Command, *RunnerOptions) {
 
 			o.args = args
 
+			o.hooks, err = parseHooks(o.encodedHooks)
+			if err != nil {
+				return prefixError(err)
+			}
+
 			o.Client, err = opts.Create(o.kubeContext)
 			if err != nil {
 				return err
@@ -90,6 +105,8 @@ func RunnerCmd(opts *cmdutil.Factory) (*cobra.Command, *RunnerOptions) {
 	cmd.Flags().DurationVar(&o.handshakeTimeout, "handshake-timeout", v1alpha1.DefaultHandshakeTimeout, "Timeout waiting for handshake")
 	cmd.Flags().StringVar(&o.runName, "run-name", "", "Name of run resource")
 	cmd.Flags().StringVar(&o.command, "command", "", "Etok command to run")
+	cmd.Flags().StringVar(&o.policies, "policies", "", "Path to directory containing policies against which to evaluate plan")
+	cmd.Flags().StringVar(&o.encodedHooks, "hooks", "", "JSON-encoded hooks to execute before and after command")
 
 	return cmd, o
 }
@@ -151,8 +168,36 @@ func (o *RunnerOptions) Run(ctx context.Context) error {
 		return err
 	}
 
+	if o.handshake {
+		// Record receipt of handshake so that a client re-attaching to the
+		// TTY knows not to send it again. Failing to record it is not fatal.
+		if err := o.recordHandshake(ctx); err != nil {
+			klog.Warningf("unable to record receipt of handshake: %s", err.Error())
+		}
+	}
+
+	// Execute pre-hooks; a failing pre-hook aborts the run
+	if err := o.runHooks(ctx, v1alpha1.HookPhasePre); err != nil {
+		return err
+	}
+
 	// Execute requested command
-	if err := o.exec.Execute(ctx, prepareArgs(o.command, o.args...)); err != nil {
+	err := o.execute(ctx)
+
+	if o.command != "sh" {
+		// Record versions of terraform and providers. Failing to record
+		// them is not fatal.
+		if err := o.recordVersions(ctx); err != nil {
+			klog.Warningf("unable to record terraform and provider versions: %s", err.Error())
+		}
+	}
+
+	if err != nil {
+		// Execute on-failure hooks, but report the command's error regardless
+		// of their outcome
+		if hookErr := o.runHooks(ctx, v1alpha1.HookPhaseOnFailure); hookErr != nil {
+			klog.Errorf("%s", hookErr.Error())
+		}
 		return err
 	}
 
@@ -164,7 +209,16 @@ func (o *RunnerOptions) Run(ctx context.Context) error {
 		}
 	}
 
-	return nil
+	// Execute post-hooks
+	return o.runHooks(ctx, v1alpha1.HookPhasePost)
+}
+
+// execute executes the requested command, with a saved plan if necessary.
+func (o *RunnerOptions) execute(ctx context.Context) error {
+	if o.savesPlan() {
+		return o.executeWithSavedPlan(ctx)
+	}
+	return o.exec.Execute(ctx, prepareArgs(o.command, o.args...))
 }
 
 // persistLockFile persists the lock file .terraform.lock.hcl to a config map.
@@ -281,6 +335,26 @@ func (o *RunnerOptions) receiveHandshake(ctx context.Context) error {
 	return nil
 }
 
+// recordHandshake updates the run's status to indicate the handshake has been
+// received.
+func (o *RunnerOptions) recordHandshake(ctx context.Context) error {
+	if o.runName == "" {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": map[string]interface{}{
+			"handshakeReceived": true,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = o.RunsClient(o.namespace).Patch(ctx, o.runName, types.MergePatchType, patch, metav1.PatchOptions{}, "status")
+	return err
+}
+
 var (
 	errIncorrectHandshake = errors.New("incorrect handshake received")
 	errHandshakeTimeout   = errors.New("timed out awaiting handshake")
@@ -19,6 +19,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/creack/pty"
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/cmd/envvars"
 	cmdutil "github.com/leg100/etok/cmd/util"
 	"github.com/leg100/etok/pkg/executor"
@@ -81,7 +82,8 @@ func TestRunnerCommand(t *testing.T) {
 
 		require.NoError(t, cmd.ExecuteContext(context.Background()))
 
-		want := "[terraform plan -out plan.out]"
+		// Saved plan is exported in order to summarise it
+		want := "[terraform plan -out plan.out][terraform show -json plan.out]"
 		assert.Equal(t, want, strings.TrimSpace(out.String()))
 	})
 
@@ -101,7 +103,8 @@ func TestRunnerCommand(t *testing.T) {
 
 		require.NoError(t, cmd.ExecuteContext(context.Background()))
 
-		want := "[terraform plan -out plan.out]"
+		// Saved plan is exported in order to summarise it
+		want := "[terraform plan -out plan.out][terraform show -json plan.out]"
 		assert.Equal(t, want, strings.TrimSpace(out.String()))
 	})
 
@@ -121,7 +124,8 @@ func TestRunnerCommand(t *testing.T) {
 
 		require.NoError(t, cmd.ExecuteContext(context.Background()))
 
-		want := "[terraform plan -out plan.out]"
+		// Saved plan is exported in order to summarise it
+		want := "[terraform plan -out plan.out][terraform show -json plan.out]"
 		assert.Equal(t, want, strings.TrimSpace(out.String()))
 	})
 
@@ -194,6 +198,8 @@ func TestRunnerHandshake(t *testing.T) {
 		envs map[string]string
 		err  error
 		in   io.Reader
+		// Want receipt of handshake recorded in run status
+		received bool
 	}{
 		{
 			name: "handshake",
@@ -204,6 +210,17 @@ func TestRunnerHandshake(t *testing.T) {
 			},
 			in: bytes.NewBufferString("opensesame\n"),
 		},
+		{
+			name: "record handshake",
+			envs: map[string]string{
+				"ETOK_NAMESPACE": "dev",
+				"ETOK_HANDSHAKE": "true",
+				"ETOK_COMMAND":   "sh",
+				"ETOK_RUN_NAME":  "run-12345",
+			},
+			in:       bytes.NewBufferString("opensesame\n"),
+			received: true,
+		},
 		{
 			name: "bad handshake",
 			envs: map[string]string{
@@ -228,8 +245,13 @@ func TestRunnerHandshake(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testutil.Run(t, "handshake", func(t *testutil.T) {
-			_, cmd, opts := setupRunnerCmd(t)
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", "sh"))
+			cmd, opts := RunnerCmd(f)
+			cmd.SetOut(out)
+
+			t.NewTempDir().Chdir()
 
 			// Set flag via env var since that's how runner is invoked on a pod
 			t.SetEnvs(tt.envs)
@@ -254,6 +276,91 @@ func TestRunnerHandshake(t *testing.T) {
 
 			// Look for wanted error in returned error chain
 			assert.True(t, errors.Is(cmd.ExecuteContext(context.Background()), tt.err))
+
+			run, err := opts.RunsClient("dev").Get(context.Background(), "run-12345", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.received, run.HandshakeReceived)
+		})
+	}
+}
+
+func TestRunnerHooks(t *testing.T) {
+	tests := []struct {
+		name string
+		// Shell command to run
+		script string
+		hooks  string
+		// Wanted output
+		out         string
+		wantErr     bool
+		wantResults []v1alpha1.HookResult
+	}{
+		{
+			name:   "pre and post hooks",
+			script: "echo foo",
+			hooks:  `[{"name":"lint","phase":"pre","script":"echo linting"},{"name":"notify","phase":"post","script":"echo notifying"}]`,
+			out:    "[lint] linting\nfoo\n[notify] notifying\n",
+			wantResults: []v1alpha1.HookResult{
+				{Name: "lint", Phase: v1alpha1.HookPhasePre, ExitCode: 0},
+				{Name: "notify", Phase: v1alpha1.HookPhasePost, ExitCode: 0},
+			},
+		},
+		{
+			name:    "failing pre hook aborts run",
+			script:  "echo foo",
+			hooks:   `[{"name":"fmt","phase":"pre","script":"echo unformatted; exit 3"},{"name":"notify","phase":"post","script":"echo notifying"}]`,
+			out:     "[fmt] unformatted\n",
+			wantErr: true,
+			wantResults: []v1alpha1.HookResult{
+				{Name: "fmt", Phase: v1alpha1.HookPhasePre, ExitCode: 3},
+			},
+		},
+		{
+			name:    "on-failure hook",
+			script:  "exit 1",
+			hooks:   `[{"name":"notify","phase":"post","script":"echo notifying"},{"name":"cleanup","phase":"on-failure","script":"echo cleaning up"}]`,
+			out:     "[cleanup] cleaning up\n",
+			wantErr: true,
+			wantResults: []v1alpha1.HookResult{
+				{Name: "cleanup", Phase: v1alpha1.HookPhaseOnFailure, ExitCode: 0},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, testobj.Run("dev", "run-12345", "sh"))
+			cmd, o := RunnerCmd(f)
+			cmd.SetOut(out)
+			cmd.SetArgs([]string{"--", tt.script})
+			// Only check output of hooks and command
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			t.NewTempDir().Chdir()
+
+			// Set flag via env var since that's how runner is invoked on a pod
+			t.SetEnvs(map[string]string{
+				"ETOK_NAMESPACE": "dev",
+				"ETOK_COMMAND":   "sh",
+				"ETOK_RUN_NAME":  "run-12345",
+				"ETOK_HOOKS":     tt.hooks,
+			})
+			envvars.SetFlagsFromEnvVariables(cmd)
+
+			err := cmd.ExecuteContext(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.out, out.String())
+
+			run, err := o.RunsClient("dev").Get(context.Background(), "run-12345", metav1.GetOptions{})
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantResults, run.Hooks)
 		})
 	}
 }
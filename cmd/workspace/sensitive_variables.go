@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"context"
+	"sort"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/labels"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// writeSensitiveVariables writes the values of sensitive variables to the
+// workspace's variables secret, creating the secret if it does not exist.
+// Existing values of other keys are left alone. The operator makes the
+// workspace the owner of the secret, so that it is deleted along with the
+// workspace. Returns true if the secret was created.
+func writeSensitiveVariables(ctx context.Context, cl *client.Client, namespace, workspace string, values map[string]string) (created bool, err error) {
+	secrets := cl.SecretsClient(namespace)
+	name := v1alpha1.WorkspaceVariablesSecretName(workspace)
+
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			secret = &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: namespace,
+				},
+				Data: make(map[string][]byte, len(values)),
+			}
+			// Set etok's common labels
+			labels.SetCommonLabels(secret)
+			// Permit filtering secrets by workspace
+			labels.SetLabel(secret, labels.Workspace(workspace))
+			// Permit filtering etok resources by component
+			labels.SetLabel(secret, labels.WorkspaceComponent)
+
+			for k, v := range values {
+				secret.Data[k] = []byte(v)
+			}
+			if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+				return err
+			}
+			created = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte, len(values))
+		}
+		for k, v := range values {
+			secret.Data[k] = []byte(v)
+		}
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+	return created, err
+}
+
+// deleteSensitiveVariables deletes the values of sensitive variables from the
+// workspace's variables secret
+func deleteSensitiveVariables(ctx context.Context, cl *client.Client, namespace, workspace string, keys []string) error {
+	secrets := cl.SecretsClient(namespace)
+	name := v1alpha1.WorkspaceVariablesSecretName(workspace)
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var deleted bool
+		for _, k := range keys {
+			if _, ok := secret.Data[k]; ok {
+				delete(secret.Data, k)
+				deleted = true
+			}
+		}
+		if !deleted {
+			return nil
+		}
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// sensitiveVariables returns terraform variables whose values are sourced from
+// the workspace's variables secret, in order of key
+func sensitiveVariables(workspace string, values map[string]string) []*v1alpha1.Variable {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	vars := make([]*v1alpha1.Variable, 0, len(keys))
+	for _, k := range keys {
+		vars = append(vars, &v1alpha1.Variable{
+			Key: k,
+			ValueFrom: &v1alpha1.VariableSource{
+				EnvVarSource: corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: v1alpha1.WorkspaceVariablesSecretName(workspace)},
+						Key:                  k,
+					},
+				},
+			},
+		})
+	}
+	return vars
+}
+
+// isSensitive determines whether the variable's value is sourced from the
+// workspace's variables secret
+func isSensitive(workspace string, v *v1alpha1.Variable) bool {
+	return v.ValueFrom != nil && v.ValueFrom.SecretKeyRef != nil && v.ValueFrom.SecretKeyRef.Name == v1alpha1.WorkspaceVariablesSecretName(workspace)
+}
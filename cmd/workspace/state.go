@@ -0,0 +1,116 @@
+package workspace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Version of the state file format supported by the kubernetes backend
+	// of the terraform versions etok supports
+	supportedStateVersion = 4
+
+	// Key of the state secret containing the gzipped state file
+	stateSecretKey = "tfstate"
+
+	// Labels set by terraform's kubernetes backend on a state secret. The
+	// backend finds a secret by these labels, so they must be set on a state
+	// secret created by etok.
+	stateLabel             = "tfstate"
+	stateWorkspaceLabel    = "tfstateWorkspace"
+	stateSecretSuffixLabel = "tfstateSecretSuffix"
+	stateManagedByLabel    = "app.kubernetes.io/managed-by"
+)
+
+var (
+	errInvalidState            = errors.New("invalid state file")
+	errUnsupportedStateVersion = errors.New("unsupported state file version")
+	errMissingLineage          = errors.New("state file has no lineage")
+	errMissingSerial           = errors.New("state file has no serial number")
+	errNoState                 = errors.New("backend has no state")
+)
+
+// tfstate is the subset of a terraform state file required to validate it and
+// report its contents
+type tfstate struct {
+	Version   int               `json:"version"`
+	Serial    *int              `json:"serial"`
+	Lineage   string            `json:"lineage"`
+	Resources []tfstateResource `json:"resources"`
+}
+
+type tfstateResource struct {
+	Module string `json:"module"`
+	Mode   string `json:"mode"`
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+}
+
+// Address returns the address of the resource, e.g. module.vpc.aws_vpc.main
+func (r tfstateResource) Address() string {
+	var parts []string
+	if r.Module != "" {
+		parts = append(parts, r.Module)
+	}
+	if r.Mode == "data" {
+		parts = append(parts, "data")
+	}
+	parts = append(parts, r.Type, r.Name)
+	return strings.Join(parts, ".")
+}
+
+// parseState parses and validates a state file
+func parseState(data []byte) (*tfstate, error) {
+	var state tfstate
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidState, err.Error())
+	}
+	if state.Version != supportedStateVersion {
+		return nil, fmt.Errorf("%w: %d (expected %d)", errUnsupportedStateVersion, state.Version, supportedStateVersion)
+	}
+	if state.Lineage == "" {
+		return nil, errMissingLineage
+	}
+	if state.Serial == nil {
+		return nil, errMissingSerial
+	}
+	return &state, nil
+}
+
+// newStateSecret constructs a workspace's state secret in the format of
+// terraform's kubernetes backend, containing the gzipped state file
+func newStateSecret(ws *v1alpha1.Workspace, data []byte) (*corev1.Secret, error) {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ws.StateSecretName(),
+			Namespace: ws.Namespace,
+			Labels: map[string]string{
+				stateLabel:             "true",
+				stateWorkspaceLabel:    "default",
+				stateSecretSuffixLabel: ws.Name,
+				stateManagedByLabel:    "terraform",
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			stateSecretKey: buf.Bytes(),
+		},
+	}, nil
+}
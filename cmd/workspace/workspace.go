@@ -23,8 +23,27 @@ func WorkspaceCmd(f *cmdutil.Factory) *cobra.Command {
 	nc, _ := newCmd(f)
 	cmd.AddCommand(nc)
 
+	uc, _ := updateCmd(f)
+	cmd.AddCommand(uc)
+
+	sc, _ := setSensitiveCmd(f)
+	cmd.AddCommand(sc)
+
+	cc, _ := copyCmd(f)
+	cmd.AddCommand(cc)
+
+	mc, _ := moveCmd(f)
+	cmd.AddCommand(mc)
+
+	ec, _ := exportCmd(f)
+	cmd.AddCommand(ec)
+
+	ic, _ := importCmd(f)
+	cmd.AddCommand(ic)
+
 	cmd.AddCommand(
 		listCmd(f),
+		describeCmd(f),
 		deleteCmd(f),
 		showCmd(f),
 		selectCmd(f),
@@ -0,0 +1,435 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/handlers"
+	"github.com/leg100/etok/pkg/k8s"
+	"github.com/leg100/etok/pkg/labels"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/klog/v2"
+)
+
+var (
+	errInvalidWorkspaceRef = errors.New("invalid workspace, expecting [<namespace>/]<workspace>")
+	errSameWorkspace       = errors.New("source and destination are the same workspace")
+	errWorkspaceExists     = errors.New("destination workspace already exists")
+	errStateExists         = errors.New("destination state already exists")
+	errWorkspaceBusy       = errors.New("source workspace has an active run")
+	errSerialUnknown       = errors.New("source workspace has yet to report the serial number of its state")
+	errSerialTimeout       = errors.New("timed out waiting for destination workspace to report the serial number of its state")
+	errSourceChanged       = errors.New("source workspace changed during move")
+)
+
+type copyOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	path        string
+	namespace   string
+	kubeContext string
+
+	// Source and destination workspaces
+	src, dst *env.Env
+
+	// Delete the source workspace once copied
+	deleteSource bool
+
+	// Timeout for destination workspace to be ready and to report the serial
+	// number of its state
+	timeout time.Duration
+
+	// Disable default behaviour of deleting resources upon error
+	disableResourceCleanup bool
+
+	// Recall which resources are created so that if an error occurs they can
+	// be cleaned up. The name of the state secret is recorded.
+	createdWorkspace bool
+	createdState     string
+	createdVariables bool
+
+	// Recall whether the source workspace's queue was blocked, so that it can
+	// be unblocked if an error occurs
+	blockedQueue bool
+
+	// For testing purposes set destination workspace status
+	status *v1alpha1.WorkspaceStatus
+}
+
+func copyCmd(f *cmdutil.Factory) (*cobra.Command, *copyOptions) {
+	o := &copyOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "copy <source> [<namespace>/]<destination>",
+		Short: "Copy an etok workspace",
+		Long:  "Copy an etok workspace, along with its state, to a new workspace, optionally in another namespace. The source workspace is left intact.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runE(cmd.Context(), args)
+		},
+	}
+	o.addFlags(cmd)
+
+	return cmd, o
+}
+
+func (o *copyOptions) addFlags(cmd *cobra.Command) {
+	flags.AddPathFlag(cmd, &o.path)
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+	flags.AddDisableResourceCleanupFlag(cmd, &o.disableResourceCleanup)
+
+	cmd.Flags().DurationVar(&o.timeout, "timeout", defaultReadyTimeout, "timeout for destination workspace to be ready with a copy of the state")
+}
+
+// runE parses the source and destination workspaces and performs the copy,
+// cleaning up upon error
+func (o *copyOptions) runE(ctx context.Context, args []string) (err error) {
+	o.src, err = parseWorkspaceRef(args[0], o.namespace)
+	if err != nil {
+		return err
+	}
+	// Destination defaults to the namespace of the source
+	o.dst, err = parseWorkspaceRef(args[1], o.src.Namespace)
+	if err != nil {
+		return err
+	}
+	if *o.src == *o.dst {
+		return errSameWorkspace
+	}
+
+	o.Client, err = o.Create(o.kubeContext)
+	if err != nil {
+		return err
+	}
+
+	if err := o.run(ctx); err != nil {
+		if !o.disableResourceCleanup {
+			o.cleanup()
+		}
+		return err
+	}
+	return nil
+}
+
+func (o *copyOptions) run(ctx context.Context) error {
+	src, err := o.WorkspacesClient(o.src.Namespace).Get(ctx, o.src.Workspace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get source workspace: %w", err)
+	}
+	// Refuse to copy state that may be in the midst of being changed
+	if src.Status.Active != "" {
+		return fmt.Errorf("%w: %s", errWorkspaceBusy, src.Status.Active)
+	}
+
+	_, err = o.WorkspacesClient(o.dst.Namespace).Get(ctx, o.dst.Workspace, metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("%w: %s", errWorkspaceExists, o.dst)
+	} else if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	if o.deleteSource {
+		// Prevent runs from changing the source's state for the duration of
+		// the move
+		if err := setQueueBlocked(ctx, o.Client, src.Namespace, src.Name, true); err != nil {
+			return fmt.Errorf("unable to block queue of source workspace: %w", err)
+		}
+		o.blockedQueue = true
+	}
+
+	dst := destinationWorkspace(src, o.dst)
+
+	// Migrate state before creating the destination workspace, so that the
+	// workspace finds its state when it is first reconciled
+	serial, stateVersion, err := o.copyState(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+
+	if err := o.copySensitiveVariables(ctx, src, dst); err != nil {
+		return err
+	}
+
+	if o.status != nil {
+		// For testing purposes seed workspace status
+		dst.Status = *o.status
+	}
+
+	dst, err = o.WorkspacesClient(dst.Namespace).Create(ctx, dst, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	o.createdWorkspace = true
+	fmt.Fprintf(o.Out, "Created workspace %s\n", klog.KObj(dst))
+
+	fmt.Fprintln(o.Out, "Waiting for workspace to be ready...")
+	if err := o.wait(ctx, dst, handlers.WorkspaceReady(), errReadyTimeout); err != nil {
+		return err
+	}
+
+	if serial != nil {
+		// Verify the destination workspace has picked up the state
+		if err := o.wait(ctx, dst, handlers.WorkspaceSerial(*serial), errSerialTimeout); err != nil {
+			return err
+		}
+		fmt.Fprintf(o.Out, "Copied state #%d\n", *serial)
+	}
+
+	if !o.deleteSource {
+		fmt.Fprintf(o.Out, "Copied workspace %s to %s\n", o.src, o.dst)
+		return nil
+	}
+
+	// Refuse to delete the source if its state may have changed since it was
+	// copied
+	if err := o.verifySource(ctx, serial, stateVersion); err != nil {
+		return err
+	}
+
+	// The resources recorded in the source's state now belong to the
+	// destination, so force deletion of the source regardless of its deletion
+	// policy, lest it destroy them
+	if err := forceDeletion(ctx, o.Client, src.Namespace, src.Name); err != nil {
+		return fmt.Errorf("unable to force deletion of source workspace: %w", err)
+	}
+
+	if err := o.WorkspacesClient(src.Namespace).Delete(ctx, src.Name, metav1.DeleteOptions{}); err != nil {
+		return fmt.Errorf("unable to delete source workspace: %w", err)
+	}
+	fmt.Fprintf(o.Out, "Moved workspace %s to %s\n", o.src, o.dst)
+
+	return o.updateEnvironmentFile()
+}
+
+// copyState copies the source workspace's state secret to the destination
+// workspace, returning the serial number of the state and the resource version
+// of the secret. Nil is returned if the source workspace has no state.
+func (o *copyOptions) copyState(ctx context.Context, src, dst *v1alpha1.Workspace) (*int, string, error) {
+	secret, err := o.SecretsClient(src.Namespace).Get(ctx, src.StateSecretName(), metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		klog.V(1).Infof("source workspace %s has no state to copy", klog.KObj(src))
+		return nil, "", nil
+	} else if err != nil {
+		return nil, "", fmt.Errorf("unable to get source state: %w", err)
+	}
+
+	// The serial is reported by the operator once it has read the state
+	if src.Status.Serial == nil {
+		return nil, "", errSerialUnknown
+	}
+
+	// Rewrite the state secret's labels for the destination workspace's
+	// backend config
+	stateLabels := make(map[string]string, len(secret.Labels))
+	for k, v := range secret.Labels {
+		stateLabels[k] = v
+	}
+	stateLabels[stateSecretSuffixLabel] = dst.Name
+
+	copied := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        dst.StateSecretName(),
+			Namespace:   dst.Namespace,
+			Labels:      stateLabels,
+			Annotations: secret.Annotations,
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+
+	if _, err := o.SecretsClient(dst.Namespace).Create(ctx, copied, metav1.CreateOptions{}); err != nil {
+		if kerrors.IsAlreadyExists(err) {
+			return nil, "", fmt.Errorf("%w: %s", errStateExists, klog.KObj(copied))
+		}
+		return nil, "", fmt.Errorf("unable to create destination state: %w", err)
+	}
+	o.createdState = copied.Name
+
+	return src.Status.Serial, secret.ResourceVersion, nil
+}
+
+// verifySource re-fetches the source workspace and its state, returning
+// errSourceChanged if it has an active run, or if its state has changed since
+// it was copied, as identified by the serial number of the state and the
+// resource version of the state secret.
+func (o *copyOptions) verifySource(ctx context.Context, serial *int, stateVersion string) error {
+	src, err := o.WorkspacesClient(o.src.Namespace).Get(ctx, o.src.Workspace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get source workspace: %w", err)
+	}
+	if src.Status.Active != "" {
+		return fmt.Errorf("%w: run %s is active", errSourceChanged, src.Status.Active)
+	}
+	if serial != nil && (src.Status.Serial == nil || *src.Status.Serial != *serial) {
+		return fmt.Errorf("%w: state serial number is no longer %d", errSourceChanged, *serial)
+	}
+
+	secret, err := o.SecretsClient(src.Namespace).Get(ctx, src.StateSecretName(), metav1.GetOptions{})
+	switch {
+	case kerrors.IsNotFound(err):
+		if stateVersion != "" {
+			return fmt.Errorf("%w: state has been deleted", errSourceChanged)
+		}
+	case err != nil:
+		return fmt.Errorf("unable to get source state: %w", err)
+	case serial == nil:
+		return fmt.Errorf("%w: state has been created", errSourceChanged)
+	case secret.ResourceVersion != stateVersion:
+		return fmt.Errorf("%w: state has been updated", errSourceChanged)
+	}
+	return nil
+}
+
+// copySensitiveVariables copies the values of the source workspace's sensitive
+// variables to the destination workspace's variables secret
+func (o *copyOptions) copySensitiveVariables(ctx context.Context, src, dst *v1alpha1.Workspace) error {
+	secret, err := o.SecretsClient(src.Namespace).Get(ctx, src.VariablesSecretName(), metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("unable to get source sensitive variables: %w", err)
+	}
+
+	values := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		values[k] = string(v)
+	}
+
+	o.createdVariables, err = writeSensitiveVariables(ctx, o.Client, dst.Namespace, dst.Name, values)
+	if err != nil {
+		return fmt.Errorf("unable to copy sensitive variables: %w", err)
+	}
+	return nil
+}
+
+// wait waits for the destination workspace to satisfy the handler, returning
+// timeoutErr if it does not do so within the timeout
+func (o *copyOptions) wait(ctx context.Context, ws *v1alpha1.Workspace, hdlr watchtools.ConditionFunc, timeoutErr error) error {
+	lw := &k8s.WorkspaceListWatcher{Client: o.EtokClient, Name: ws.Name, Namespace: ws.Namespace}
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+
+	_, err := watchtools.UntilWithSync(ctx, lw, &v1alpha1.Workspace{}, nil, hdlr)
+	if err != nil {
+		if errors.Is(err, wait.ErrWaitTimeout) {
+			return timeoutErr
+		}
+		return err
+	}
+	return nil
+}
+
+// updateEnvironmentFile selects the destination workspace if the source
+// workspace is currently selected
+func (o *copyOptions) updateEnvironmentFile() error {
+	etokenv, err := env.Read(o.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if *etokenv != *o.src {
+		return nil
+	}
+	if err := o.dst.Write(o.path); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.Out, "Current workspace now: %s\n", o.dst)
+	return nil
+}
+
+func (o *copyOptions) cleanup() {
+	if o.createdWorkspace {
+		o.WorkspacesClient(o.dst.Namespace).Delete(context.Background(), o.dst.Workspace, metav1.DeleteOptions{})
+	}
+	if o.createdState != "" {
+		o.SecretsClient(o.dst.Namespace).Delete(context.Background(), o.createdState, metav1.DeleteOptions{})
+	}
+	if o.createdVariables {
+		o.SecretsClient(o.dst.Namespace).Delete(context.Background(), v1alpha1.WorkspaceVariablesSecretName(o.dst.Workspace), metav1.DeleteOptions{})
+	}
+	if o.blockedQueue {
+		setQueueBlocked(context.Background(), o.Client, o.src.Namespace, o.src.Workspace, false)
+	}
+}
+
+// setQueueBlocked annotates a workspace to block its queue, or removes the
+// annotation to unblock it
+func setQueueBlocked(ctx context.Context, cl *client.Client, namespace, workspace string, blocked bool) error {
+	value := "null"
+	if blocked {
+		value = `"true"`
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%s}}}`, v1alpha1.QueueBlockedAnnotationKey, value)
+	_, err := cl.WorkspacesClient(namespace).Patch(ctx, workspace, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// destinationWorkspace constructs a copy of the source workspace, with the
+// name and namespace of the destination
+func destinationWorkspace(src *v1alpha1.Workspace, dst *env.Env) *v1alpha1.Workspace {
+	ws := &v1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      dst.Workspace,
+			Namespace: dst.Namespace,
+			// Carry across the user's labels
+			Labels: make(map[string]string, len(src.Labels)),
+		},
+		Spec: *src.Spec.DeepCopy(),
+	}
+	for k, v := range src.Labels {
+		ws.Labels[k] = v
+	}
+
+	// Reference the destination's copy of the values of sensitive variables
+	for _, v := range ws.Spec.Variables {
+		if isSensitive(src.Name, v) {
+			v.ValueFrom.SecretKeyRef.Name = ws.VariablesSecretName()
+		}
+	}
+
+	// Set etok's common labels
+	labels.SetCommonLabels(ws)
+	// Permit filtering secrets by workspace
+	labels.SetLabel(ws, labels.Workspace(dst.Workspace))
+	// Permit filtering etok resources by component
+	labels.SetLabel(ws, labels.WorkspaceComponent)
+
+	return ws
+}
+
+// parseWorkspaceRef parses a reference to a workspace in the form
+// [<namespace>/]<workspace>, returning the namespace and workspace. The
+// namespace is set to namespace if not specified.
+func parseWorkspaceRef(ref, namespace string) (*env.Env, error) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return env.New(namespace, parts[0])
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return env.New(parts[0], parts[1])
+	}
+	return nil, fmt.Errorf("%w: %s", errInvalidWorkspaceRef, ref)
+}
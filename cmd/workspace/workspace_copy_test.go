@@ -0,0 +1,409 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestCopyWorkspace(t *testing.T) {
+	// State secret as created by terraform's kubernetes backend
+	state := func(namespace, workspace string) runtime.Object {
+		secret := testobj.Secret(namespace, "tfstate-default-"+workspace, testobj.WithData("tfstate", "state"))
+		secret.Labels = map[string]string{
+			"app.kubernetes.io/managed-by": "terraform",
+			"tfstate":                      "true",
+			"tfstateSecretSuffix":          workspace,
+			"tfstateWorkspace":             "default",
+		}
+		return secret
+	}
+
+	tests := []struct {
+		name string
+		// Construct move command rather than copy command
+		move           bool
+		args           []string
+		objs           []runtime.Object
+		env            *env.Env
+		overrideStatus func(*v1alpha1.WorkspaceStatus)
+		// Report an active run on the source workspace when it is next
+		// retrieved after this many retrievals
+		activeAfter int
+		err         error
+		assertions  func(*testutil.T, *copyOptions)
+	}{
+		{
+			name: "copy",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithSerial(3), testobj.WithVariables("region", "eu"), testobj.WithLabels("env", "prod")),
+				state("default", "foo"),
+			},
+			overrideStatus: func(status *v1alpha1.WorkspaceStatus) {
+				serial := 3
+				status.Serial = &serial
+			},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				ws, err := o.WorkspacesClient("default").Get(context.Background(), "bar", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []*v1alpha1.Variable{{Key: "region", Value: "eu"}}, ws.Spec.Variables)
+				assert.Equal(t, "prod", ws.Labels["env"])
+				assert.Equal(t, "bar", ws.Labels["workspace"])
+
+				secret, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-bar", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "bar", secret.Labels["tfstateSecretSuffix"])
+				assert.Equal(t, "true", secret.Labels["tfstate"])
+				assert.Equal(t, []byte("state"), secret.Data["tfstate"])
+
+				// Source is left intact
+				_, err = o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "Copied workspace default/foo to default/bar\n")
+			},
+		},
+		{
+			name: "copy to another namespace",
+			args: []string{"foo", "dev/bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithSerial(3)),
+				state("default", "foo"),
+			},
+			overrideStatus: func(status *v1alpha1.WorkspaceStatus) {
+				serial := 3
+				status.Serial = &serial
+			},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				_, err := o.WorkspacesClient("dev").Get(context.Background(), "bar", metav1.GetOptions{})
+				assert.NoError(t, err)
+				_, err = o.SecretsClient("dev").Get(context.Background(), "tfstate-default-bar", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "copy sensitive variables",
+			args: []string{"foo", "dev/bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithVariablesFromSecret("foo-variables", "password"), testobj.WithVariablesFromSecret("other", "token")),
+				testobj.Secret("default", "foo-variables", testobj.WithData("password", "secret")),
+			},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				ws, err := o.WorkspacesClient("dev").Get(context.Background(), "bar", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "bar-variables", ws.Spec.Variables[0].ValueFrom.SecretKeyRef.Name)
+				// Secrets not managed by etok are referenced as is
+				assert.Equal(t, "other", ws.Spec.Variables[1].ValueFrom.SecretKeyRef.Name)
+
+				secret, err := o.SecretsClient("dev").Get(context.Background(), "bar-variables", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []byte("secret"), secret.Data["password"])
+
+				// Source is left intact
+				src, err := o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, "foo-variables", src.Spec.Variables[0].ValueFrom.SecretKeyRef.Name)
+			},
+		},
+		{
+			name: "copy without state",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{testobj.Workspace("default", "foo")},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				_, err := o.WorkspacesClient("default").Get(context.Background(), "bar", metav1.GetOptions{})
+				assert.NoError(t, err)
+				_, err = o.SecretsClient("default").Get(context.Background(), "tfstate-default-bar", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
+		{
+			name: "move",
+			move: true,
+			args: []string{"foo", "dev/bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithSerial(3)),
+				state("default", "foo"),
+			},
+			env: &env.Env{Namespace: "default", Workspace: "foo"},
+			overrideStatus: func(status *v1alpha1.WorkspaceStatus) {
+				serial := 3
+				status.Serial = &serial
+			},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				_, err := o.WorkspacesClient("dev").Get(context.Background(), "bar", metav1.GetOptions{})
+				assert.NoError(t, err)
+
+				// Source is deleted
+				_, err = o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+
+				// Destination is selected
+				etokenv, err := env.Read(o.path)
+				require.NoError(t, err)
+				assert.Equal(t, "dev/bar", etokenv.String())
+			},
+		},
+		{
+			name: "move leaves other selected workspace alone",
+			move: true,
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{testobj.Workspace("default", "foo")},
+			env:  &env.Env{Namespace: "default", Workspace: "other"},
+			assertions: func(t *testutil.T, o *copyOptions) {
+				etokenv, err := env.Read(o.path)
+				require.NoError(t, err)
+				assert.Equal(t, "default/other", etokenv.String())
+			},
+		},
+		{
+			name: "serial mismatch",
+			move: true,
+			// The fake client ignores field selectors, so copy to another
+			// namespace to avoid watching the source workspace too
+			args: []string{"foo", "dev/bar", "--timeout", "100ms"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithSerial(3)),
+				state("default", "foo"),
+			},
+			overrideStatus: func(status *v1alpha1.WorkspaceStatus) {
+				serial := 2
+				status.Serial = &serial
+			},
+			err: errSerialTimeout,
+			assertions: func(t *testutil.T, o *copyOptions) {
+				// Destination is cleaned up
+				_, err := o.WorkspacesClient("dev").Get(context.Background(), "bar", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+				_, err = o.SecretsClient("dev").Get(context.Background(), "tfstate-default-bar", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+
+				// Source is left intact
+				_, err = o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:        "run activated during move",
+			move:        true,
+			args:        []string{"foo", "dev/bar"},
+			objs:        []runtime.Object{testobj.Workspace("default", "foo")},
+			activeAfter: 1,
+			err:         errSourceChanged,
+			assertions: func(t *testutil.T, o *copyOptions) {
+				// Destination is cleaned up
+				_, err := o.WorkspacesClient("dev").Get(context.Background(), "bar", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+
+				// Source is left intact and its queue unblocked
+				src, err := o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.False(t, src.IsQueueBlocked())
+			},
+		},
+		{
+			name: "source serial unknown",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo"),
+				state("default", "foo"),
+			},
+			err: errSerialUnknown,
+		},
+		{
+			name: "active run",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{testobj.Workspace("default", "foo", testobj.WithCombinedQueue("run-1"))},
+			err:  errWorkspaceBusy,
+		},
+		{
+			name: "destination exists",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo"),
+				testobj.Workspace("default", "bar"),
+			},
+			err: errWorkspaceExists,
+		},
+		{
+			name: "destination state exists",
+			args: []string{"foo", "bar"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithSerial(3)),
+				state("default", "foo"),
+				state("default", "bar"),
+			},
+			err: errStateExists,
+			assertions: func(t *testutil.T, o *copyOptions) {
+				// Existing state is left alone
+				_, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-bar", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "same workspace",
+			args: []string{"foo", "default/foo"},
+			err:  errSameWorkspace,
+		},
+		{
+			name: "invalid destination",
+			args: []string{"foo", "dev/bar/baz"},
+			err:  errInvalidWorkspaceRef,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			path := t.NewTempDir().Chdir().Root()
+
+			// Write .terraform/environment
+			if tt.env != nil {
+				require.NoError(t, tt.env.Write(path))
+			}
+
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			if tt.activeAfter > 0 {
+				var gets int
+				f.ClientCreator.(*client.FakeClientCreator).PrependReactor("get", "workspaces", func(action k8stesting.Action) (bool, runtime.Object, error) {
+					if action.(k8stesting.GetAction).GetName() != "foo" {
+						return false, nil, nil
+					}
+					if gets++; gets != tt.activeAfter+1 {
+						return false, nil, nil
+					}
+					return true, testobj.Workspace("default", "foo", testobj.WithCombinedQueue("apply-1")), nil
+				})
+			}
+
+			var cmd *cobra.Command
+			var o *copyOptions
+			if tt.move {
+				cmd, o = moveCmd(f)
+			} else {
+				cmd, o = copyCmd(f)
+			}
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			// Mock the workspace controller by setting status up front
+			status := v1alpha1.WorkspaceStatus{
+				Phase: v1alpha1.WorkspacePhaseReady,
+				Conditions: []metav1.Condition{
+					{
+						Type:    v1alpha1.WorkspaceReadyCondition,
+						Status:  metav1.ConditionTrue,
+						Reason:  v1alpha1.ReadyReason,
+						Message: "mock ready",
+					},
+				},
+			}
+			// Permit individual tests to override workspace status
+			if tt.overrideStatus != nil {
+				tt.overrideStatus(&status)
+			}
+			o.status = &status
+
+			err := cmd.ExecuteContext(context.Background())
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+
+			if tt.assertions != nil {
+				tt.assertions(t, o)
+			}
+		})
+	}
+}
+
+func TestVerifySource(t *testing.T) {
+	state := func(resourceVersion string) runtime.Object {
+		secret := testobj.Secret("default", "tfstate-default-foo")
+		secret.ResourceVersion = resourceVersion
+		return secret
+	}
+	serial := func(i int) *int { return &i }
+
+	tests := []struct {
+		name         string
+		objs         []runtime.Object
+		serial       *int
+		stateVersion string
+		err          error
+	}{
+		{
+			name:         "unchanged",
+			objs:         []runtime.Object{testobj.Workspace("default", "foo", testobj.WithSerial(3)), state("1")},
+			serial:       serial(3),
+			stateVersion: "1",
+		},
+		{
+			name: "unchanged without state",
+			objs: []runtime.Object{testobj.Workspace("default", "foo")},
+		},
+		{
+			name:         "active run",
+			objs:         []runtime.Object{testobj.Workspace("default", "foo", testobj.WithSerial(3), testobj.WithCombinedQueue("apply-1")), state("1")},
+			serial:       serial(3),
+			stateVersion: "1",
+			err:          errSourceChanged,
+		},
+		{
+			name:         "serial changed",
+			objs:         []runtime.Object{testobj.Workspace("default", "foo", testobj.WithSerial(4)), state("1")},
+			serial:       serial(3),
+			stateVersion: "1",
+			err:          errSourceChanged,
+		},
+		{
+			name:         "state updated",
+			objs:         []runtime.Object{testobj.Workspace("default", "foo", testobj.WithSerial(3)), state("2")},
+			serial:       serial(3),
+			stateVersion: "1",
+			err:          errSourceChanged,
+		},
+		{
+			name:         "state deleted",
+			objs:         []runtime.Object{testobj.Workspace("default", "foo", testobj.WithSerial(3))},
+			serial:       serial(3),
+			stateVersion: "1",
+			err:          errSourceChanged,
+		},
+		{
+			name: "state created",
+			objs: []runtime.Object{testobj.Workspace("default", "foo"), state("1")},
+			err:  errSourceChanged,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			f := cmdutil.NewFakeFactory(new(bytes.Buffer), tt.objs...)
+			client, err := f.Create("")
+			require.NoError(t, err)
+
+			o := &copyOptions{Factory: f, Client: client, src: &env.Env{Namespace: "default", Workspace: "foo"}}
+
+			err = o.verifySource(context.Background(), tt.serial, tt.stateVersion)
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+		})
+	}
+}
@@ -1,24 +1,31 @@
 package workspace
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/cmd/flags"
 	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
 	"github.com/spf13/cobra"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 func deleteCmd(f *cmdutil.Factory) *cobra.Command {
 	var kubeContext string
 	var namespace = defaultNamespace
+	var force bool
 
 	cmd := &cobra.Command{
 		Use:   "delete <workspace>",
 		Short: "Deletes an etok workspace",
+		Long:  "Deletes an etok workspace. What happens to its state, and the infrastructure it records, is determined by the workspace's deletion policy. Specify --force to delete a workspace without destroying its resources, regardless of its deletion policy.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ws := args[0]
@@ -28,6 +35,12 @@ func deleteCmd(f *cmdutil.Factory) *cobra.Command {
 				return err
 			}
 
+			if force {
+				if err := forceDeletion(cmd.Context(), client, namespace, ws); err != nil {
+					return fmt.Errorf("failed to force deletion of workspace: %w", err)
+				}
+			}
+
 			if err := client.WorkspacesClient(namespace).Delete(cmd.Context(), ws, metav1.DeleteOptions{}); err != nil {
 				return fmt.Errorf("failed to delete workspace: %w", err)
 			}
@@ -42,6 +55,15 @@ func deleteCmd(f *cmdutil.Factory) *cobra.Command {
 				}
 				return false, nil
 			})
+			if err == wait.ErrWaitTimeout {
+				// Report why the workspace has yet to be deleted, e.g. its
+				// deletion policy is blocking its deletion
+				if ws, err := client.WorkspacesClient(namespace).Get(cmd.Context(), ws, metav1.GetOptions{}); err == nil {
+					if ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition); ready != nil && ready.Message != "" {
+						return fmt.Errorf("timed out waiting for workspace to be deleted: %s", ready.Message)
+					}
+				}
+			}
 			if err != nil {
 				return err
 			}
@@ -55,5 +77,15 @@ func deleteCmd(f *cmdutil.Factory) *cobra.Command {
 	flags.AddNamespaceFlag(cmd, &namespace)
 	flags.AddKubeContextFlag(cmd, &kubeContext)
 
+	cmd.Flags().BoolVar(&force, "force", false, "Delete workspace without destroying its resources, regardless of its deletion policy")
+
 	return cmd
 }
+
+// forceDeletion annotates a workspace to permit its deletion without destroying
+// its resources, regardless of its deletion policy
+func forceDeletion(ctx context.Context, cl *client.Client, namespace, workspace string) error {
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"true"}}}`, v1alpha1.ForceDeleteAnnotationKey)
+	_, err := cl.WorkspacesClient(namespace).Patch(ctx, workspace, types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
@@ -23,6 +23,11 @@ func TestDeleteWorkspace(t *testing.T) {
 			args: []string{"workspace-1"},
 			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
 		},
+		{
+			name: "Force deletion",
+			args: []string{"workspace-1", "--force"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+		},
 		{
 			name: "Without workspace",
 			args: []string{"workspace-1"},
@@ -0,0 +1,289 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/variables"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Maximum number of recent runs to describe
+	describeRunsLimit = 10
+)
+
+type describeOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	namespace   string
+	workspace   string
+	kubeContext string
+}
+
+func describeCmd(f *cmdutil.Factory) *cobra.Command {
+	o := &describeOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "describe <workspace>",
+		Short: "Describe an etok workspace",
+		Long:  "Describe an etok workspace, including its conditions, variables, outputs, recent runs and events. The variables include those of variable sets that apply to the workspace. The values of variables sourced from secrets are not shown.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			o.workspace = args[0]
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.run(cmd.Context())
+		},
+	}
+
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+
+	return cmd
+}
+
+func (o *describeOptions) run(ctx context.Context) error {
+	ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to get workspace: %w", err)
+	}
+
+	vars, err := o.variables(ctx, ws)
+	if err != nil {
+		return err
+	}
+
+	runs, err := o.recentRuns(ctx)
+	if err != nil {
+		return err
+	}
+
+	events, err := o.events(ctx, ws)
+	if err != nil {
+		return err
+	}
+
+	return describeWorkspace(o.Out, ws, vars, runs, events)
+}
+
+// variables returns the workspace's variables merged with those of the
+// variable sets that apply to it. Users lacking permission to list variable
+// sets are described with the workspace's variables alone.
+func (o *describeOptions) variables(ctx context.Context, ws *v1alpha1.Workspace) ([]variables.Variable, error) {
+	sets, err := o.ListVariableSets(ctx, o.namespace)
+	if err != nil {
+		return nil, err
+	}
+	return variables.Merge(ws, sets), nil
+}
+
+// recentRuns returns the workspace's most recent runs, newest first
+func (o *describeOptions) recentRuns(ctx context.Context) ([]v1alpha1.Run, error) {
+	list, err := o.RunsClient(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list runs: %w", err)
+	}
+
+	var runs []v1alpha1.Run
+	for _, run := range list.Items {
+		if run.Workspace == o.workspace {
+			runs = append(runs, run)
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[j].CreationTimestamp.Before(&runs[i].CreationTimestamp)
+	})
+	if len(runs) > describeRunsLimit {
+		runs = runs[:describeRunsLimit]
+	}
+	return runs, nil
+}
+
+// events returns events involving the workspace, oldest first. Users lacking
+// permission to list events are described without them.
+func (o *describeOptions) events(ctx context.Context, ws *v1alpha1.Workspace) ([]corev1.Event, error) {
+	selector := fields.Set{
+		"involvedObject.kind": "Workspace",
+		"involvedObject.name": ws.Name,
+	}.AsSelector().String()
+
+	list, err := o.KubeClient.CoreV1().Events(o.namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		if kerrors.IsForbidden(err) {
+			klog.V(1).Infof("unable to list events: %s", err.Error())
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to list events: %w", err)
+	}
+
+	// Not every client honours field selectors
+	var events []corev1.Event
+	for _, ev := range list.Items {
+		if ev.InvolvedObject.Kind == "Workspace" && ev.InvolvedObject.Name == ws.Name {
+			events = append(events, ev)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastTimestamp.Before(&events[j].LastTimestamp)
+	})
+	return events, nil
+}
+
+// describeWorkspace writes a human readable description of a workspace
+func describeWorkspace(out io.Writer, ws *v1alpha1.Workspace, vars []variables.Variable, runs []v1alpha1.Run, events []corev1.Event) error {
+	tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+
+	storageClass := "-"
+	if ws.Spec.Cache.StorageClass != nil {
+		storageClass = *ws.Spec.Cache.StorageClass
+	}
+
+	fmt.Fprintf(tw, "Name:\t%s\n", ws.Name)
+	fmt.Fprintf(tw, "Namespace:\t%s\n", ws.Namespace)
+	fmt.Fprintf(tw, "Phase:\t%s\n", orDash(string(ws.Status.Phase)))
+	fmt.Fprintf(tw, "Terraform Version:\t%s\n", orDash(ws.Spec.TerraformVersion))
+	fmt.Fprintf(tw, "Cache:\t%s (storage class: %s)\n", orDash(ws.Spec.Cache.Size), storageClass)
+	fmt.Fprintf(tw, "Backup Bucket:\t%s\n", orDash(ws.Spec.BackupBucket))
+	fmt.Fprintf(tw, "Deletion Policy:\t%s\n", orDash(string(ws.Spec.DeletionPolicy)))
+	fmt.Fprintf(tw, "Template:\t%s\n", orDash(ws.Annotations[v1alpha1.WorkspaceTemplateAnnotationKey]))
+	fmt.Fprintf(tw, "Privileged Commands:\t%s\n", joinOrDash(ws.Spec.PrivilegedCommands))
+	fmt.Fprintf(tw, "Active:\t%s\n", orDash(ws.Status.Active))
+	fmt.Fprintf(tw, "Queue:\t%s\n", joinOrDash(ws.Status.Queue))
+	fmt.Fprintf(tw, "State Serial:\t%s\n", serial(ws.Status.Serial))
+	fmt.Fprintf(tw, "Backup Serial:\t%s\n", serial(ws.Status.BackupSerial))
+	fmt.Fprintf(tw, "Age:\t%s\n", age(ws.CreationTimestamp))
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	section(out, "Conditions", len(ws.Status.Conditions) == 0)
+	if len(ws.Status.Conditions) > 0 {
+		tw = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TYPE\tSTATUS\tREASON\tMESSAGE")
+		for _, c := range ws.Status.Conditions {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", c.Type, c.Status, orDash(c.Reason), orDash(c.Message))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	section(out, "Variables", len(vars) == 0)
+	if len(vars) > 0 {
+		tw = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  KEY\tVALUE\tKIND\tSOURCE")
+		for _, v := range vars {
+			kind := "terraform"
+			if v.EnvironmentVariable {
+				kind = "environment"
+			} else if v.VariableSet == "" && isSensitive(ws.Name, v.Variable) {
+				kind = "terraform (sensitive)"
+			} else if v.HCL {
+				kind = "terraform (hcl)"
+			}
+			source := "workspace"
+			if v.VariableSet != "" {
+				source = "VariableSet/" + v.VariableSet
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", v.Key, variableValue(v.Variable), kind, source)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	section(out, "Outputs", len(ws.Status.Outputs) == 0)
+	if len(ws.Status.Outputs) > 0 {
+		tw = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  KEY\tVALUE")
+		for _, o := range ws.Status.Outputs {
+			fmt.Fprintf(tw, "  %s\t%s\n", o.Key, o.Value)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	section(out, "Recent Runs", len(runs) == 0)
+	if len(runs) > 0 {
+		tw = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  NAME\tCOMMAND\tPHASE\tEXIT\tAGE")
+		for _, run := range runs {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", run.Name, run.Command, orDash(string(run.Phase)), serial(run.ExitCode), age(run.CreationTimestamp))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	section(out, "Events", len(events) == 0)
+	if len(events) > 0 {
+		tw = tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "  TYPE\tREASON\tAGE\tMESSAGE")
+		for _, ev := range events {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", ev.Type, ev.Reason, age(ev.LastTimestamp), ev.Message)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// section writes the heading of a section of a description
+func section(out io.Writer, heading string, empty bool) {
+	if empty {
+		fmt.Fprintf(out, "%s: <none>\n", heading)
+		return
+	}
+	fmt.Fprintf(out, "%s:\n", heading)
+}
+
+// variableValue returns the value of a variable for display. The values of
+// variables sourced from secrets are never retrieved, only their source shown.
+func variableValue(v *v1alpha1.Variable) string {
+	if v.ValueFrom == nil {
+		return v.Value
+	}
+	switch {
+	case v.ValueFrom.WorkspaceOutput != nil:
+		sel := v.ValueFrom.WorkspaceOutput
+		if sel.Namespace == "" {
+			return fmt.Sprintf("<output %s:%s>", sel.Workspace, sel.Key)
+		}
+		return fmt.Sprintf("<output %s/%s:%s>", sel.Namespace, sel.Workspace, sel.Key)
+	case v.ValueFrom.ObjectField != nil:
+		return fmt.Sprintf("<object %s/%s:%s>", v.ValueFrom.ObjectField.Kind, v.ValueFrom.ObjectField.Name, v.ValueFrom.ObjectField.JSONPath)
+	case v.ValueFrom.SecretKeyRef != nil:
+		return fmt.Sprintf("<secret %s:%s>", v.ValueFrom.SecretKeyRef.Name, v.ValueFrom.SecretKeyRef.Key)
+	case v.ValueFrom.ConfigMapKeyRef != nil:
+		return fmt.Sprintf("<configmap %s:%s>", v.ValueFrom.ConfigMapKeyRef.Name, v.ValueFrom.ConfigMapKeyRef.Key)
+	case v.ValueFrom.FieldRef != nil:
+		return fmt.Sprintf("<field %s>", v.ValueFrom.FieldRef.FieldPath)
+	case v.ValueFrom.ResourceFieldRef != nil:
+		return fmt.Sprintf("<resource %s>", v.ValueFrom.ResourceFieldRef.Resource)
+	}
+	return "-"
+}
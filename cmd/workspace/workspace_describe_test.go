@@ -0,0 +1,187 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestDescribeWorkspace(t *testing.T) {
+	created := func(ago time.Duration) func(*v1alpha1.Run) {
+		return func(run *v1alpha1.Run) {
+			run.CreationTimestamp = metav1.NewTime(time.Now().Add(-ago))
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		objs       []runtime.Object
+		err        bool
+		assertions func(*testutil.T, string)
+	}{
+		{
+			name: "empty workspace",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			assertions: func(t *testutil.T, out string) {
+				assert.Contains(t, out, "Name:                 workspace-1\n")
+				assert.Contains(t, out, "Namespace:            default\n")
+				assert.Contains(t, out, "Cache:                1Gi (storage class: -)\n")
+				assert.Contains(t, out, "Variables: <none>\n")
+				assert.Contains(t, out, "Outputs: <none>\n")
+				assert.Contains(t, out, "Recent Runs: <none>\n")
+				assert.Contains(t, out, "Events: <none>\n")
+			},
+		},
+		{
+			name: "conditions",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `Conditions:\n  TYPE\s+STATUS\s+REASON\s+MESSAGE\n  Ready\s+True\s+-\s+-\n`, out)
+			},
+		},
+		{
+			name: "variables",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1",
+				testobj.WithVariables("foo", "bar"),
+				testobj.WithEnvironmentVariables("TF_LOG", "DEBUG"),
+				testobj.WithHCLVariables("zones", `["a"]`),
+				testobj.WithVariablesFromSecret("workspace-1-variables", "token"),
+				func(ws *v1alpha1.Workspace) {
+					ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{
+						Key: "vpc_id",
+						ValueFrom: &v1alpha1.VariableSource{
+							WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Namespace: "dev", Workspace: "networking", Key: "vpc_id"},
+						},
+					}, &v1alpha1.Variable{
+						Key: "lb_ip",
+						ValueFrom: &v1alpha1.VariableSource{
+							ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "web", JSONPath: "{.status.loadBalancer.ingress[0].ip}"},
+						},
+					}, &v1alpha1.Variable{
+						Key: "password",
+						ValueFrom: &v1alpha1.VariableSource{
+							EnvVarSource: corev1.EnvVarSource{
+								SecretKeyRef: &corev1.SecretKeySelector{
+									LocalObjectReference: corev1.LocalObjectReference{Name: "creds"},
+									Key:                  "password",
+								},
+							},
+						},
+					})
+				})},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `  foo\s+bar\s+terraform\s+workspace\n`, out)
+				assert.Regexp(t, `  vpc_id\s+<output dev/networking:vpc_id>\s+terraform\s+workspace\n`, out)
+				assert.Regexp(t, `  lb_ip\s+<object Service/web:\{\.status\.loadBalancer\.ingress\[0\]\.ip\}>\s+terraform\s+workspace\n`, out)
+				assert.Regexp(t, `  TF_LOG\s+DEBUG\s+environment\s+workspace\n`, out)
+				assert.Regexp(t, `  password\s+<secret creds:password>\s+terraform\s+workspace\n`, out)
+				assert.Regexp(t, `  zones\s+\["a"\]\s+terraform \(hcl\)\s+workspace\n`, out)
+				assert.Regexp(t, `  token\s+<secret workspace-1-variables:token>\s+terraform \(sensitive\)\s+workspace\n`, out)
+			},
+		},
+		{
+			name: "variables of variable sets",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1", testobj.WithVariables("region", "eu")),
+				testobj.VariableSet("default", "shared", v1alpha1.VariableSetSpec{
+					Workspaces: []string{"workspace-1"},
+					Variables: []*v1alpha1.Variable{
+						{Key: "region", Value: "us"},
+						{Key: "project", Value: "acme"},
+					},
+				}),
+				testobj.VariableSet("default", "unrelated", v1alpha1.VariableSetSpec{
+					Workspaces: []string{"workspace-2"},
+					Variables:  []*v1alpha1.Variable{{Key: "owner", Value: "platform"}},
+				}),
+			},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `  region\s+eu\s+terraform\s+workspace\n`, out)
+				assert.Regexp(t, `  project\s+acme\s+terraform\s+VariableSet/shared\n`, out)
+				assert.NotContains(t, out, "owner")
+			},
+		},
+		{
+			name: "outputs",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithOutputs("url", "https://example.com"))},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `Outputs:\n  KEY\s+VALUE\n  url\s+https://example.com\n`, out)
+			},
+		},
+		{
+			name: "recent runs",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1"),
+				testobj.Run("default", "run-1", "plan", testobj.WithWorkspace("workspace-1"), testobj.WithRunPhase(v1alpha1.RunPhaseCompleted), testobj.WithRunExitCode(0), created(time.Hour)),
+				testobj.Run("default", "run-2", "apply", testobj.WithWorkspace("workspace-1"), testobj.WithRunPhase(v1alpha1.RunPhaseRunning), created(time.Minute)),
+				testobj.Run("default", "run-3", "plan", testobj.WithWorkspace("workspace-2")),
+			},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `Recent Runs:\n  NAME\s+COMMAND\s+PHASE\s+EXIT\s+AGE\n  run-2\s+apply\s+running\s+-\s+\S+\n  run-1\s+plan\s+completed\s+0\s+\S+\nEvents`, out)
+			},
+		},
+		{
+			name: "events",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1"),
+				&corev1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "event-1"},
+					InvolvedObject: corev1.ObjectReference{Kind: "Workspace", Name: "workspace-1"},
+					Type:           corev1.EventTypeWarning,
+					Reason:         "CacheResizeUnsupported",
+					Message:        "storage class does not permit expansion",
+				},
+				&corev1.Event{
+					ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "event-2"},
+					InvolvedObject: corev1.ObjectReference{Kind: "Workspace", Name: "workspace-2"},
+					Type:           corev1.EventTypeNormal,
+					Reason:         "Other",
+				},
+			},
+			assertions: func(t *testutil.T, out string) {
+				assert.Regexp(t, `Events:\n  TYPE\s+REASON\s+AGE\s+MESSAGE\n  Warning\s+CacheResizeUnsupported\s+\S+\s+storage class does not permit expansion\n$`, out)
+			},
+		},
+		{
+			name: "without workspace",
+			args: []string{"workspace-1"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			cmd := describeCmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			t.CheckError(tt.err, cmd.ExecuteContext(context.Background()))
+
+			if tt.assertions != nil {
+				tt.assertions(t, out.String())
+			}
+		})
+	}
+}
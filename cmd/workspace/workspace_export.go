@@ -0,0 +1,311 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/bundle"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Secret whose keys are made available to runs if a workspace specifies no
+	// credentials
+	defaultCredentialsSecret = "etok"
+)
+
+var (
+	errExportArgs               = errors.New("expected either a single workspace or --all")
+	errSecretsWithoutPassphrase = errors.New("--include-secrets requires --passphrase-file")
+	errEmptyPassphrase          = errors.New("passphrase file is empty")
+)
+
+type exportOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	namespace   string
+	workspace   string
+	kubeContext string
+
+	// Export all workspaces in the namespace
+	all bool
+
+	// Path to bundle file
+	file string
+
+	// Path to file containing passphrase with which to encrypt bundle
+	passphraseFile string
+
+	// Include the secrets referenced by workspaces in the bundle
+	includeSecrets bool
+}
+
+func exportCmd(f *cmdutil.Factory) (*cobra.Command, *exportOptions) {
+	o := &exportOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "export [<workspace>]",
+		Short: "Export etok workspaces to a bundle",
+		Long:  "Export an etok workspace, or all workspaces in a namespace with --all, to a bundle, from which they can be recreated with workspace import. A bundle includes each workspace's spec, variables, outputs, state, and the archive and lock file of its most recent runs. The secrets each workspace references are included only with --include-secrets, which requires the bundle to be encrypted with --passphrase-file. A bundle includes state, which may contain sensitive values, so consider encrypting it regardless.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			if (len(args) == 1) == o.all {
+				return errExportArgs
+			}
+			if len(args) == 1 {
+				o.workspace = args[0]
+			}
+			if o.includeSecrets && o.passphraseFile == "" {
+				return errSecretsWithoutPassphrase
+			}
+
+			if o.file == "" {
+				if o.all {
+					o.file = o.namespace + ".bundle"
+				} else {
+					o.file = o.workspace + ".bundle"
+				}
+			}
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.run(cmd.Context())
+		},
+	}
+
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+
+	cmd.Flags().BoolVar(&o.all, "all", false, "Export all workspaces in the namespace")
+	cmd.Flags().StringVarP(&o.file, "file", "f", "", "Path to which to write bundle (default <workspace>.bundle, or <namespace>.bundle with --all)")
+	cmd.Flags().StringVar(&o.passphraseFile, "passphrase-file", "", "Path to file containing passphrase with which to encrypt bundle")
+	cmd.Flags().BoolVar(&o.includeSecrets, "include-secrets", false, "Include the secrets referenced by workspaces, including credentials, in the bundle (requires --passphrase-file)")
+
+	return cmd, o
+}
+
+func (o *exportOptions) run(ctx context.Context) error {
+	passphrase, err := readPassphrase(o.passphraseFile)
+	if err != nil {
+		return err
+	}
+	// An empty passphrase would write the bundle unencrypted
+	if len(passphrase) == 0 && (o.includeSecrets || o.passphraseFile != "") {
+		return errEmptyPassphrase
+	}
+
+	var workspaces []v1alpha1.Workspace
+	if o.all {
+		list, err := o.WorkspacesClient(o.namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		workspaces = list.Items
+	} else {
+		ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to get workspace: %w", err)
+		}
+		workspaces = append(workspaces, *ws)
+	}
+
+	runs, err := o.RunsClient(o.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to list runs: %w", err)
+	}
+	// Newest first
+	sort.SliceStable(runs.Items, func(i, j int) bool {
+		return runs.Items[j].CreationTimestamp.Before(&runs.Items[i].CreationTimestamp)
+	})
+
+	b := &bundle.Bundle{}
+	for i := range workspaces {
+		wb, err := o.exportWorkspace(ctx, &workspaces[i], runs.Items)
+		if err != nil {
+			return err
+		}
+		b.Workspaces = append(b.Workspaces, *wb)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := bundle.Write(buf, b, passphrase); err != nil {
+		return err
+	}
+	// Bundle contains state and possibly secrets, so restrict its permissions
+	if err := ioutil.WriteFile(o.file, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+
+	for _, wb := range b.Workspaces {
+		fmt.Fprintf(o.Out, "Exported workspace %s\n", klog.KObj(&wb.Workspace))
+	}
+	fmt.Fprintf(o.Out, "Written bundle to %s\n", o.file)
+
+	return nil
+}
+
+// exportWorkspace retrieves a workspace's resources for inclusion in a bundle.
+// Runs are expected newest first.
+func (o *exportOptions) exportWorkspace(ctx context.Context, ws *v1alpha1.Workspace, runs []v1alpha1.Run) (*bundle.Workspace, error) {
+	wb := &bundle.Workspace{
+		Workspace: v1alpha1.Workspace{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: v1alpha1.SchemeGroupVersion.String(),
+				Kind:       "Workspace",
+			},
+			ObjectMeta: exportMeta(ws.ObjectMeta),
+			Spec:       ws.Spec,
+			Status:     ws.Status,
+		},
+	}
+
+	state, err := o.SecretsClient(ws.Namespace).Get(ctx, ws.StateSecretName(), metav1.GetOptions{})
+	switch {
+	case kerrors.IsNotFound(err):
+		klog.V(1).Infof("workspace %s has no state", klog.KObj(ws))
+	case err != nil:
+		return nil, fmt.Errorf("unable to get state: %w", err)
+	default:
+		wb.State = &corev1.Secret{
+			ObjectMeta: exportMeta(state.ObjectMeta),
+			Type:       state.Type,
+			Data:       state.Data,
+		}
+	}
+
+	var secrets []string
+	if o.includeSecrets {
+		secrets = referencedSecrets(ws)
+	}
+	for _, name := range secrets {
+		secret, err := o.SecretsClient(ws.Namespace).Get(ctx, name, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) {
+			// Referenced secrets may be optional
+			klog.V(1).Infof("secret %s referenced by workspace %s not found", name, klog.KObj(ws))
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to get secret: %w", err)
+		}
+		wb.Secrets = append(wb.Secrets, corev1.Secret{
+			ObjectMeta: exportMeta(secret.ObjectMeta),
+			Type:       secret.Type,
+			Data:       secret.Data,
+		})
+	}
+
+	// Retrieve the archive and lock file of the most recent runs that still
+	// have them
+	for _, run := range runs {
+		if run.Workspace != ws.Name {
+			continue
+		}
+		if wb.Archive == nil {
+			cm, err := o.getConfigMap(ctx, ws.Namespace, run.ConfigMap)
+			if err != nil {
+				return nil, err
+			}
+			wb.Archive = cm
+		}
+		if wb.LockFile == nil {
+			cm, err := o.getConfigMap(ctx, ws.Namespace, v1alpha1.RunLockFileConfigMapName(run.Name))
+			if err != nil {
+				return nil, err
+			}
+			wb.LockFile = cm
+		}
+		if wb.Archive != nil && wb.LockFile != nil {
+			break
+		}
+	}
+
+	return wb, nil
+}
+
+// getConfigMap retrieves a config map for inclusion in a bundle, returning nil
+// if it does not exist
+func (o *exportOptions) getConfigMap(ctx context.Context, namespace, name string) (*corev1.ConfigMap, error) {
+	cm, err := o.ConfigMapsClient(namespace).Get(ctx, name, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to get config map: %w", err)
+	}
+	return &corev1.ConfigMap{
+		ObjectMeta: exportMeta(cm.ObjectMeta),
+		Data:       cm.Data,
+		BinaryData: cm.BinaryData,
+	}, nil
+}
+
+// referencedSecrets returns the names of the secrets referenced by a workspace
+func referencedSecrets(ws *v1alpha1.Workspace) []string {
+	names := make(map[string]bool)
+	for _, src := range ws.Spec.Credentials {
+		if src.Secret != nil {
+			names[src.Secret.Name] = true
+		}
+	}
+	if len(ws.Spec.Credentials) == 0 {
+		names[defaultCredentialsSecret] = true
+	}
+	if ws.Spec.CLIConfig != nil {
+		for _, creds := range ws.Spec.CLIConfig.Credentials {
+			names[creds.SecretKeyRef.Name] = true
+		}
+	}
+	for _, v := range ws.Spec.Variables {
+		if v.ValueFrom != nil && v.ValueFrom.SecretKeyRef != nil {
+			names[v.ValueFrom.SecretKeyRef.Name] = true
+		}
+	}
+
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// exportMeta returns the metadata of a resource necessary to recreate it,
+// stripping that which is set by kubernetes
+func exportMeta(meta metav1.ObjectMeta) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:        meta.Name,
+		Namespace:   meta.Namespace,
+		Labels:      meta.Labels,
+		Annotations: meta.Annotations,
+	}
+}
+
+// readPassphrase reads a passphrase from a file, less any trailing newline. An
+// empty path returns an empty passphrase.
+func readPassphrase(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read passphrase: %w", err)
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
@@ -0,0 +1,189 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/bundle"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestExportWorkspace(t *testing.T) {
+	created := func(ago time.Duration) func(*v1alpha1.Run) {
+		return func(run *v1alpha1.Run) {
+			run.CreationTimestamp = metav1.NewTime(time.Now().Add(-ago))
+		}
+	}
+	configMap := func(name string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, ResourceVersion: "123"}}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		objs       []runtime.Object
+		passphrase string
+		err        error
+		assertions func(*testutil.T, *bundle.Bundle)
+	}{
+		{
+			name:       "workspace",
+			args:       []string{"foo", "--include-secrets", "--passphrase-file", "passphrase"},
+			passphrase: "secret",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo",
+					testobj.WithVariables("region", "eu"),
+					testobj.WithOutputs("url", "https://example.com"),
+					testobj.WithCredentials(v1alpha1.CredentialsSource{Secret: &v1alpha1.SecretCredentials{Name: "gcp"}})),
+				testobj.Secret("default", "tfstate-default-foo", testobj.WithData("tfstate", "state")),
+				testobj.Secret("default", "gcp", testobj.WithData("key", "secret")),
+				testobj.Secret("default", "unrelated"),
+			},
+			assertions: func(t *testutil.T, b *bundle.Bundle) {
+				require.Equal(t, 1, len(b.Workspaces))
+				wb := b.Workspaces[0]
+
+				assert.Equal(t, "foo", wb.Workspace.Name)
+				assert.Equal(t, []*v1alpha1.Variable{{Key: "region", Value: "eu"}}, wb.Workspace.Spec.Variables)
+				assert.Equal(t, []*v1alpha1.Output{{Key: "url", Value: "https://example.com"}}, wb.Workspace.Status.Outputs)
+
+				if assert.NotNil(t, wb.State) {
+					assert.Equal(t, []byte("state"), wb.State.Data["tfstate"])
+				}
+
+				if assert.Equal(t, 1, len(wb.Secrets)) {
+					assert.Equal(t, "gcp", wb.Secrets[0].Name)
+					assert.Equal(t, []byte("secret"), wb.Secrets[0].Data["key"])
+				}
+			},
+		},
+		{
+			name: "secrets excluded by default",
+			args: []string{"foo"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo", testobj.WithCredentials(v1alpha1.CredentialsSource{Secret: &v1alpha1.SecretCredentials{Name: "gcp"}})),
+				testobj.Secret("default", "gcp", testobj.WithData("key", "secret")),
+				testobj.Secret("default", "etok", testobj.WithData("key", "secret")),
+			},
+			assertions: func(t *testutil.T, b *bundle.Bundle) {
+				assert.Equal(t, 0, len(b.Workspaces[0].Secrets))
+			},
+		},
+		{
+			name:       "secrets with empty passphrase",
+			args:       []string{"foo", "--include-secrets", "--passphrase-file", "passphrase"},
+			passphrase: "\n",
+			objs:       []runtime.Object{testobj.Workspace("default", "foo")},
+			err:        errEmptyPassphrase,
+		},
+		{
+			name: "secrets without passphrase",
+			args: []string{"foo", "--include-secrets"},
+			err:  errSecretsWithoutPassphrase,
+		},
+		{
+			name: "archive and lock file of most recent runs",
+			args: []string{"foo"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "foo"),
+				testobj.Run("default", "run-1", "init", testobj.WithWorkspace("foo"), created(time.Hour)),
+				testobj.Run("default", "run-2", "plan", testobj.WithWorkspace("foo"), created(time.Minute)),
+				testobj.Run("default", "run-3", "plan", testobj.WithWorkspace("bar")),
+				configMap("run-1"),
+				configMap("run-1-lockfile"),
+				configMap("run-2"),
+				configMap("run-3"),
+			},
+			assertions: func(t *testutil.T, b *bundle.Bundle) {
+				wb := b.Workspaces[0]
+				if assert.NotNil(t, wb.Archive) {
+					assert.Equal(t, "run-2", wb.Archive.Name)
+					// Metadata set by kubernetes is stripped
+					assert.Equal(t, "", wb.Archive.ResourceVersion)
+				}
+				if assert.NotNil(t, wb.LockFile) {
+					assert.Equal(t, "run-1-lockfile", wb.LockFile.Name)
+				}
+			},
+		},
+		{
+			name: "all",
+			args: []string{"--all", "--namespace", "dev"},
+			objs: []runtime.Object{
+				testobj.Workspace("dev", "foo"),
+				testobj.Workspace("dev", "bar"),
+				testobj.Workspace("default", "baz"),
+			},
+			assertions: func(t *testutil.T, b *bundle.Bundle) {
+				assert.Equal(t, 2, len(b.Workspaces))
+			},
+		},
+		{
+			name:       "encrypted",
+			args:       []string{"foo", "--passphrase-file", "passphrase"},
+			objs:       []runtime.Object{testobj.Workspace("default", "foo")},
+			passphrase: "secret",
+			assertions: func(t *testutil.T, b *bundle.Bundle) {
+				assert.Equal(t, 1, len(b.Workspaces))
+			},
+		},
+		{
+			name: "workspace and all",
+			args: []string{"foo", "--all"},
+			err:  errExportArgs,
+		},
+		{
+			name: "neither workspace nor all",
+			args: []string{},
+			err:  errExportArgs,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			path := t.NewTempDir().Chdir().Root()
+
+			if tt.passphrase != "" {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(path, "passphrase"), []byte(tt.passphrase+"\n"), 0600))
+			}
+
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			cmd, o := exportCmd(f)
+			cmd.SetArgs(append(tt.args, "--file", "test.bundle"))
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			err := cmd.ExecuteContext(context.Background())
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+
+			if tt.assertions != nil {
+				f, err := os.Open(filepath.Join(path, o.file))
+				require.NoError(t, err)
+				defer f.Close()
+
+				b, err := bundle.Read(f, []byte(tt.passphrase))
+				require.NoError(t, err)
+
+				tt.assertions(t, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/bundle"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/scheme"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+type importOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	namespace   string
+	kubeContext string
+
+	// Recreate workspaces in namespace rather than in their original
+	// namespaces
+	overrideNamespace bool
+
+	// Path to bundle file
+	file string
+
+	// Path to file containing passphrase with which to decrypt bundle
+	passphraseFile string
+
+	// Disable default behaviour of deleting resources upon error
+	disableResourceCleanup bool
+
+	// Recall which resources are created for the workspace being imported so
+	// that if an error occurs they can be cleaned up
+	createdNamespace  string
+	createdWorkspace  string
+	createdSecrets    []string
+	createdConfigMaps []string
+}
+
+func importCmd(f *cmdutil.Factory) (*cobra.Command, *importOptions) {
+	o := &importOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "import <bundle>",
+		Short: "Import etok workspaces from a bundle",
+		Long:  "Import etok workspaces from a bundle created with workspace export, recreating each workspace along with its state, the secrets it references, and the archive and lock file of its most recent runs, which are owned by the recreated workspace. Workspaces are recreated in their original namespace unless --namespace is specified. Secrets and config maps that already exist are left alone.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			o.file = args[0]
+			o.overrideNamespace = flags.IsFlagPassed(cmd.Flags(), "namespace")
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.run(cmd.Context())
+		},
+	}
+
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+	flags.AddDisableResourceCleanupFlag(cmd, &o.disableResourceCleanup)
+
+	cmd.Flags().StringVar(&o.passphraseFile, "passphrase-file", "", "Path to file containing passphrase with which to decrypt bundle")
+
+	return cmd, o
+}
+
+func (o *importOptions) run(ctx context.Context) error {
+	passphrase, err := readPassphrase(o.passphraseFile)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(o.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	b, err := bundle.Read(f, passphrase)
+	if err != nil {
+		return err
+	}
+
+	for i := range b.Workspaces {
+		if err := o.importWorkspace(ctx, &b.Workspaces[i]); err != nil {
+			if !o.disableResourceCleanup {
+				o.cleanup()
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// importWorkspace recreates a workspace and its resources. The workspace is
+// created after its state, so that it finds its state when it is first
+// reconciled, and before the config maps it owns.
+func (o *importOptions) importWorkspace(ctx context.Context, wb *bundle.Workspace) error {
+	ws := &wb.Workspace
+	if o.overrideNamespace {
+		ws.Namespace = o.namespace
+	}
+
+	// Only resources created for this workspace are cleaned up upon error
+	o.createdNamespace = ws.Namespace
+	o.createdWorkspace = ""
+	o.createdSecrets = nil
+	o.createdConfigMaps = nil
+
+	_, err := o.WorkspacesClient(ws.Namespace).Get(ctx, ws.Name, metav1.GetOptions{})
+	if err == nil {
+		return fmt.Errorf("%w: %s", errWorkspaceExists, klog.KObj(ws))
+	} else if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	for i := range wb.Secrets {
+		secret := &wb.Secrets[i]
+		secret.Namespace = ws.Namespace
+		if _, err := o.SecretsClient(ws.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			if !kerrors.IsAlreadyExists(err) {
+				return fmt.Errorf("unable to create secret: %w", err)
+			}
+			fmt.Fprintf(o.Out, "Secret %s already exists, skipping\n", klog.KObj(secret))
+			continue
+		}
+		o.createdSecrets = append(o.createdSecrets, secret.Name)
+	}
+
+	if wb.State != nil {
+		wb.State.Namespace = ws.Namespace
+		if _, err := o.SecretsClient(ws.Namespace).Create(ctx, wb.State, metav1.CreateOptions{}); err != nil {
+			if kerrors.IsAlreadyExists(err) {
+				return fmt.Errorf("%w: %s", errStateExists, klog.KObj(wb.State))
+			}
+			return fmt.Errorf("unable to create state: %w", err)
+		}
+		o.createdSecrets = append(o.createdSecrets, wb.State.Name)
+	}
+
+	// The operator reports the status of the recreated workspace
+	ws.Status = v1alpha1.WorkspaceStatus{}
+
+	created, err := o.WorkspacesClient(ws.Namespace).Create(ctx, ws, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("unable to create workspace: %w", err)
+	}
+	o.createdWorkspace = created.Name
+
+	for _, cm := range []*corev1.ConfigMap{wb.Archive, wb.LockFile} {
+		if cm == nil {
+			continue
+		}
+		cm.Namespace = ws.Namespace
+		// The runs that owned the config maps are not imported, so make the
+		// workspace owner of the config maps instead, so if the workspace is
+		// deleted so are its config maps
+		cm.OwnerReferences = nil
+		if err := controllerutil.SetOwnerReference(created, cm, scheme.Scheme); err != nil {
+			return err
+		}
+		if _, err := o.ConfigMapsClient(ws.Namespace).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			if !kerrors.IsAlreadyExists(err) {
+				return fmt.Errorf("unable to create config map: %w", err)
+			}
+			fmt.Fprintf(o.Out, "Config map %s already exists, skipping\n", klog.KObj(cm))
+			continue
+		}
+		o.createdConfigMaps = append(o.createdConfigMaps, cm.Name)
+	}
+
+	fmt.Fprintf(o.Out, "Imported workspace %s\n", klog.KObj(ws))
+	return nil
+}
+
+// cleanup deletes the resources created for the workspace being imported
+func (o *importOptions) cleanup() {
+	if o.createdWorkspace != "" {
+		// The imported state is deleted too, so its resources must not be
+		// destroyed regardless of the workspace's deletion policy
+		forceDeletion(context.Background(), o.Client, o.createdNamespace, o.createdWorkspace)
+		o.WorkspacesClient(o.createdNamespace).Delete(context.Background(), o.createdWorkspace, metav1.DeleteOptions{})
+	}
+	for _, name := range o.createdConfigMaps {
+		o.ConfigMapsClient(o.createdNamespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	}
+	for _, name := range o.createdSecrets {
+		o.SecretsClient(o.createdNamespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	}
+}
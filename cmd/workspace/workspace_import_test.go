@@ -0,0 +1,189 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/bundle"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var errCreateFailed = errors.New("create failed")
+
+func TestImportWorkspace(t *testing.T) {
+	testBundle := func() *bundle.Bundle {
+		return &bundle.Bundle{
+			Workspaces: []bundle.Workspace{
+				{
+					Workspace: *testobj.Workspace("default", "foo", testobj.WithVariables("region", "eu"), testobj.WithSerial(3)),
+					State:     testobj.Secret("default", "tfstate-default-foo", testobj.WithData("tfstate", "state")),
+					Secrets:   []corev1.Secret{*testobj.Secret("default", "gcp", testobj.WithData("key", "secret"))},
+					Archive:   &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "run-1"}},
+					LockFile:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "run-1-lockfile"}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		args       []string
+		objs       []runtime.Object
+		passphrase string
+		// Fail creation of the workspace with this error
+		createWorkspaceErr error
+		err                error
+		assertions         func(*testutil.T, *importOptions)
+	}{
+		{
+			name: "import",
+			args: []string{"test.bundle"},
+			assertions: func(t *testutil.T, o *importOptions) {
+				ws, err := o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []*v1alpha1.Variable{{Key: "region", Value: "eu"}}, ws.Spec.Variables)
+				// Status is left to the operator
+				assert.Nil(t, ws.Status.Serial)
+
+				secret, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []byte("state"), secret.Data["tfstate"])
+
+				_, err = o.SecretsClient("default").Get(context.Background(), "gcp", metav1.GetOptions{})
+				assert.NoError(t, err)
+
+				// Config maps are owned by the workspace
+				for _, name := range []string{"run-1", "run-1-lockfile"} {
+					cm, err := o.ConfigMapsClient("default").Get(context.Background(), name, metav1.GetOptions{})
+					require.NoError(t, err)
+					if assert.Equal(t, 1, len(cm.OwnerReferences)) {
+						assert.Equal(t, "Workspace", cm.OwnerReferences[0].Kind)
+						assert.Equal(t, "foo", cm.OwnerReferences[0].Name)
+					}
+				}
+
+				assert.Equal(t, "Imported workspace default/foo\n", o.Out.(*bytes.Buffer).String())
+			},
+		},
+		{
+			name: "another namespace",
+			args: []string{"test.bundle", "--namespace", "dev"},
+			assertions: func(t *testutil.T, o *importOptions) {
+				_, err := o.WorkspacesClient("dev").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+				_, err = o.SecretsClient("dev").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+				_, err = o.SecretsClient("dev").Get(context.Background(), "gcp", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name:       "encrypted",
+			args:       []string{"test.bundle", "--passphrase-file", "passphrase"},
+			passphrase: "secret",
+			assertions: func(t *testutil.T, o *importOptions) {
+				_, err := o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "existing secret is left alone",
+			args: []string{"test.bundle"},
+			objs: []runtime.Object{testobj.Secret("default", "gcp", testobj.WithData("key", "existing"))},
+			assertions: func(t *testutil.T, o *importOptions) {
+				secret, err := o.SecretsClient("default").Get(context.Background(), "gcp", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []byte("existing"), secret.Data["key"])
+
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "Secret default/gcp already exists, skipping\n")
+			},
+		},
+		{
+			name:               "failure cleans up",
+			args:               []string{"test.bundle"},
+			createWorkspaceErr: errCreateFailed,
+			err:                errCreateFailed,
+			assertions: func(t *testutil.T, o *importOptions) {
+				_, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+				_, err = o.SecretsClient("default").Get(context.Background(), "gcp", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
+		{
+			name:               "existing secret is not cleaned up",
+			args:               []string{"test.bundle"},
+			objs:               []runtime.Object{testobj.Secret("default", "gcp", testobj.WithData("key", "existing"))},
+			createWorkspaceErr: errCreateFailed,
+			err:                errCreateFailed,
+			assertions: func(t *testutil.T, o *importOptions) {
+				_, err := o.SecretsClient("default").Get(context.Background(), "gcp", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "workspace exists",
+			args: []string{"test.bundle"},
+			objs: []runtime.Object{testobj.Workspace("default", "foo")},
+			err:  errWorkspaceExists,
+		},
+		{
+			name: "state exists",
+			args: []string{"test.bundle"},
+			objs: []runtime.Object{testobj.Secret("default", "tfstate-default-foo")},
+			err:  errStateExists,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			path := t.NewTempDir().Chdir().Root()
+
+			// Write bundle, encrypting it if a passphrase is specified
+			buf := new(bytes.Buffer)
+			require.NoError(t, bundle.Write(buf, testBundle(), []byte(tt.passphrase)))
+			require.NoError(t, ioutil.WriteFile(filepath.Join(path, "test.bundle"), buf.Bytes(), 0600))
+			if tt.passphrase != "" {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(path, "passphrase"), []byte(tt.passphrase), 0600))
+			}
+
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			if tt.createWorkspaceErr != nil {
+				f.ClientCreator.(*client.FakeClientCreator).PrependReactor("create", "workspaces", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.createWorkspaceErr
+				})
+			}
+
+			cmd, o := importCmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			err := cmd.ExecuteContext(context.Background())
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+
+			if tt.assertions != nil {
+				tt.assertions(t, o)
+			}
+		})
+	}
+}
@@ -1,63 +1,156 @@
 package workspace
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/cmd/flags"
 	cmdutil "github.com/leg100/etok/cmd/util"
-	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/project"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	errInvalidOutput = errors.New("invalid output format")
 )
 
 func listCmd(f *cmdutil.Factory) *cobra.Command {
-	var path, kubeContext string
-	var namespace = defaultNamespace
-	var workspace = defaultWorkspace
+	var path, kubeContext, namespace, selector, output string
+	var currentNamespace = defaultNamespace
+	var currentWorkspace = defaultWorkspace
 
 	cmd := &cobra.Command{
 		Use:   "list",
-		Short: "List all workspaces",
+		Short: "List workspaces",
+		Long:  "List all workspaces, or only those in the namespace given by --namespace. The current workspace is marked with an asterisk.",
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			switch output {
+			case "text", "json", "yaml":
+			default:
+				return fmt.Errorf("%w: %s", errInvalidOutput, output)
+			}
+
 			client, err := f.Create(kubeContext)
 			if err != nil {
 				return err
 			}
 
-			etokenv, err := env.Read(path)
+			etokenv, err := project.Current(path)
 			if err != nil {
-				if !os.IsNotExist(err) {
-					return err
-				}
-			} else {
-				// Override defaults
-				namespace = etokenv.Namespace
-				workspace = etokenv.Workspace
+				return err
+			}
+			// Override defaults
+			if etokenv.Namespace != "" {
+				currentNamespace = etokenv.Namespace
+			}
+			if etokenv.Workspace != "" {
+				currentWorkspace = etokenv.Workspace
 			}
 
-			// List across all namespaces
-			workspaces, err := client.WorkspacesClient("").List(cmd.Context(), metav1.ListOptions{})
+			// An empty namespace lists across all namespaces
+			workspaces, err := client.WorkspacesClient(namespace).List(cmd.Context(), metav1.ListOptions{LabelSelector: selector})
 			if err != nil {
 				return err
 			}
 
-			var prefix string
+			switch output {
+			case "json", "yaml":
+				return printWorkspaceList(f.Out, workspaces, output)
+			}
+
+			tw := tabwriter.NewWriter(f.Out, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "\tNAMESPACE\tNAME\tPHASE\tVERSION\tACTIVE\tQUEUE\tSERIAL\tBACKUP\tAGE")
 			for _, ws := range workspaces.Items {
-				if ws.Namespace == namespace && ws.Name == workspace {
-					prefix = "*"
-				} else {
-					prefix = ""
+				var current string
+				if ws.Namespace == currentNamespace && ws.Name == currentWorkspace {
+					current = "*"
 				}
-				fmt.Fprintf(f.Out, "%s\t%s\n", prefix, &env.Env{Namespace: ws.Namespace, Workspace: ws.Name})
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+					current,
+					ws.Namespace,
+					ws.Name,
+					orDash(string(ws.Status.Phase)),
+					orDash(ws.Spec.TerraformVersion),
+					orDash(ws.Status.Active),
+					len(ws.Status.Queue),
+					serial(ws.Status.Serial),
+					serial(ws.Status.BackupSerial),
+					age(ws.CreationTimestamp))
 			}
-
-			return nil
+			return tw.Flush()
 		},
 	}
 
 	flags.AddPathFlag(cmd, &path)
 	flags.AddKubeContextFlag(cmd, &kubeContext)
 
+	cmd.Flags().StringVarP(&namespace, "namespace", "n", "", "Only list workspaces in this namespace")
+	cmd.Flags().StringVarP(&selector, "selector", "l", "", "Only list workspaces with labels matching the selector, e.g. 'env=prod'")
+	cmd.Flags().StringVarP(&output, "output", "o", "text", "Output format: text, json or yaml")
+
 	return cmd
 }
+
+// printWorkspaceList prints workspaces in json or yaml
+func printWorkspaceList(out io.Writer, list *v1alpha1.WorkspaceList, format string) error {
+	// Objects retrieved from the API lack their kind
+	list.APIVersion = v1alpha1.SchemeGroupVersion.String()
+	list.Kind = "WorkspaceList"
+	for i := range list.Items {
+		list.Items[i].APIVersion = v1alpha1.SchemeGroupVersion.String()
+		list.Items[i].Kind = "Workspace"
+	}
+
+	var data []byte
+	var err error
+	if format == "json" {
+		data, err = json.MarshalIndent(list, "", "    ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(list)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(data)
+	return err
+}
+
+// orDash returns a dash in place of an empty string
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// serial formats the serial number of a state file
+func serial(serial *int) string {
+	if serial == nil {
+		return "-"
+	}
+	return fmt.Sprint(*serial)
+}
+
+// age returns the time elapsed since the timestamp in a human readable form
+func age(timestamp metav1.Time) string {
+	if timestamp.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(timestamp.Time))
+}
+
+// joinOrDash joins strings, returning a dash if there are none
+func joinOrDash(strs []string) string {
+	return orDash(strings.Join(strs, ", "))
+}
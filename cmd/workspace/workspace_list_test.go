@@ -3,8 +3,10 @@ package workspace
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"testing"
 
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	cmdutil "github.com/leg100/etok/cmd/util"
 	"github.com/leg100/etok/pkg/env"
 	"github.com/leg100/etok/pkg/testobj"
@@ -12,16 +14,18 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
 )
 
 func TestListWorkspaces(t *testing.T) {
 	tests := []struct {
-		name string
-		objs []runtime.Object
-		args []string
-		env  *env.Env
-		err  bool
-		out  string
+		name       string
+		objs       []runtime.Object
+		args       []string
+		env        *env.Env
+		err        bool
+		out        string
+		assertions func(*testutil.T, *bytes.Buffer)
 	}{
 		{
 			name: "WithEnvironmentFile",
@@ -31,7 +35,9 @@ func TestListWorkspaces(t *testing.T) {
 			},
 			args: []string{},
 			env:  &env.Env{Namespace: "default", Workspace: "workspace-1"},
-			out:  "*\tdefault/workspace-1\n\tdev/workspace-2\n",
+			out: "   NAMESPACE  NAME         PHASE  VERSION  ACTIVE  QUEUE  SERIAL  BACKUP  AGE\n" +
+				"*  default    workspace-1  -      -        -       0      -       -       <unknown>\n" +
+				"   dev        workspace-2  -      -        -       0      -       -       <unknown>\n",
 		},
 		{
 			name: "WithoutEnvironmentFile",
@@ -40,7 +46,75 @@ func TestListWorkspaces(t *testing.T) {
 				testobj.Workspace("dev", "workspace-2"),
 			},
 			args: []string{},
-			out:  "\tdefault/workspace-1\n\tdev/workspace-2\n",
+			out: "  NAMESPACE  NAME         PHASE  VERSION  ACTIVE  QUEUE  SERIAL  BACKUP  AGE\n" +
+				"  default    workspace-1  -      -        -       0      -       -       <unknown>\n" +
+				"  dev        workspace-2  -      -        -       0      -       -       <unknown>\n",
+		},
+		{
+			name: "status",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1",
+					testobj.WithTerraformVersion("0.14.3"),
+					testobj.WithCombinedQueue("run-1", "run-2", "run-3"),
+					testobj.WithSerial(4),
+					func(ws *v1alpha1.Workspace) { ws.Status.Phase = v1alpha1.WorkspacePhaseReady }),
+			},
+			args: []string{},
+			out: "  NAMESPACE  NAME         PHASE  VERSION  ACTIVE  QUEUE  SERIAL  BACKUP  AGE\n" +
+				"  default    workspace-1  ready  0.14.3   run-1   2      4       -       <unknown>\n",
+		},
+		{
+			name: "namespace",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1"),
+				testobj.Workspace("dev", "workspace-2"),
+			},
+			args: []string{"--namespace", "dev"},
+			out: "  NAMESPACE  NAME         PHASE  VERSION  ACTIVE  QUEUE  SERIAL  BACKUP  AGE\n" +
+				"  dev        workspace-2  -      -        -       0      -       -       <unknown>\n",
+		},
+		{
+			name: "selector",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1", testobj.WithLabels("env", "prod")),
+				testobj.Workspace("dev", "workspace-2", testobj.WithLabels("env", "dev")),
+			},
+			args: []string{"-l", "env=prod"},
+			out: "  NAMESPACE  NAME         PHASE  VERSION  ACTIVE  QUEUE  SERIAL  BACKUP  AGE\n" +
+				"  default    workspace-1  -      -        -       0      -       -       <unknown>\n",
+		},
+		{
+			name: "json",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1"),
+				testobj.Workspace("dev", "workspace-2"),
+			},
+			args: []string{"-o", "json"},
+			assertions: func(t *testutil.T, out *bytes.Buffer) {
+				var list v1alpha1.WorkspaceList
+				require.NoError(t, json.Unmarshal(out.Bytes(), &list))
+				assert.Equal(t, "WorkspaceList", list.Kind)
+				assert.Equal(t, 2, len(list.Items))
+				assert.Equal(t, "Workspace", list.Items[0].Kind)
+			},
+		},
+		{
+			name: "yaml",
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1"),
+			},
+			args: []string{"-o", "yaml"},
+			assertions: func(t *testutil.T, out *bytes.Buffer) {
+				var list v1alpha1.WorkspaceList
+				require.NoError(t, yaml.Unmarshal(out.Bytes(), &list))
+				assert.Equal(t, "etok.dev/v1alpha1", list.APIVersion)
+				assert.Equal(t, "workspace-1", list.Items[0].Name)
+			},
+		},
+		{
+			name: "invalid output",
+			args: []string{"-o", "xml"},
+			err:  true,
 		},
 	}
 	for _, tt := range tests {
@@ -59,10 +133,18 @@ func TestListWorkspaces(t *testing.T) {
 			cmd := listCmd(f)
 			cmd.SetArgs(tt.args)
 			cmd.SetOut(f.Out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
 
 			t.CheckError(tt.err, cmd.ExecuteContext(context.Background()))
 
-			assert.Equal(t, tt.out, out.String())
+			if tt.out != "" {
+				assert.Equal(t, tt.out, out.String())
+			}
+
+			if tt.assertions != nil {
+				tt.assertions(t, out)
+			}
 		})
 	}
 }
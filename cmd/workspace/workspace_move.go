@@ -0,0 +1,26 @@
+package workspace
+
+import (
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/spf13/cobra"
+)
+
+func moveCmd(f *cmdutil.Factory) (*cobra.Command, *copyOptions) {
+	o := &copyOptions{
+		Factory:      f,
+		namespace:    defaultNamespace,
+		deleteSource: true,
+	}
+	cmd := &cobra.Command{
+		Use:   "move <source> [<namespace>/]<destination>",
+		Short: "Rename an etok workspace or move it to another namespace",
+		Long:  "Rename an etok workspace or move it to another namespace. The workspace and its state are copied to the destination, and the source workspace is deleted only once the destination reports the same state serial number. Queued runs on the source workspace are held back for the duration of the move, and the move is aborted if the state of the source workspace changes before it is deleted. If the source workspace is the current workspace then the destination becomes the current workspace.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.runE(cmd.Context(), args)
+		},
+	}
+	o.addFlags(cmd)
+
+	return cmd, o
+}
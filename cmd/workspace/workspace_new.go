@@ -1,9 +1,13 @@
 package workspace
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
@@ -11,16 +15,19 @@ import (
 	cmdutil "github.com/leg100/etok/cmd/util"
 	"github.com/leg100/etok/pkg/client"
 	"github.com/leg100/etok/pkg/controllers"
+	"github.com/leg100/etok/pkg/executor"
 	"github.com/leg100/etok/pkg/handlers"
 	"github.com/leg100/etok/pkg/k8s"
 	"github.com/leg100/etok/pkg/labels"
 	"github.com/leg100/etok/pkg/monitors"
+	"github.com/leg100/etok/pkg/util/path"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
 
 	"github.com/leg100/etok/pkg/env"
 	"github.com/leg100/etok/pkg/logstreamer"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	watchtools "k8s.io/client-go/tools/watch"
@@ -32,6 +39,10 @@ const (
 	defaultPodTimeout       = 60 * time.Second
 	defaultReadyTimeout     = 60 * time.Second
 	defaultCacheSize        = "1Gi"
+
+	// registryCredentialsKey is the key of the secret containing a registry
+	// host's token
+	registryCredentialsKey = "token"
 )
 
 var (
@@ -39,6 +50,9 @@ var (
 	errReconcileTimeout = errors.New("timed out waiting for workspace to be reconciled")
 	errReadyTimeout     = errors.New("timed out waiting for workspace to be ready")
 	errWorkspaceNameArg = errors.New("expected single argument providing the workspace name")
+	errStateSources     = errors.New("--from-state and --from-backend cannot both be specified")
+
+	errInvalidDeletionPolicy = errors.New("invalid deletion policy")
 )
 
 type newOptions struct {
@@ -68,29 +82,57 @@ type newOptions struct {
 	disableResourceCleanup bool
 
 	// Recall if resources are created so that if error occurs they can be
-	// cleaned up
+	// cleaned up. The name of the state secret is recorded.
 	createdWorkspace bool
+	createdState     string
+	createdVariables bool
 
 	// For testing purposes set workspace status
 	status *v1alpha1.WorkspaceStatus
 
 	variables            map[string]string
 	environmentVariables map[string]string
+	sensitiveVariables   map[string]string
+	varFiles             []string
+	// Variables read from var files
+	fileVariables []*v1alpha1.Variable
 
 	// backupBucket is the bucket to which the state file will backed up to
 	backupBucket string
 
+	// Path to terraform CLI configuration file
+	cliConfigPath string
+	// Mapping of registry hosts to the names of secrets containing their
+	// tokens
+	registryCredentials map[string]string
+
 	etokenv *env.Env
+
+	// Path to a state file with which to seed the workspace's state
+	fromState string
+	// Seed the workspace's state with that pulled from the backend of the
+	// local terraform config
+	fromBackend bool
+
+	// Runs terraform to pull state from the local backend
+	exec executor.Executor
+
+	// Name of the template from which to create the workspace
+	template string
+	// Reference to the template from which the workspace is created, if any
+	templateRef string
 }
 
 func newCmd(f *cmdutil.Factory) (*cobra.Command, *newOptions) {
 	o := &newOptions{
 		Factory:   f,
 		namespace: defaultNamespace,
+		exec:      &executor.Exec{IOStreams: f.IOStreams},
 	}
 	cmd := &cobra.Command{
 		Use:   "new <workspace>",
 		Short: "Create a new etok workspace",
+		Long:  "Create a new etok workspace. Settings not specified with flags are taken from a template, if one is specified with --template, or otherwise if the namespace is labelled etok.dev/workspace-template=<name>. A WorkspaceTemplate in the namespace takes precedence over a ClusterWorkspaceTemplate of the same name. The template is only applied when the workspace is created: later changes to the template are not propagated to the workspace.",
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
 			if len(args) != 1 {
 				return errWorkspaceNameArg
@@ -98,6 +140,18 @@ func newCmd(f *cmdutil.Factory) (*cobra.Command, *newOptions) {
 
 			o.workspace = args[0]
 
+			if o.fromState != "" && o.fromBackend {
+				return errStateSources
+			}
+
+			if err := validateDeletionPolicy(o.workspaceSpec.DeletionPolicy); err != nil {
+				return err
+			}
+
+			if o.fileVariables, err = readVarFiles(o.varFiles); err != nil {
+				return err
+			}
+
 			o.etokenv, err = env.New(o.namespace, o.workspace)
 			if err != nil {
 				return err
@@ -114,6 +168,10 @@ func newCmd(f *cmdutil.Factory) (*cobra.Command, *newOptions) {
 				return err
 			}
 
+			if err := o.applyTemplate(cmd.Context(), cmd.Flags()); err != nil {
+				return err
+			}
+
 			err = o.run(cmd.Context())
 			if err != nil {
 				if !o.disableResourceCleanup {
@@ -142,14 +200,44 @@ func newCmd(f *cmdutil.Factory) (*cobra.Command, *newOptions) {
 	cmd.Flags().DurationVar(&o.restoreTimeout, "restore-timeout", defaultReadyTimeout, "timeout for restore condition to report back")
 
 	cmd.Flags().StringSliceVar(&o.workspaceSpec.PrivilegedCommands, "privileged-commands", []string{}, "Set privileged commands")
+	cmd.Flags().BoolVar(&o.workspaceSpec.RefuseDirtyApplies, "refuse-dirty-applies", false, "Refuse apply and destroy from a git working tree with uncommitted changes")
+	cmd.Flags().StringVar((*string)(&o.workspaceSpec.DeletionPolicy), "deletion-policy", "", "What happens to state and infrastructure when the workspace is deleted: Delete, Protect, Retain, or Destroy (default Delete)")
 
 	cmd.Flags().StringToStringVar(&o.variables, "variables", map[string]string{}, "Set terraform variables")
 	cmd.Flags().StringToStringVar(&o.environmentVariables, "environment-variables", map[string]string{}, "Set environment variables")
+	cmd.Flags().StringToStringVar(&o.sensitiveVariables, "sensitive-variables", map[string]string{}, "Set sensitive terraform variables. Their values are stored in a secret rather than in the workspace")
+	cmd.Flags().StringArrayVar(&o.varFiles, "var-file", []string{}, "Set terraform variables from a .tfvars or .tfvars.json file. Values may be of any type. Can be specified multiple times")
+
+	cmd.Flags().StringVar(&o.cliConfigPath, "cli-config", "", "Path to terraform CLI config file to use on runs")
+	cmd.Flags().StringToStringVar(&o.registryCredentials, "registry-credentials", map[string]string{}, "Set registry credentials, mapping registry host to name of secret containing token under the key 'token'")
+
+	cmd.Flags().StringVar(&o.template, "template", "", "Name of template from which to take settings not specified with flags")
+
+	cmd.Flags().StringVar(&o.fromState, "from-state", "", "Seed the workspace's state with a state file")
+	cmd.Flags().BoolVar(&o.fromBackend, "from-backend", false, "Seed the workspace's state with that pulled from the backend configured in the path, using the local terraform")
 
 	return cmd, o
 }
 
 func (o *newOptions) run(ctx context.Context) error {
+	// Seed state before creating the workspace, so that the workspace finds
+	// its state when it is first reconciled
+	if o.fromState != "" || o.fromBackend {
+		if err := o.importState(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Write the values of sensitive variables to the workspace's variables
+	// secret, which the workspace references
+	if len(o.sensitiveVariables) > 0 {
+		created, err := writeSensitiveVariables(ctx, o.Client, o.namespace, o.workspace, o.sensitiveVariables)
+		if err != nil {
+			return fmt.Errorf("unable to write sensitive variables: %w", err)
+		}
+		o.createdVariables = created
+	}
+
 	ws, err := o.createWorkspace(ctx)
 	if err != nil {
 		return err
@@ -208,6 +296,80 @@ func (o *newOptions) cleanup() {
 	if o.createdWorkspace {
 		o.WorkspacesClient(o.namespace).Delete(context.Background(), o.workspace, metav1.DeleteOptions{})
 	}
+	if o.createdState != "" {
+		o.SecretsClient(o.namespace).Delete(context.Background(), o.createdState, metav1.DeleteOptions{})
+	}
+	if o.createdVariables {
+		o.SecretsClient(o.namespace).Delete(context.Background(), v1alpha1.WorkspaceVariablesSecretName(o.workspace), metav1.DeleteOptions{})
+	}
+}
+
+// importState creates the workspace's state secret from either a state file or
+// the state pulled from the local backend, reporting the resources imported
+func (o *newOptions) importState(ctx context.Context) error {
+	var data []byte
+	var err error
+	if o.fromState != "" {
+		data, err = ioutil.ReadFile(o.fromState)
+		if err != nil {
+			return fmt.Errorf("unable to read state file: %w", err)
+		}
+	} else {
+		data, err = o.pullState(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	state, err := parseState(data)
+	if err != nil {
+		return err
+	}
+
+	ws := &v1alpha1.Workspace{ObjectMeta: metav1.ObjectMeta{Name: o.workspace, Namespace: o.namespace}}
+	secret, err := newStateSecret(ws, data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := o.SecretsClient(o.namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		if kerrors.IsAlreadyExists(err) {
+			return fmt.Errorf("%w: %s", errStateExists, klog.KObj(secret))
+		}
+		return fmt.Errorf("unable to create state: %w", err)
+	}
+	o.createdState = secret.Name
+
+	fmt.Fprintf(o.Out, "Imported state #%d (lineage %s) with %d resources\n", *state.Serial, state.Lineage, len(state.Resources))
+	for _, res := range state.Resources {
+		fmt.Fprintf(o.Out, "  %s\n", res.Address())
+	}
+
+	return nil
+}
+
+// pullState pulls state from the backend configured in the path, using the
+// local terraform
+func (o *newOptions) pullState(ctx context.Context) ([]byte, error) {
+	dir, err := path.EnsureAbs(o.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out, stderr bytes.Buffer
+	err = o.exec.Execute(ctx, []string{"terraform", "state", "pull"}, func(cmd *exec.Cmd) {
+		cmd.Dir = dir
+		cmd.Stdin = nil
+		cmd.Stdout = &out
+		cmd.Stderr = &stderr
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pull state: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	if out.Len() == 0 {
+		return nil, errNoState
+	}
+	return out.Bytes(), nil
 }
 
 func (o *newOptions) createWorkspace(ctx context.Context) (*v1alpha1.Workspace, error) {
@@ -226,19 +388,61 @@ func (o *newOptions) createWorkspace(ctx context.Context) (*v1alpha1.Workspace,
 	// Permit filtering etok resources by component
 	labels.SetLabel(ws, labels.WorkspaceComponent)
 
-	ws.Spec.Verbosity = o.Verbosity
+	// Record template from which workspace is created
+	if o.templateRef != "" {
+		ws.Annotations = map[string]string{v1alpha1.WorkspaceTemplateAnnotationKey: o.templateRef}
+	}
+
+	// Only override verbosity set by a template if specified
+	if o.Verbosity != 0 {
+		ws.Spec.Verbosity = o.Verbosity
+	}
 
 	if o.status != nil {
 		// For testing purposes seed workspace status
 		ws.Status = *o.status
 	}
 
-	for k, v := range o.variables {
-		ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: k, Value: v})
-	}
+	// Variables override those of the same key set by a template. Those set
+	// with --variables override those of the same key in var files.
+	ws.Spec.Variables = mergeVariables(ws.Spec.Variables, o.fileVariables)
+	ws.Spec.Variables = setVariables(ws.Spec.Variables, o.variables, false)
+	ws.Spec.Variables = setVariables(ws.Spec.Variables, o.environmentVariables, true)
+	ws.Spec.Variables = mergeVariables(ws.Spec.Variables, sensitiveVariables(o.workspace, o.sensitiveVariables))
+
+	if o.cliConfigPath != "" || len(o.registryCredentials) > 0 {
+		if ws.Spec.CLIConfig == nil {
+			ws.Spec.CLIConfig = &v1alpha1.CLIConfig{}
+		}
+
+		if o.cliConfigPath != "" {
+			inline, err := ioutil.ReadFile(o.cliConfigPath)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CLI config: %w", err)
+			}
+			ws.Spec.CLIConfig.Inline = string(inline)
+		}
 
-	for k, v := range o.environmentVariables {
-		ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: k, Value: v, EnvironmentVariable: true})
+		for host, secret := range o.registryCredentials {
+			creds := v1alpha1.RegistryCredentials{
+				Host: host,
+				SecretKeyRef: corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+					Key:                  registryCredentialsKey,
+				},
+			}
+			// Override credentials for the same host set by a template
+			var found bool
+			for i, existing := range ws.Spec.CLIConfig.Credentials {
+				if existing.Host == host {
+					ws.Spec.CLIConfig.Credentials[i] = creds
+					found = true
+				}
+			}
+			if !found {
+				ws.Spec.CLIConfig.Credentials = append(ws.Spec.CLIConfig.Credentials, creds)
+			}
+		}
 	}
 
 	ws, err := o.WorkspacesClient(o.namespace).Create(ctx, ws, metav1.CreateOptions{})
@@ -306,3 +510,13 @@ func (o *newOptions) waitForReady(ctx context.Context, ws *v1alpha1.Workspace) e
 	}
 	return nil
 }
+
+// validateDeletionPolicy checks the deletion policy is one of those permitted.
+// An empty policy defers to the default.
+func validateDeletionPolicy(policy v1alpha1.DeletionPolicy) error {
+	switch policy {
+	case "", v1alpha1.DeletionPolicyDelete, v1alpha1.DeletionPolicyProtect, v1alpha1.DeletionPolicyRetain, v1alpha1.DeletionPolicyDestroy:
+		return nil
+	}
+	return fmt.Errorf("%w: %s: must be one of Delete, Protect, Retain, or Destroy", errInvalidDeletionPolicy, policy)
+}
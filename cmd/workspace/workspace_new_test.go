@@ -2,13 +2,16 @@ package workspace
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	etokerrors "github.com/leg100/etok/pkg/errors"
+	"github.com/leg100/etok/pkg/executor"
 	"github.com/leg100/etok/pkg/handlers"
 
 	cmdutil "github.com/leg100/etok/cmd/util"
@@ -16,8 +19,10 @@ import (
 	"github.com/leg100/etok/pkg/logstreamer"
 	"github.com/leg100/etok/pkg/testobj"
 	"github.com/leg100/etok/pkg/testutil"
+	"github.com/leg100/etok/pkg/variables"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -26,6 +31,18 @@ import (
 func TestNewWorkspace(t *testing.T) {
 	var fakeError = errors.New("fake error")
 
+	stateFile := `{
+  "version": 4,
+  "terraform_version": "0.14.3",
+  "serial": 5,
+  "lineage": "a2d2ed4b-7e8a-8c4c-2d0a-2c3b4f5e6a7b",
+  "outputs": {},
+  "resources": [
+    {"mode": "managed", "type": "random_id", "name": "test", "provider": "provider[\"registry.terraform.io/hashicorp/random\"]", "instances": []},
+    {"module": "module.vpc", "mode": "data", "type": "google_project", "name": "project", "provider": "provider[\"registry.terraform.io/hashicorp/google\"]", "instances": []}
+  ]
+}`
+
 	tests := []struct {
 		name             string
 		args             []string
@@ -33,6 +50,7 @@ func TestNewWorkspace(t *testing.T) {
 		overrideStatus   func(*v1alpha1.WorkspaceStatus)
 		objs             []runtime.Object
 		factoryOverrides func(*cmdutil.Factory)
+		optsOverrides    func(*newOptions)
 		assertions       func(*testutil.T, *newOptions)
 	}{
 		{
@@ -178,6 +196,69 @@ func TestNewWorkspace(t *testing.T) {
 				assert.Contains(t, ws.Spec.Variables, &v1alpha1.Variable{Key: "baz", Value: "haj"})
 			},
 		},
+		{
+			name: "set variables from var files",
+			args: []string{"foo",
+				"--var-file", testutil.TempFile(t, "*.tfvars", []byte("zones = [\"a\", \"b\"]\nregion = \"eu\"\n")),
+				"--var-file", testutil.TempFile(t, "*.tfvars.json", []byte(`{"region": "us"}`)),
+				"--variables", "count=3"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, []*v1alpha1.Variable{
+					{Key: "region", Value: `"us"`, HCL: true},
+					{Key: "zones", Value: `["a", "b"]`, HCL: true},
+					{Key: "count", Value: "3"},
+				}, ws.Spec.Variables)
+			},
+		},
+		{
+			name: "invalid var file",
+			args: []string{"foo", "--var-file", testutil.TempFile(t, "*.tfvars", []byte("zones = [\"a\""))},
+			err:  variables.ErrInvalidFile,
+		},
+		{
+			name: "set sensitive variables",
+			args: []string{"foo", "--sensitive-variables", "password=secret", "--variables", "region=eu"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, []*v1alpha1.Variable{
+					{Key: "region", Value: "eu"},
+					{Key: "password", ValueFrom: &v1alpha1.VariableSource{
+						EnvVarSource: corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "foo-variables"},
+								Key:                  "password",
+							},
+						},
+					}},
+				}, ws.Spec.Variables)
+
+				secret, err := o.SecretsClient(o.namespace).Get(context.Background(), "foo-variables", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, []byte("secret"), secret.Data["password"])
+			},
+		},
+		{
+			name: "cleanup sensitive variables upon error",
+			args: []string{"foo", "--sensitive-variables", "password=secret"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			err:  fakeError,
+			factoryOverrides: func(f *cmdutil.Factory) {
+				f.GetLogsFunc = func(ctx context.Context, opts logstreamer.Options) (io.ReadCloser, error) {
+					return nil, fakeError
+				}
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				_, err := o.SecretsClient(o.namespace).Get(context.Background(), "foo-variables", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
 		{
 			name: "set environment variables",
 			args: []string{"foo", "--environment-variables", "foo=bar,baz=haj"},
@@ -203,6 +284,226 @@ func TestNewWorkspace(t *testing.T) {
 				assert.Equal(t, []string{"apply", "destroy", "sh"}, ws.Spec.PrivilegedCommands)
 			},
 		},
+		{
+			name: "refuse dirty applies",
+			args: []string{"foo", "--refuse-dirty-applies"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.True(t, ws.Spec.RefuseDirtyApplies)
+			},
+		},
+		{
+			name: "set deletion policy",
+			args: []string{"foo", "--deletion-policy", "Protect"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, v1alpha1.DeletionPolicyProtect, ws.Spec.DeletionPolicy)
+			},
+		},
+		{
+			name: "invalid deletion policy",
+			args: []string{"foo", "--deletion-policy", "Obliterate"},
+			err:  errInvalidDeletionPolicy,
+		},
+		{
+			name: "template",
+			args: []string{"foo", "--template", "standard", "--size", "10Gi", "--variables", "region=us"},
+			objs: []runtime.Object{
+				testobj.WorkspacePod("default", "foo"),
+				testobj.WorkspaceTemplate("default", "standard", v1alpha1.WorkspaceSpec{
+					Cache:              v1alpha1.WorkspaceCacheSpec{Size: "5Gi"},
+					TerraformVersion:   "0.13.5",
+					PrivilegedCommands: []string{"apply"},
+					Variables:          []*v1alpha1.Variable{{Key: "region", Value: "eu"}, {Key: "env", Value: "prod"}},
+					Policies:           []v1alpha1.PolicyReference{{Name: "costs"}},
+				}),
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, "10Gi", ws.Spec.Cache.Size)
+				assert.Equal(t, "0.13.5", ws.Spec.TerraformVersion)
+				assert.Equal(t, []string{"apply"}, ws.Spec.PrivilegedCommands)
+				assert.Equal(t, []*v1alpha1.Variable{{Key: "region", Value: "us"}, {Key: "env", Value: "prod"}}, ws.Spec.Variables)
+				assert.Equal(t, []v1alpha1.PolicyReference{{Name: "costs"}}, ws.Spec.Policies)
+				assert.Equal(t, "WorkspaceTemplate/standard", ws.Annotations[v1alpha1.WorkspaceTemplateAnnotationKey])
+			},
+		},
+		{
+			name: "cluster template",
+			args: []string{"foo", "--template", "standard"},
+			objs: []runtime.Object{
+				testobj.WorkspacePod("default", "foo"),
+				testobj.ClusterWorkspaceTemplate("standard", v1alpha1.WorkspaceSpec{TerraformVersion: "0.13.5"}),
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, "0.13.5", ws.Spec.TerraformVersion)
+				assert.Equal(t, "ClusterWorkspaceTemplate/standard", ws.Annotations[v1alpha1.WorkspaceTemplateAnnotationKey])
+			},
+		},
+		{
+			name: "namespaced template takes precedence over cluster template",
+			args: []string{"foo", "--template", "standard"},
+			objs: []runtime.Object{
+				testobj.WorkspacePod("default", "foo"),
+				testobj.WorkspaceTemplate("default", "standard", v1alpha1.WorkspaceSpec{TerraformVersion: "0.14.3"}),
+				testobj.ClusterWorkspaceTemplate("standard", v1alpha1.WorkspaceSpec{TerraformVersion: "0.13.5"}),
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, "0.14.3", ws.Spec.TerraformVersion)
+			},
+		},
+		{
+			name: "namespace default template",
+			args: []string{"foo"},
+			objs: []runtime.Object{
+				testobj.WorkspacePod("default", "foo"),
+				&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{v1alpha1.WorkspaceTemplateLabelKey: "standard"}}},
+				testobj.ClusterWorkspaceTemplate("standard", v1alpha1.WorkspaceSpec{BackupBucket: "backups"}),
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				assert.Equal(t, "backups", ws.Spec.BackupBucket)
+			},
+		},
+		{
+			name: "template not found",
+			args: []string{"foo", "--template", "standard"},
+			err:  errTemplateNotFound,
+		},
+		{
+			name: "set cli config",
+			args: []string{"foo", "--cli-config", testutil.TempFile(t, "terraformrc", []byte("disable_checkpoint = true")), "--registry-credentials", "registry.example.com=registry-creds"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				// Get workspace
+				ws, err := o.WorkspacesClient(o.namespace).Get(context.Background(), o.workspace, metav1.GetOptions{})
+				require.NoError(t, err)
+
+				if assert.NotNil(t, ws.Spec.CLIConfig) {
+					assert.Equal(t, "disable_checkpoint = true", ws.Spec.CLIConfig.Inline)
+					assert.Equal(t, []v1alpha1.RegistryCredentials{
+						{
+							Host: "registry.example.com",
+							SecretKeyRef: corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "registry-creds"},
+								Key:                  "token",
+							},
+						},
+					}, ws.Spec.CLIConfig.Credentials)
+				}
+			},
+		},
+		{
+			name: "from state",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(stateFile))},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			assertions: func(t *testutil.T, o *newOptions) {
+				secret, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				require.NoError(t, err)
+				assert.Equal(t, map[string]string{
+					"tfstate":                      "true",
+					"tfstateWorkspace":             "default",
+					"tfstateSecretSuffix":          "foo",
+					"app.kubernetes.io/managed-by": "terraform",
+				}, secret.Labels)
+
+				gr, err := gzip.NewReader(bytes.NewReader(secret.Data["tfstate"]))
+				require.NoError(t, err)
+				data, err := ioutil.ReadAll(gr)
+				require.NoError(t, err)
+				assert.Equal(t, stateFile, string(data))
+
+				assert.Contains(t, o.Out.(*bytes.Buffer).String(), "Imported state #5 (lineage a2d2ed4b-7e8a-8c4c-2d0a-2c3b4f5e6a7b) with 2 resources\n  random_id.test\n  module.vpc.data.google_project.project\n")
+			},
+		},
+		{
+			name: "from backend",
+			args: []string{"foo", "--from-backend"},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			optsOverrides: func(o *newOptions) {
+				o.exec = &executor.FakeExecutorState{State: stateFile}
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				assert.Equal(t, [][]string{{"terraform", "state", "pull"}}, o.exec.(*executor.FakeExecutorState).Args)
+
+				_, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				assert.NoError(t, err)
+			},
+		},
+		{
+			name: "from backend without state",
+			args: []string{"foo", "--from-backend"},
+			optsOverrides: func(o *newOptions) {
+				o.exec = &executor.FakeExecutorState{}
+			},
+			err: errNoState,
+		},
+		{
+			name: "from state and from backend",
+			args: []string{"foo", "--from-state", "terraform.tfstate", "--from-backend"},
+			err:  errStateSources,
+		},
+		{
+			name: "state without lineage",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(`{"version": 4, "serial": 1}`))},
+			err:  errMissingLineage,
+			assertions: func(t *testutil.T, o *newOptions) {
+				_, err := o.WorkspacesClient("default").Get(context.Background(), "foo", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
+		{
+			name: "state without serial",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(`{"version": 4, "lineage": "abc"}`))},
+			err:  errMissingSerial,
+		},
+		{
+			name: "unsupported state version",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(`{"version": 3, "serial": 1, "lineage": "abc"}`))},
+			err:  errUnsupportedStateVersion,
+		},
+		{
+			name: "invalid state",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(`not json`))},
+			err:  errInvalidState,
+		},
+		{
+			name: "state already exists",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(stateFile))},
+			objs: []runtime.Object{testobj.Secret("default", "tfstate-default-foo")},
+			err:  errStateExists,
+		},
+		{
+			name: "cleanup imported state upon error",
+			args: []string{"foo", "--from-state", testutil.TempFile(t, "terraform.tfstate", []byte(stateFile))},
+			objs: []runtime.Object{testobj.WorkspacePod("default", "foo")},
+			err:  fakeError,
+			factoryOverrides: func(f *cmdutil.Factory) {
+				f.GetLogsFunc = func(ctx context.Context, opts logstreamer.Options) (io.ReadCloser, error) {
+					return nil, fakeError
+				}
+			},
+			assertions: func(t *testutil.T, o *newOptions) {
+				_, err := o.SecretsClient("default").Get(context.Background(), "tfstate-default-foo", metav1.GetOptions{})
+				assert.True(t, kerrors.IsNotFound(err))
+			},
+		},
 		{
 			// Mock a absent/misbehaving operator
 			name: "reconcile timeout exceeded",
@@ -284,6 +585,10 @@ func TestNewWorkspace(t *testing.T) {
 			}
 			opts.status = &status
 
+			if tt.optsOverrides != nil {
+				tt.optsOverrides(opts)
+			}
+
 			err := cmd.ExecuteContext(context.Background())
 			if !assert.True(t, errors.Is(err, tt.err)) {
 				t.Logf("wanted %v but got %v", tt.err, err)
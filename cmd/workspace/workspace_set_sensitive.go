@@ -0,0 +1,125 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/util/slice"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+var (
+	errNoSensitiveVariables = errors.New("no sensitive variables to set or delete")
+)
+
+type setSensitiveOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	namespace   string
+	workspace   string
+	kubeContext string
+
+	variables       map[string]string
+	deleteVariables []string
+}
+
+func setSensitiveCmd(f *cmdutil.Factory) (*cobra.Command, *setSensitiveOptions) {
+	o := &setSensitiveOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "set-sensitive <workspace>",
+		Short: "Set sensitive variables of an etok workspace",
+		Long:  "Set or delete sensitive terraform variables of an etok workspace. Their values are stored in the workspace's variables secret rather than in the workspace, and changing the value of an existing variable only updates the secret. It requires permission to update secrets, which the etok-sensitive-variables role grants.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			o.workspace = args[0]
+
+			if len(o.variables) == 0 && len(o.deleteVariables) == 0 {
+				return errNoSensitiveVariables
+			}
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.run(cmd.Context())
+		},
+	}
+
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+
+	cmd.Flags().StringToStringVar(&o.variables, "variables", map[string]string{}, "Set sensitive terraform variables, adding to or overriding existing variables")
+	cmd.Flags().StringSliceVar(&o.deleteVariables, "delete-variables", []string{}, "Delete sensitive terraform variables with the given keys")
+
+	return cmd, o
+}
+
+func (o *setSensitiveOptions) run(ctx context.Context) error {
+	if _, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{}); err != nil {
+		return fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	// Write values before the workspace references them, and only delete
+	// values once the workspace no longer references them
+	if len(o.variables) > 0 {
+		if _, err := writeSensitiveVariables(ctx, o.Client, o.namespace, o.workspace, o.variables); err != nil {
+			return fmt.Errorf("failed to update sensitive variables: %w", err)
+		}
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		vars := o.updateVariables(append([]*v1alpha1.Variable{}, ws.Spec.Variables...))
+		if reflect.DeepEqual(ws.Spec.Variables, vars) {
+			return nil
+		}
+		ws.Spec.Variables = vars
+
+		_, err = o.WorkspacesClient(o.namespace).Update(ctx, ws, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update workspace: %w", err)
+	}
+
+	if len(o.deleteVariables) > 0 {
+		if err := deleteSensitiveVariables(ctx, o.Client, o.namespace, o.workspace, o.deleteVariables); err != nil {
+			return fmt.Errorf("failed to delete sensitive variables: %w", err)
+		}
+	}
+
+	fmt.Fprintf(o.Out, "Updated sensitive variables of workspace %s\n", klog.KRef(o.namespace, o.workspace))
+	return nil
+}
+
+// updateVariables deletes the references to deleted sensitive variables and
+// adds references to those set. Only sensitive variables are deleted.
+func (o *setSensitiveOptions) updateVariables(vars []*v1alpha1.Variable) []*v1alpha1.Variable {
+	var kept []*v1alpha1.Variable
+	for _, v := range vars {
+		if isSensitive(o.workspace, v) && slice.ContainsString(o.deleteVariables, v.Key) {
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return mergeVariables(kept, sensitiveVariables(o.workspace, o.variables))
+}
@@ -0,0 +1,126 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSetSensitiveVariables(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		objs       []runtime.Object
+		err        bool
+		out        string
+		assertions func(*testutil.T, *v1alpha1.Workspace)
+		// Assertions on the workspace's variables secret
+		secretAssertions func(*testutil.T, *corev1.Secret)
+	}{
+		{
+			name: "set",
+			args: []string{"workspace-1", "--variables", "password=secret"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithVariables("region", "eu"))},
+			out:  "Updated sensitive variables of workspace default/workspace-1\n",
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []*v1alpha1.Variable{
+					{Key: "region", Value: "eu"},
+					{Key: "password", ValueFrom: &v1alpha1.VariableSource{
+						EnvVarSource: corev1.EnvVarSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "workspace-1-variables"},
+								Key:                  "password",
+							},
+						},
+					}},
+				}, ws.Spec.Variables)
+			},
+			secretAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				assert.Equal(t, []byte("secret"), secret.Data["password"])
+			},
+		},
+		{
+			name: "change value only updates secret",
+			args: []string{"workspace-1", "--variables", "password=new"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1", testobj.WithVariablesFromSecret("workspace-1-variables", "password")),
+				testobj.Secret("default", "workspace-1-variables", testobj.WithData("password", "old"), testobj.WithData("token", "keep")),
+			},
+			out: "Updated sensitive variables of workspace default/workspace-1\n",
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 1, len(ws.Spec.Variables))
+			},
+			secretAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				assert.Equal(t, []byte("new"), secret.Data["password"])
+				assert.Equal(t, []byte("keep"), secret.Data["token"])
+			},
+		},
+		{
+			name: "delete",
+			args: []string{"workspace-1", "--delete-variables", "password"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1", testobj.WithVariables("password", "plain"), testobj.WithVariablesFromSecret("workspace-1-variables", "password", "token")),
+				testobj.Secret("default", "workspace-1-variables", testobj.WithData("password", "old"), testobj.WithData("token", "keep")),
+			},
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				require.Equal(t, 2, len(ws.Spec.Variables))
+				assert.Equal(t, "plain", ws.Spec.Variables[0].Value)
+				assert.Equal(t, "token", ws.Spec.Variables[1].Key)
+			},
+			secretAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				assert.Equal(t, map[string][]byte{"token": []byte("keep")}, secret.Data)
+			},
+		},
+		{
+			name: "no variables",
+			args: []string{"workspace-1"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			err:  true,
+		},
+		{
+			name: "without workspace",
+			args: []string{"workspace-1", "--variables", "password=secret"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			cmd, o := setSensitiveCmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			t.CheckError(tt.err, cmd.ExecuteContext(context.Background()))
+
+			if tt.out != "" {
+				assert.Equal(t, tt.out, out.String())
+			}
+
+			if tt.assertions != nil {
+				ws, err := o.WorkspacesClient("default").Get(context.Background(), "workspace-1", metav1.GetOptions{})
+				require.NoError(t, err)
+				tt.assertions(t, ws)
+			}
+
+			if tt.secretAssertions != nil {
+				secret, err := o.SecretsClient("default").Get(context.Background(), "workspace-1-variables", metav1.GetOptions{})
+				require.NoError(t, err)
+				tt.secretAssertions(t, secret)
+			}
+		})
+	}
+}
@@ -2,11 +2,10 @@ package workspace
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/leg100/etok/cmd/flags"
 	cmdutil "github.com/leg100/etok/cmd/util"
-	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/project"
 	"github.com/spf13/cobra"
 )
 
@@ -17,14 +16,18 @@ func showCmd(f *cmdutil.Factory) *cobra.Command {
 		Use:   "show",
 		Short: "Show current workspace",
 		RunE: func(cmd *cobra.Command, args []string) (err error) {
-			etokenv, err := env.Read(path)
+			etokenv, err := project.Current(path)
 			if err != nil {
-				if os.IsNotExist(err) {
-					// no .terraform/environment, so show defaults
-					fmt.Fprintf(f.Out, "%s/%s\n", defaultNamespace, defaultWorkspace)
-					return nil
-				}
-				return fmt.Errorf("failed reading contents of %s: %w", path, err)
+				return fmt.Errorf("failed reading current workspace of %s: %w", path, err)
+			}
+
+			// Show defaults where neither .terraform/environment nor etok.yaml
+			// selects a workspace
+			if etokenv.Namespace == "" {
+				etokenv.Namespace = defaultNamespace
+			}
+			if etokenv.Workspace == "" {
+				etokenv.Workspace = defaultWorkspace
 			}
 
 			fmt.Fprintln(f.Out, etokenv)
@@ -17,8 +17,10 @@ func TestWorkspaceShow(t *testing.T) {
 		name string
 		args []string
 		env  *env.Env
-		out  string
-		err  bool
+		// Contents of etok.yaml
+		config string
+		out    string
+		err    bool
 	}{
 		{
 			name: "WithEnvironmentFile",
@@ -31,11 +33,29 @@ func TestWorkspaceShow(t *testing.T) {
 			args: []string{"show"},
 			out:  "default/default\n",
 		},
+		{
+			name:   "WithProjectConfigFile",
+			args:   []string{"show"},
+			config: "workspace: networking",
+			out:    "default/networking\n",
+		},
+		{
+			name:   "EnvironmentFileOverridesProjectConfigFile",
+			args:   []string{"show"},
+			env:    &env.Env{Namespace: "default", Workspace: "workspace-1"},
+			config: "workspace: networking",
+			out:    "default/workspace-1\n",
+		},
 	}
 
 	for _, tt := range tests {
 		testutil.Run(t, tt.name, func(t *testutil.T) {
-			path := t.NewTempDir().Chdir().Root()
+			dir := t.NewTempDir().Chdir()
+			path := dir.Root()
+
+			if tt.config != "" {
+				dir.Write("etok.yaml", []byte(tt.config))
+			}
 
 			// Write .terraform/environment
 			if tt.env != nil {
@@ -0,0 +1,101 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/spf13/pflag"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+var (
+	errTemplateNotFound = errors.New("workspace template not found")
+)
+
+// templateOverrides maps the flags of workspace new to the settings they
+// override when a workspace is created from a template
+var templateOverrides = map[string]func(dst, src *v1alpha1.WorkspaceSpec){
+	"size": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.Cache.Size = src.Cache.Size
+	},
+	"storage-class": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.Cache.StorageClass = src.Cache.StorageClass
+	},
+	"terraform-version": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.TerraformVersion = src.TerraformVersion
+	},
+	"backup-bucket": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.BackupBucket = src.BackupBucket
+	},
+	"privileged-commands": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.PrivilegedCommands = src.PrivilegedCommands
+	},
+	"refuse-dirty-applies": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.RefuseDirtyApplies = src.RefuseDirtyApplies
+	},
+	"deletion-policy": func(dst, src *v1alpha1.WorkspaceSpec) {
+		dst.DeletionPolicy = src.DeletionPolicy
+	},
+}
+
+// applyTemplate sets the workspace spec to that of the template, if there is
+// one, overridden by the settings specified with flags
+func (o *newOptions) applyTemplate(ctx context.Context, fs *pflag.FlagSet) error {
+	tmpl, ref, err := o.getTemplate(ctx)
+	if err != nil || tmpl == nil {
+		return err
+	}
+
+	spec := tmpl.DeepCopy()
+	fs.Visit(func(f *pflag.Flag) {
+		if override, ok := templateOverrides[f.Name]; ok {
+			override(spec, &o.workspaceSpec)
+		}
+	})
+
+	o.workspaceSpec = *spec
+	o.templateRef = ref
+	return nil
+}
+
+// getTemplate retrieves the spec of the named template, looking first for a
+// WorkspaceTemplate in the namespace and then for a ClusterWorkspaceTemplate.
+// If no name is specified then the template named by the namespace's label is
+// retrieved. A reference to the template, in the form <kind>/<name>, is
+// returned too. Nil is returned if there is no template.
+func (o *newOptions) getTemplate(ctx context.Context) (*v1alpha1.WorkspaceSpec, string, error) {
+	name := o.template
+	if name == "" {
+		ns, err := o.KubeClient.CoreV1().Namespaces().Get(ctx, o.namespace, metav1.GetOptions{})
+		if kerrors.IsNotFound(err) || kerrors.IsForbidden(err) {
+			klog.V(1).Infof("unable to check namespace %s for a default workspace template: %s", o.namespace, err.Error())
+			return nil, "", nil
+		} else if err != nil {
+			return nil, "", err
+		}
+
+		name = ns.Labels[v1alpha1.WorkspaceTemplateLabelKey]
+		if name == "" {
+			return nil, "", nil
+		}
+	}
+
+	tmpl, err := o.WorkspaceTemplatesClient(o.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &tmpl.Spec, "WorkspaceTemplate/" + name, nil
+	} else if !kerrors.IsNotFound(err) {
+		return nil, "", fmt.Errorf("unable to get workspace template: %w", err)
+	}
+
+	ctmpl, err := o.ClusterWorkspaceTemplatesClient().Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &ctmpl.Spec, "ClusterWorkspaceTemplate/" + name, nil
+	} else if kerrors.IsNotFound(err) {
+		return nil, "", fmt.Errorf("%w: %s", errTemplateNotFound, name)
+	}
+	return nil, "", fmt.Errorf("unable to get cluster workspace template: %w", err)
+}
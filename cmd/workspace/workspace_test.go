@@ -43,6 +43,31 @@ func TestWorkspace(t *testing.T) {
 			args: []string{"delete", "-h"},
 			out:  "^Deletes an etok workspace",
 		},
+		{
+			name: "copy",
+			args: []string{"copy", "-h"},
+			out:  "^Copy an etok workspace",
+		},
+		{
+			name: "move",
+			args: []string{"move", "-h"},
+			out:  "^Rename an etok workspace",
+		},
+		{
+			name: "describe",
+			args: []string{"describe", "-h"},
+			out:  "^Describe an etok workspace",
+		},
+		{
+			name: "export",
+			args: []string{"export", "-h"},
+			out:  "^Export an etok workspace",
+		},
+		{
+			name: "import",
+			args: []string{"import", "-h"},
+			out:  "^Import etok workspaces",
+		},
 		{
 			name: "show",
 			args: []string{"show", "-h"},
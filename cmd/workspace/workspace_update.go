@@ -0,0 +1,235 @@
+package workspace
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/flags"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/client"
+	"github.com/leg100/etok/pkg/util/slice"
+	"github.com/leg100/etok/pkg/variables"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+type updateOptions struct {
+	*cmdutil.Factory
+
+	*client.Client
+
+	namespace   string
+	workspace   string
+	kubeContext string
+
+	// Flags passed by the user; only these are applied to the workspace
+	passed map[string]bool
+
+	variables            map[string]string
+	environmentVariables map[string]string
+	deleteVariables      []string
+	varFiles             []string
+	// Variables read from var files
+	fileVariables []*v1alpha1.Variable
+
+	terraformVersion   string
+	privilegedCommands []string
+	size               string
+	backupBucket       string
+	refuseDirtyApplies bool
+	deletionPolicy     string
+}
+
+func updateCmd(f *cmdutil.Factory) (*cobra.Command, *updateOptions) {
+	o := &updateOptions{
+		Factory:   f,
+		namespace: defaultNamespace,
+	}
+	cmd := &cobra.Command{
+		Use:   "update <workspace>",
+		Short: "Update an etok workspace",
+		Long:  "Update an etok workspace. Only the settings specified by flags are changed. The workspace's pod is recreated to apply a change of terraform version once no run is active.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			o.workspace = args[0]
+
+			o.passed = make(map[string]bool)
+			cmd.Flags().Visit(func(f *pflag.Flag) {
+				o.passed[f.Name] = true
+			})
+
+			if err := validateDeletionPolicy(v1alpha1.DeletionPolicy(o.deletionPolicy)); err != nil {
+				return err
+			}
+
+			if o.passed["var-file"] {
+				if o.fileVariables, err = readVarFiles(o.varFiles); err != nil {
+					return err
+				}
+			}
+
+			if o.passed["size"] {
+				if _, err := resource.ParseQuantity(o.size); err != nil {
+					return fmt.Errorf("invalid size: %w", err)
+				}
+			}
+
+			o.Client, err = f.Create(o.kubeContext)
+			if err != nil {
+				return err
+			}
+
+			return o.run(cmd.Context())
+		},
+	}
+
+	flags.AddNamespaceFlag(cmd, &o.namespace)
+	flags.AddKubeContextFlag(cmd, &o.kubeContext)
+
+	cmd.Flags().StringToStringVar(&o.variables, "variables", map[string]string{}, "Set terraform variables, adding to or overriding existing variables")
+	cmd.Flags().StringToStringVar(&o.environmentVariables, "environment-variables", map[string]string{}, "Set environment variables, adding to or overriding existing environment variables")
+	cmd.Flags().StringSliceVar(&o.deleteVariables, "delete-variables", []string{}, "Delete terraform and environment variables with the given keys. Sensitive variables are deleted with workspace set-sensitive")
+	cmd.Flags().StringArrayVar(&o.varFiles, "var-file", []string{}, "Set terraform variables from a .tfvars or .tfvars.json file, adding to or overriding existing variables. Values may be of any type. Can be specified multiple times")
+
+	cmd.Flags().StringVar(&o.terraformVersion, "terraform-version", "", "Override terraform version")
+	cmd.Flags().StringSliceVar(&o.privilegedCommands, "privileged-commands", []string{}, "Set privileged commands, replacing existing privileged commands")
+	cmd.Flags().StringVar(&o.size, "size", "", "Size of PersistentVolume for cache. It can only be increased, and only if its StorageClass permits expansion")
+	cmd.Flags().StringVar(&o.backupBucket, "backup-bucket", "", "Backup state to GCS bucket. Set to an empty string to disable backups")
+	cmd.Flags().BoolVar(&o.refuseDirtyApplies, "refuse-dirty-applies", false, "Refuse apply and destroy from a git working tree with uncommitted changes")
+	cmd.Flags().StringVar(&o.deletionPolicy, "deletion-policy", "", "What happens to state and infrastructure when the workspace is deleted: Delete, Protect, Retain, or Destroy")
+
+	return cmd, o
+}
+
+func (o *updateOptions) run(ctx context.Context) error {
+	ref := klog.KRef(o.namespace, o.workspace)
+
+	var changed bool
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		ws, err := o.WorkspacesClient(o.namespace).Get(ctx, o.workspace, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		spec := ws.Spec.DeepCopy()
+		o.updateSpec(spec)
+		if reflect.DeepEqual(&ws.Spec, spec) {
+			return nil
+		}
+		ws.Spec = *spec
+
+		if _, err := o.WorkspacesClient(o.namespace).Update(ctx, ws, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update workspace: %w", err)
+	}
+
+	if !changed {
+		fmt.Fprintf(o.Out, "Workspace %s unchanged\n", ref)
+		return nil
+	}
+	fmt.Fprintf(o.Out, "Updated workspace %s\n", ref)
+	return nil
+}
+
+// updateSpec applies the flags passed by the user to the workspace spec
+func (o *updateOptions) updateSpec(spec *v1alpha1.WorkspaceSpec) {
+	if o.passed["delete-variables"] {
+		// Sensitive variables are left alone: deleting one deletes its
+		// value from the variables secret, which is set-sensitive's job
+		var kept []*v1alpha1.Variable
+		for _, v := range spec.Variables {
+			if isSensitive(o.workspace, v) || !slice.ContainsString(o.deleteVariables, v.Key) {
+				kept = append(kept, v)
+			}
+		}
+		spec.Variables = kept
+	}
+	if o.passed["var-file"] {
+		spec.Variables = mergeVariables(spec.Variables, o.fileVariables)
+	}
+	if o.passed["variables"] {
+		spec.Variables = setVariables(spec.Variables, o.variables, false)
+	}
+	if o.passed["environment-variables"] {
+		spec.Variables = setVariables(spec.Variables, o.environmentVariables, true)
+	}
+
+	if o.passed["terraform-version"] {
+		spec.TerraformVersion = o.terraformVersion
+	}
+	if o.passed["privileged-commands"] {
+		spec.PrivilegedCommands = o.privilegedCommands
+	}
+	if o.passed["size"] {
+		spec.Cache.Size = o.size
+	}
+	if o.passed["backup-bucket"] {
+		spec.BackupBucket = o.backupBucket
+	}
+	if o.passed["refuse-dirty-applies"] {
+		spec.RefuseDirtyApplies = o.refuseDirtyApplies
+	}
+	if o.passed["deletion-policy"] {
+		spec.DeletionPolicy = v1alpha1.DeletionPolicy(o.deletionPolicy)
+	}
+}
+
+// setVariables sets variables of a kind, either terraform or environment
+// variables, overriding the value of an existing variable of the same kind and
+// key. New variables are appended in order of key.
+func setVariables(vars []*v1alpha1.Variable, set map[string]string, env bool) []*v1alpha1.Variable {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	add := make([]*v1alpha1.Variable, 0, len(keys))
+	for _, k := range keys {
+		add = append(add, &v1alpha1.Variable{Key: k, Value: set[k], EnvironmentVariable: env})
+	}
+	return mergeVariables(vars, add)
+}
+
+// mergeVariables adds variables, overriding an existing variable of the same
+// kind and key. New variables are appended in order.
+func mergeVariables(vars, add []*v1alpha1.Variable) []*v1alpha1.Variable {
+	for _, a := range add {
+		var found bool
+		for i, v := range vars {
+			if v.Key == a.Key && v.EnvironmentVariable == a.EnvironmentVariable {
+				vars[i] = a
+				found = true
+			}
+		}
+		if !found {
+			vars = append(vars, a)
+		}
+	}
+	return vars
+}
+
+// readVarFiles reads terraform variables from variable files. A variable in a
+// later file overrides one of the same key in an earlier file.
+func readVarFiles(paths []string) (vars []*v1alpha1.Variable, err error) {
+	for _, path := range paths {
+		read, err := variables.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		vars = mergeVariables(vars, read)
+	}
+	return vars, nil
+}
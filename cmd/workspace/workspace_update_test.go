@@ -0,0 +1,162 @@
+package workspace
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	cmdutil "github.com/leg100/etok/cmd/util"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestUpdateWorkspace(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		objs       []runtime.Object
+		err        bool
+		out        string
+		assertions func(*testutil.T, *v1alpha1.Workspace)
+		// Assertions on the workspace's variables secret
+		secretAssertions func(*testutil.T, *corev1.Secret)
+	}{
+		{
+			name: "variables",
+			args: []string{"workspace-1", "--variables", "foo=baz,new=val", "--environment-variables", "TF_LOG=DEBUG"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithVariables("foo", "bar", "keep", "me"), testobj.WithEnvironmentVariables("foo", "env"))},
+			out:  "Updated workspace default/workspace-1\n",
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []*v1alpha1.Variable{
+					{Key: "foo", Value: "baz"},
+					{Key: "keep", Value: "me"},
+					{Key: "foo", Value: "env", EnvironmentVariable: true},
+					{Key: "new", Value: "val"},
+					{Key: "TF_LOG", Value: "DEBUG", EnvironmentVariable: true},
+				}, ws.Spec.Variables)
+			},
+		},
+		{
+			name: "var file",
+			args: []string{"workspace-1", "--var-file", testutil.TempFile(t, "*.tfvars", []byte("foo = [\"a\", \"b\"]\n"))},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithVariables("foo", "bar", "keep", "me"))},
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []*v1alpha1.Variable{
+					{Key: "foo", Value: `["a", "b"]`, HCL: true},
+					{Key: "keep", Value: "me"},
+				}, ws.Spec.Variables)
+			},
+		},
+		{
+			name: "unsupported var file",
+			args: []string{"workspace-1", "--var-file", testutil.TempFile(t, "*.yaml", []byte("foo: bar"))},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			err:  true,
+		},
+		{
+			name: "delete variables leaves sensitive variables alone",
+			args: []string{"workspace-1", "--delete-variables", "password"},
+			objs: []runtime.Object{
+				testobj.Workspace("default", "workspace-1", testobj.WithVariablesFromSecret("workspace-1-variables", "password", "token")),
+				testobj.Secret("default", "workspace-1-variables", testobj.WithData("password", "old"), testobj.WithData("token", "keep")),
+			},
+			out: "Workspace default/workspace-1 unchanged\n",
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 2, len(ws.Spec.Variables))
+			},
+			secretAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				assert.Equal(t, []byte("old"), secret.Data["password"])
+			},
+		},
+		{
+			name: "delete variables",
+			args: []string{"workspace-1", "--delete-variables", "foo"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithVariables("foo", "bar", "keep", "me"), testobj.WithEnvironmentVariables("foo", "env"))},
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []*v1alpha1.Variable{{Key: "keep", Value: "me"}}, ws.Spec.Variables)
+			},
+		},
+		{
+			name: "settings",
+			args: []string{"workspace-1", "--terraform-version", "0.14.3", "--privileged-commands", "apply,destroy", "--size", "2Gi", "--backup-bucket", "", "--refuse-dirty-applies", "--deletion-policy", "Destroy"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithPrivilegedCommands("sh"), testobj.WithBackupBucket("backups"))},
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, "0.14.3", ws.Spec.TerraformVersion)
+				assert.Equal(t, []string{"apply", "destroy"}, ws.Spec.PrivilegedCommands)
+				assert.Equal(t, "2Gi", ws.Spec.Cache.Size)
+				assert.Equal(t, "", ws.Spec.BackupBucket)
+				assert.True(t, ws.Spec.RefuseDirtyApplies)
+				assert.Equal(t, v1alpha1.DeletionPolicyDestroy, ws.Spec.DeletionPolicy)
+			},
+		},
+		{
+			name: "unspecified settings are left alone",
+			args: []string{"workspace-1", "--terraform-version", "0.14.3"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithPrivilegedCommands("sh"), testobj.WithBackupBucket("backups"))},
+			assertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{"sh"}, ws.Spec.PrivilegedCommands)
+				assert.Equal(t, "1Gi", ws.Spec.Cache.Size)
+				assert.Equal(t, "backups", ws.Spec.BackupBucket)
+			},
+		},
+		{
+			name: "unchanged",
+			args: []string{"workspace-1", "--terraform-version", "0.14.3"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1", testobj.WithTerraformVersion("0.14.3"))},
+			out:  "Workspace default/workspace-1 unchanged\n",
+		},
+		{
+			name: "invalid size",
+			args: []string{"workspace-1", "--size", "big"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			err:  true,
+		},
+		{
+			name: "invalid deletion policy",
+			args: []string{"workspace-1", "--deletion-policy", "Obliterate"},
+			objs: []runtime.Object{testobj.Workspace("default", "workspace-1")},
+			err:  true,
+		},
+		{
+			name: "without workspace",
+			args: []string{"workspace-1", "--terraform-version", "0.14.3"},
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			out := new(bytes.Buffer)
+			f := cmdutil.NewFakeFactory(out, tt.objs...)
+
+			cmd, o := updateCmd(f)
+			cmd.SetArgs(tt.args)
+			cmd.SetOut(out)
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+
+			t.CheckError(tt.err, cmd.ExecuteContext(context.Background()))
+
+			if tt.out != "" {
+				assert.Equal(t, tt.out, out.String())
+			}
+
+			if tt.assertions != nil {
+				ws, err := o.WorkspacesClient("default").Get(context.Background(), "workspace-1", metav1.GetOptions{})
+				require.NoError(t, err)
+				tt.assertions(t, ws)
+			}
+
+			if tt.secretAssertions != nil {
+				secret, err := o.SecretsClient("default").Get(context.Background(), "workspace-1-variables", metav1.GetOptions{})
+				require.NoError(t, err)
+				tt.secretAssertions(t, secret)
+			}
+		})
+	}
+}
@@ -10,15 +10,18 @@ require (
 	github.com/fsouza/fake-gcs-server v1.22.0
 	github.com/google/go-cmp v0.5.4
 	github.com/google/goexpect v0.0.0-20200816234442-b5b77125c2c5
+	github.com/hashicorp/hcl/v2 v2.0.0
 	github.com/hashicorp/terraform-config-inspect v0.0.0-20201102131242-0c45ba392e51
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.4 // indirect
 	github.com/mattn/go-isatty v0.0.12 // indirect
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
+	github.com/open-policy-agent/opa v0.24.0
 	github.com/sergi/go-diff v1.1.0 // indirect
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1
+	github.com/zclconf/go-cty v1.1.0
 	golang.org/x/crypto v0.0.0-20200728195943-123391ffb6de
 	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 	google.golang.org/api v0.36.0
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/leg100/etok/pkg/util/path"
+	"github.com/leg100/etok/pkg/util/slice"
 	"k8s.io/klog/v2"
 )
 
@@ -18,6 +19,20 @@ type archive struct {
 	root string
 	// Absolute paths to local modules on client, including root module
 	mods []string
+	// Absolute paths to files and directories on client, other than modules,
+	// to be included
+	includes []string
+	// Rules for paths not to be included, in addition to those of
+	// .terraformignore
+	excludes []rule
+	// Warnings of paths referenced in modules that could not be determined
+	warnings []string
+	// Vendor remote git modules into the archive
+	vendor bool
+	// Directories mapped to other paths in the archive, e.g. vendored modules
+	overlays []overlay
+	// Temporary directories to remove upon closing the archive
+	tmpdirs []string
 	// Common prefix shared by all modules
 	base string
 	// Maximum permitted size of compressed archive
@@ -49,6 +64,18 @@ func MaxSize(size int64) func(*archive) {
 	}
 }
 
+// Exclude excludes paths matching the patterns from the archive. The patterns
+// follow the syntax of .terraformignore.
+func Exclude(patterns ...string) func(*archive) {
+	return func(a *archive) {
+		for _, p := range patterns {
+			if r, ok := parseRule(p); ok {
+				a.excludes = append(a.excludes, r)
+			}
+		}
+	}
+}
+
 // Walk returns a list of local modules starting with the root module, including
 // those called from the root module, directly and indirectly.
 func (a *archive) Walk() error {
@@ -59,8 +86,84 @@ func (a *archive) Walk() error {
 	// Add modules to archive's modules
 	a.mods = append(a.mods, mods...)
 
+	if a.vendor {
+		if err := a.vendorModules(); err != nil {
+			return err
+		}
+	}
+
+	// Add paths referenced in modules' expressions, e.g. file("../foo.json")
+	for _, mod := range a.mods {
+		paths, warnings, err := findPaths(mod, a.root)
+		if err != nil {
+			return err
+		}
+		a.includes = appendUnique(a.includes, paths...)
+		a.warnings = append(a.warnings, warnings...)
+	}
+
 	// Now that we've walked all modules their common prefix can be determined
-	a.base, err = path.CommonPrefix(a.mods)
+	return a.setBase()
+}
+
+// Close removes any temporary files created for the archive.
+func (a *archive) Close() error {
+	for _, dir := range a.tmpdirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Warnings returns warnings of paths referenced in modules that could not be
+// determined, and thus have not been added to the archive.
+func (a *archive) Warnings() []string {
+	return a.warnings
+}
+
+// Include adds files and directories to the archive, in addition to modules.
+// The paths must exist.
+func (a *archive) Include(paths ...string) error {
+	for _, p := range paths {
+		p, err := path.EnsureAbs(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(p); err != nil {
+			return fmt.Errorf("unable to include path: %w", err)
+		}
+		a.includes = appendUnique(a.includes, p)
+	}
+
+	return a.setBase()
+}
+
+// ArchivePath returns the path of a file or directory within the archive
+// relative to the root module, i.e. the path by which it is referenced on the
+// pod.
+func (a *archive) ArchivePath(p string) (string, error) {
+	p, err := path.EnsureAbs(filepath.Clean(p))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(a.root, p)
+}
+
+// appendUnique appends paths not already present
+func appendUnique(paths []string, add ...string) []string {
+	for _, p := range add {
+		if !slice.ContainsString(paths, p) {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// setBase sets the base directory of the archive, the common prefix of all its
+// paths.
+func (a *archive) setBase() (err error) {
+	a.base, err = path.CommonPrefix(append(append([]string{}, a.mods...), a.includes...))
 	if err != nil {
 		return err
 	}
@@ -96,13 +199,14 @@ func (a *archive) Pack(w io.Writer) (*Meta, error) {
 
 	// Create an ignore rule matcher. Parses .terraformignore if exists.
 	ruleMatcher := newRuleMatcher(a.base)
+	ruleMatcher.rules = append(append([]rule{}, ruleMatcher.rules...), a.excludes...)
 
 	// Track the metadata details as we go.
 	meta := &Meta{}
 
 	// Remove nested modules (they're walked recursively so we want to avoid
 	// walking paths more than once)
-	unnested := path.RemoveNestedPaths(a.mods)
+	unnested := path.RemoveNestedPaths(append(append([]string{}, a.mods...), a.includes...))
 
 	// Walk directory trees
 	for _, path := range unnested {
@@ -112,6 +216,14 @@ func (a *archive) Pack(w io.Writer) (*Meta, error) {
 		}
 	}
 
+	// Walk directories that assume other paths in the archive
+	for _, o := range a.overlays {
+		err := filepath.Walk(o.src, packWalkFn(a.base, o.src, o.dst, tw, meta, true, ruleMatcher))
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Flush tar writer
 	if err := tw.Close(); err != nil {
 		return nil, fmt.Errorf("failed to close tar writer: %w", err)
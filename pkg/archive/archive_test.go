@@ -74,6 +74,88 @@ func TestArchive(t *testing.T) {
 	}, files)
 }
 
+func TestInclude(t *testing.T) {
+	arc, err := NewArchive("testdata/config-dir/m0")
+	require.NoError(t, err)
+
+	// Include a file outside of any module
+	require.NoError(t, arc.Include("testdata/config-dir/globals.tf"))
+
+	// Path to file relative to root module
+	archivePath, err := arc.ArchivePath("testdata/config-dir/globals.tf")
+	require.NoError(t, err)
+	assert.Equal(t, "../globals.tf", archivePath)
+
+	// Root module is no longer at the base of the archive
+	root, err := arc.RootPath()
+	require.NoError(t, err)
+	assert.Equal(t, "m0", root)
+
+	w := new(bytes.Buffer)
+	meta, err := arc.Pack(w)
+	require.NoError(t, err)
+	assert.Contains(t, meta.Files, "globals.tf")
+	assert.Contains(t, meta.Files, "m0/main.tf")
+
+	// Paths must exist
+	assert.Error(t, arc.Include("testdata/config-dir/missing.tfvars"))
+}
+
+func TestExclude(t *testing.T) {
+	arc, err := NewArchive("testdata/config-dir/m0", Exclude("*.txt", "sub/"))
+	require.NoError(t, err)
+
+	w := new(bytes.Buffer)
+	meta, err := arc.Pack(w)
+	require.NoError(t, err)
+	assert.Contains(t, meta.Files, "main.tf")
+	assert.NotContains(t, meta.Files, "bar.txt")
+	assert.NotContains(t, meta.Files, "sub/zip.txt")
+}
+
+func TestWalkPaths(t *testing.T) {
+	arc, err := NewArchive("testdata/paths-dir/root")
+	require.NoError(t, err)
+
+	require.NoError(t, arc.Walk())
+
+	got, err := path.RelToWorkingDir(arc.includes)
+	require.NoError(t, err)
+	sort.Strings(got)
+
+	assert.Equal(t, []string{
+		"testdata/paths-dir/policies/policy.json",
+		"testdata/paths-dir/root/templates/user.tpl",
+		"testdata/paths-dir/scripts",
+	}, got)
+
+	if assert.Equal(t, 2, len(arc.Warnings())) {
+		assert.Contains(t, arc.Warnings()[0], "main.tf:5,18-26: unable to determine path referenced by file()")
+		assert.Contains(t, arc.Warnings()[1], "main.tf:6,18-32: path referenced by file() does not exist")
+	}
+
+	root, err := arc.RootPath()
+	require.NoError(t, err)
+	assert.Equal(t, "root", root)
+}
+
+func TestFindPathsSkipsUnparseableFiles(t *testing.T) {
+	testutil.Run(t, "unparseable file", func(t *testutil.T) {
+		root := t.NewTempDir().
+			Write("main.tf", []byte("locals {\n  policy = file(\"${path.module}/policy.json\")\n}\n")).
+			Write("invalid.tf", []byte("locals {\n")).
+			Write("policy.json", []byte("{}")).
+			Root()
+
+		paths, warnings, err := findPaths(root, root)
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(root, "policy.json")}, paths)
+		if assert.Equal(t, 1, len(warnings)) {
+			assert.Contains(t, warnings[0], "unable to analyse invalid.tf for referenced paths")
+		}
+	})
+}
+
 func TestMaxSize(t *testing.T) {
 	tmpdir := testutil.NewTempDir(t).Chdir().WriteRandomFile("toobig", MaxConfigSize+1)
 
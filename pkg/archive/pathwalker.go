@@ -0,0 +1,164 @@
+package archive
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/leg100/etok/pkg/util/slice"
+	"github.com/zclconf/go-cty/cty"
+	"k8s.io/klog/v2"
+)
+
+// Functions whose first argument is a path to a file or directory
+var pathFunctions = []string{
+	"file",
+	"filebase64",
+	"filebase64sha256",
+	"filebase64sha512",
+	"fileexists",
+	"filemd5",
+	"fileset",
+	"filesha1",
+	"filesha256",
+	"filesha512",
+	"templatefile",
+}
+
+// findPaths statically analyses the HCL expressions of a module for paths to
+// files and directories, returning those that exist. Paths are sought in the
+// first argument of functions such as file() and templatefile(), and in
+// string templates that reference path.module or path.root. Expressions that
+// cannot be evaluated without a full terraform evaluation, e.g. those
+// referencing variables, are reported as warnings, as are files that cannot be
+// parsed, which are skipped and left for terraform to report. Files written in
+// JSON (*.tf.json) are not analysed.
+func findPaths(mod, root string) (paths []string, warnings []string, err error) {
+	files, err := filepath.Glob(filepath.Join(mod, "*.tf"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := pathEvalContext(mod, root)
+
+	for _, fname := range files {
+		src, err := ioutil.ReadFile(fname)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Report filenames relative to the root module
+		relname, err := filepath.Rel(root, fname)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		file, diags := hclsyntax.ParseConfig(src, relname, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			warnings = append(warnings, fmt.Sprintf("unable to analyse %s for referenced paths: %s", relname, diags.Error()))
+			continue
+		}
+
+		// Ranges of expressions already analysed, to avoid analysing
+		// templates nested within function calls twice
+		analysed := make(map[hcl.Range]bool)
+
+		hclsyntax.VisitAll(file.Body.(*hclsyntax.Body), func(node hclsyntax.Node) hcl.Diagnostics {
+			var expr hclsyntax.Expression
+			// Description of the reference to the path
+			var ref string
+			// Whether the path is referenced by a template
+			var isTemplate bool
+
+			switch n := node.(type) {
+			case *hclsyntax.FunctionCallExpr:
+				if !slice.ContainsString(pathFunctions, n.Name) || len(n.Args) == 0 {
+					return nil
+				}
+				expr, ref = n.Args[0], n.Name+"()"
+			case *hclsyntax.TemplateExpr:
+				if !referencesPath(n) {
+					return nil
+				}
+				expr, ref, isTemplate = n, "path.module or path.root", true
+			default:
+				return nil
+			}
+
+			if analysed[expr.Range()] {
+				return nil
+			}
+			analysed[expr.Range()] = true
+
+			path, ok := evaluatePath(ctx, expr, root)
+			if !ok {
+				warnings = append(warnings, fmt.Sprintf("%s: unable to determine path referenced by %s", expr.Range().String(), ref))
+				return nil
+			}
+			if _, err := os.Stat(path); err != nil {
+				// Only warn of a missing path passed to a function; a
+				// template may well construct the path of a file that is yet
+				// to be created
+				if !isTemplate {
+					warnings = append(warnings, fmt.Sprintf("%s: path referenced by %s does not exist: %s", expr.Range().String(), ref, path))
+				}
+				return nil
+			}
+
+			klog.V(2).Infof("adding path referenced in %s to archive: %s", fname, path)
+			paths = append(paths, path)
+			return nil
+		})
+	}
+
+	return paths, warnings, nil
+}
+
+// pathEvalContext returns an evaluation context in which only the path
+// attributes are defined.
+func pathEvalContext(mod, root string) *hcl.EvalContext {
+	return &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"path": cty.ObjectVal(map[string]cty.Value{
+				"module": cty.StringVal(mod),
+				"root":   cty.StringVal(root),
+				"cwd":    cty.StringVal(root),
+			}),
+		},
+	}
+}
+
+// evaluatePath statically evaluates an expression for a path. A relative path
+// is relative to the root module, which is terraform's working directory.
+// False is returned if the expression cannot be evaluated to a string.
+func evaluatePath(ctx *hcl.EvalContext, expr hclsyntax.Expression, root string) (string, bool) {
+	val, diags := expr.Value(ctx)
+	if diags.HasErrors() || !val.IsWhollyKnown() || val.IsNull() || val.Type() != cty.String {
+		return "", false
+	}
+
+	path := val.AsString()
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	return filepath.Clean(path), true
+}
+
+// referencesPath determines whether a template references path.module or
+// path.root
+func referencesPath(tmpl *hclsyntax.TemplateExpr) bool {
+	for _, traversal := range tmpl.Variables() {
+		if traversal.RootName() != "path" || len(traversal) < 2 {
+			continue
+		}
+		if attr, ok := traversal[1].(hcl.TraverseAttr); ok {
+			if attr.Name == "module" || attr.Name == "root" {
+				return true
+			}
+		}
+	}
+	return false
+}
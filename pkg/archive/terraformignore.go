@@ -33,38 +33,9 @@ func readRules(input io.Reader) []rule {
 	scanner.Split(bufio.ScanLines)
 
 	for scanner.Scan() {
-		pattern := scanner.Text()
-		// Ignore blank lines
-		if len(pattern) == 0 {
-			continue
+		if rule, ok := parseRule(scanner.Text()); ok {
+			rules = append(rules, rule)
 		}
-		// Trim spaces
-		pattern = strings.TrimSpace(pattern)
-		// Ignore comments
-		if pattern[0] == '#' {
-			continue
-		}
-		// New rule structure
-		rule := rule{}
-		// Exclusions
-		if pattern[0] == '!' {
-			rule.excluded = true
-			pattern = pattern[1:]
-		}
-		// If it is a directory, add ** so we catch descendants
-		if pattern[len(pattern)-1] == os.PathSeparator {
-			pattern = pattern + "**"
-		}
-		// If it starts with /, it is absolute
-		if pattern[0] == os.PathSeparator {
-			pattern = pattern[1:]
-		} else {
-			// Otherwise prepend **/
-			pattern = "**" + string(os.PathSeparator) + pattern
-		}
-		rule.val = pattern
-		rule.dirs = strings.Split(pattern, string(os.PathSeparator))
-		rules = append(rules, rule)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -74,6 +45,42 @@ func readRules(input io.Reader) []rule {
 	return rules
 }
 
+// parseRule parses a line of an ignore file. False is returned if the line is
+// blank or a comment.
+func parseRule(pattern string) (rule, bool) {
+	// Ignore blank lines
+	if len(pattern) == 0 {
+		return rule{}, false
+	}
+	// Trim spaces
+	pattern = strings.TrimSpace(pattern)
+	// Ignore comments
+	if len(pattern) == 0 || pattern[0] == '#' {
+		return rule{}, false
+	}
+	// New rule structure
+	r := rule{}
+	// Exclusions
+	if pattern[0] == '!' {
+		r.excluded = true
+		pattern = pattern[1:]
+	}
+	// If it is a directory, add ** so we catch descendants
+	if pattern[len(pattern)-1] == os.PathSeparator {
+		pattern = pattern + "**"
+	}
+	// If it starts with /, it is absolute
+	if pattern[0] == os.PathSeparator {
+		pattern = pattern[1:]
+	} else {
+		// Otherwise prepend **/
+		pattern = "**" + string(os.PathSeparator) + pattern
+	}
+	r.val = pattern
+	r.dirs = strings.Split(pattern, string(os.PathSeparator))
+	return r, true
+}
+
 func matchIgnoreRule(path string, rules []rule) bool {
 	matched := false
 	path = filepath.FromSlash(path)
@@ -0,0 +1,10 @@
+locals {
+  policy  = file("${path.module}/../policies/policy.json")
+  user    = templatefile("templates/user.tpl", { name = "foo" })
+  scripts = fileset("${path.root}/../scripts", "*.sh")
+  dynamic = file(var.path)
+  missing = file("missing.json")
+  output  = "${path.module}/../build/output.zip"
+}
+
+variable "path" {}
@@ -0,0 +1,300 @@
+package archive
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Directory, relative to the root module in the archive, to which remote
+	// modules are vendored
+	vendorDir = ".etok/modules"
+
+	// Name of the override file generated to point module calls at vendored
+	// modules
+	vendorOverrideFile = "etok_vendor_override.tf"
+)
+
+// overlay maps a directory on the client to a path in the archive other than
+// its own
+type overlay struct {
+	// Absolute path to directory on client
+	src string
+	// Absolute path that the directory assumes in the archive, as if it were
+	// on the client
+	dst string
+}
+
+// vendoredModule is a module in a git repository cloned to the client
+type vendoredModule struct {
+	// Path to module on client
+	src string
+	// Path to module in the archive, as if it were on the client
+	dst string
+}
+
+// vendorer clones remote git modules on the client, so that the pod need not
+// fetch them itself.
+type vendorer struct {
+	// Temporary directory to which repositories are cloned
+	tmpdir string
+	// Path on client that the tmpdir assumes in the archive
+	dst string
+	// Cloned repositories, keyed by repository URL and ref
+	clones map[string]string
+}
+
+// VendorModules is an option to vendor remote git modules into the archive.
+func VendorModules(vendor bool) func(*archive) {
+	return func(a *archive) {
+		a.vendor = vendor
+	}
+}
+
+// vendorModules vendors the remote git modules called by the archive's
+// modules, and those called by the vendored modules, recursively. The module
+// calls are pointed at the vendored modules by generated override files.
+func (a *archive) vendorModules() error {
+	tmpdir, err := ioutil.TempDir("", "etok-vendor-")
+	if err != nil {
+		return err
+	}
+	a.tmpdirs = append(a.tmpdirs, tmpdir)
+
+	v := &vendorer{
+		tmpdir: filepath.Join(tmpdir, "modules"),
+		dst:    filepath.Join(a.root, vendorDir),
+		clones: make(map[string]string),
+	}
+
+	// Modules to check for remote module calls: the archive's modules, which
+	// are found at the same path in the archive, followed by any modules
+	// that are vendored.
+	var queue []vendoredModule
+	queued := make(map[string]bool)
+	enqueue := func(mod vendoredModule) {
+		if !queued[mod.src] {
+			queue = append(queue, mod)
+			queued[mod.src] = true
+		}
+	}
+	for _, mod := range a.mods {
+		enqueue(vendoredModule{src: mod, dst: mod})
+	}
+
+	for i := 0; i < len(queue); i++ {
+		mod := queue[i]
+
+		calls, err := moduleCalls(mod.src)
+		if err != nil {
+			return err
+		}
+
+		// Map of call name to vendored module path relative to the calling
+		// module
+		overrides := make(map[string]string)
+		for _, mc := range calls {
+			repo, subdir, ref, ok := parseGitSource(mc.Source)
+			if !ok {
+				continue
+			}
+
+			clone, err := v.clone(repo, ref)
+			if err != nil {
+				return fmt.Errorf("unable to vendor module %s: %w", mc.Name, err)
+			}
+			vendored := v.module(filepath.Join(clone, subdir))
+
+			source, err := filepath.Rel(mod.dst, vendored.dst)
+			if err != nil {
+				return err
+			}
+			if !strings.HasPrefix(source, "../") {
+				source = "./" + source
+			}
+			overrides[mc.Name] = source
+			klog.V(1).Infof("vendored module %s: %s", mc.Name, mc.Source)
+
+			if !queued[vendored.src] {
+				// Check the vendored module for remote calls, along with any
+				// local modules it calls
+				enqueue(vendored)
+				local, err := walk(vendored.src)
+				if err != nil {
+					return err
+				}
+				for _, l := range local {
+					enqueue(v.module(l))
+				}
+			}
+		}
+
+		if len(overrides) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(mod.src, v.tmpdir) {
+			// Vendored modules are our own copy, so write the override file
+			// directly
+			if err := writeOverrideFile(mod.src, overrides); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Otherwise write the override file to a directory that overlays the
+		// module in the archive
+		dir, err := ioutil.TempDir(tmpdir, "override-")
+		if err != nil {
+			return err
+		}
+		if err := writeOverrideFile(dir, overrides); err != nil {
+			return err
+		}
+		a.overlays = append(a.overlays, overlay{src: dir, dst: mod.dst})
+	}
+
+	if len(v.clones) > 0 {
+		a.overlays = append(a.overlays, overlay{src: v.tmpdir, dst: v.dst})
+	}
+
+	return nil
+}
+
+// clone clones a git repository and checks out a ref, returning the path to
+// the clone. If the repository and ref have already been cloned then the
+// existing clone is returned.
+func (v *vendorer) clone(repo, ref string) (string, error) {
+	key := repo + "?ref=" + ref
+	if dir, ok := v.clones[key]; ok {
+		return dir, nil
+	}
+
+	// Name clone after hash of repository and ref
+	hash := sha1.Sum([]byte(key))
+	dir := filepath.Join(v.tmpdir, hex.EncodeToString(hash[:])[:10])
+
+	// Use the client's git, and thus its credentials
+	if err := runGit("clone", "--quiet", repo, dir); err != nil {
+		return "", err
+	}
+	if ref != "" {
+		if err := runGit("-C", dir, "checkout", "--quiet", ref); err != nil {
+			return "", err
+		}
+	}
+
+	// Git metadata is not needed on the pod
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return "", err
+	}
+
+	v.clones[key] = dir
+	return dir, nil
+}
+
+// module returns a vendored module given its path in the tmpdir
+func (v *vendorer) module(path string) vendoredModule {
+	return vendoredModule{
+		src: path,
+		dst: filepath.Join(v.dst, strings.TrimPrefix(path, v.tmpdir)),
+	}
+}
+
+func runGit(args ...string) error {
+	out, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// moduleCalls returns a module's calls, in order of name
+func moduleCalls(path string) ([]*tfconfig.ModuleCall, error) {
+	mod, diag := tfconfig.LoadModule(path)
+	if diag.HasErrors() {
+		return nil, diag.Err()
+	}
+	var calls []*tfconfig.ModuleCall
+	for _, mc := range mod.ModuleCalls {
+		calls = append(calls, mc)
+	}
+	sort.Slice(calls, func(i, j int) bool { return calls[i].Name < calls[j].Name })
+	return calls, nil
+}
+
+// writeOverrideFile writes an override file to a directory, setting the source
+// of each module call to a path.
+func writeOverrideFile(dir string, sources map[string]string) error {
+	var names []string
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# Generated by etok: module calls point at vendored modules\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "\nmodule %q {\n  source = %q\n}\n", name, sources[name])
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, vendorOverrideFile), []byte(b.String()), 0644)
+}
+
+// parseGitSource parses a module source for a git repository, returning the
+// repository URL, the subdirectory within the repository, and the ref to
+// checkout. False is returned if the source is not a git repository. See:
+// https://www.terraform.io/docs/modules/sources.html
+func parseGitSource(source string) (repo, subdir, ref string, ok bool) {
+	var github bool
+	switch {
+	case strings.HasPrefix(source, "git::"):
+		source = strings.TrimPrefix(source, "git::")
+	case strings.HasPrefix(source, "git@"):
+		// SCP-like syntax
+	case strings.HasPrefix(source, "github.com/"):
+		// GitHub shorthand
+		source = "https://" + source
+		github = true
+	default:
+		return "", "", "", false
+	}
+
+	// Separate query string
+	if i := strings.Index(source, "?"); i >= 0 {
+		query, err := url.ParseQuery(source[i+1:])
+		if err != nil {
+			return "", "", "", false
+		}
+		ref = query.Get("ref")
+		source = source[:i]
+	}
+
+	// Separate subdirectory, which follows a double slash after any scheme
+	start := 0
+	if i := strings.Index(source, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	if i := strings.Index(source[start:], "//"); i >= 0 {
+		subdir = source[start+i+2:]
+		source = source[:start+i]
+	}
+
+	if github && !strings.HasSuffix(source, ".git") {
+		// GitHub shorthand omits the .git suffix
+		source += ".git"
+	}
+
+	return source, subdir, ref, true
+}
@@ -0,0 +1,163 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVendorModules(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	// Create a git repository containing two modules, one of which calls the
+	// other, and clone it to a bare repository to act as the remote.
+	work := testutil.NewTempDir(t)
+	bare := filepath.Join(testutil.NewTempDir(t).Root(), "modules.git")
+	work.WriteFiles(map[string][]byte{
+		"modules/vpc/main.tf": []byte(fmt.Sprintf(`
+module "subnet" {
+  source = "git::file://%s//modules/subnet?ref=v1"
+}
+`, bare)),
+		"modules/subnet/main.tf": []byte(`resource "null_resource" "subnet" {}`),
+	})
+	git := func(args ...string) {
+		require.NoError(t, runGit(append([]string{"-C", work.Root(), "-c", "user.name=etok", "-c", "user.email=etok@example.com"}, args...)...))
+	}
+	git("init", "--quiet")
+	git("add", ".")
+	git("commit", "--quiet", "-m", "modules")
+	git("tag", "v1")
+	require.NoError(t, runGit("clone", "--quiet", "--bare", work.Root(), bare))
+
+	// Root module calls the remote module
+	root := testutil.NewTempDir(t).WriteFiles(map[string][]byte{
+		"root/main.tf": []byte(fmt.Sprintf(`
+module "vpc" {
+  source = "git::file://%s//modules/vpc?ref=v1"
+}
+`, bare)),
+	})
+
+	arc, err := NewArchive(root.Path("root"), VendorModules(true))
+	require.NoError(t, err)
+	defer arc.Close()
+
+	require.NoError(t, arc.Walk())
+
+	tarball := new(bytes.Buffer)
+	_, err = arc.Pack(tarball)
+	require.NoError(t, err)
+
+	dst := testutil.NewTempDir(t)
+	require.NoError(t, Unpack(tarball, dst.Root()))
+
+	// Vendored modules are found within the root module, which is therefore
+	// at the base of the archive
+	rootPath, err := arc.RootPath()
+	require.NoError(t, err)
+	require.Equal(t, ".", rootPath)
+
+	// Root module calls the vendored vpc module
+	override, err := ioutil.ReadFile(dst.Path(vendorOverrideFile))
+	require.NoError(t, err)
+	assert.Regexp(t, `module "vpc" {\s+source = "./.etok/modules/[0-9a-f]+/modules/vpc"\s+}`, string(override))
+
+	// Original config is left intact
+	assert.FileExists(t, dst.Path("main.tf"))
+
+	clones, err := filepath.Glob(dst.Path(filepath.Join(vendorDir, "*")))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(clones))
+
+	// Vendored vpc module calls the vendored subnet module in the same
+	// repository
+	override, err = ioutil.ReadFile(filepath.Join(clones[0], "modules/vpc", vendorOverrideFile))
+	require.NoError(t, err)
+	assert.Regexp(t, `module "subnet" {\s+source = "../subnet"\s+}`, string(override))
+	assert.FileExists(t, filepath.Join(clones[0], "modules/subnet/main.tf"))
+
+	// Git metadata is not uploaded
+	assert.NoDirExists(t, filepath.Join(clones[0], ".git"))
+
+	// Temporary files are removed
+	require.NoError(t, arc.Close())
+	for _, dir := range arc.tmpdirs {
+		assert.NoDirExists(t, dir)
+	}
+}
+
+func TestParseGitSource(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		repo   string
+		subdir string
+		ref    string
+		ok     bool
+	}{
+		{
+			name:   "generic git",
+			source: "git::https://example.com/vpc.git",
+			repo:   "https://example.com/vpc.git",
+			ok:     true,
+		},
+		{
+			name:   "generic git with subdir and ref",
+			source: "git::https://example.com/network.git//modules/vpc?ref=v1.2.0",
+			repo:   "https://example.com/network.git",
+			subdir: "modules/vpc",
+			ref:    "v1.2.0",
+			ok:     true,
+		},
+		{
+			name:   "local file",
+			source: "git::file:///tmp/network.git//modules/vpc?ref=v1",
+			repo:   "file:///tmp/network.git",
+			subdir: "modules/vpc",
+			ref:    "v1",
+			ok:     true,
+		},
+		{
+			name:   "scp-like",
+			source: "git@github.com:hashicorp/example.git//modules/vpc",
+			repo:   "git@github.com:hashicorp/example.git",
+			subdir: "modules/vpc",
+			ok:     true,
+		},
+		{
+			name:   "github shorthand",
+			source: "github.com/hashicorp/example?ref=main",
+			repo:   "https://github.com/hashicorp/example.git",
+			ref:    "main",
+			ok:     true,
+		},
+		{
+			name:   "local path",
+			source: "../modules/vpc",
+		},
+		{
+			name:   "registry",
+			source: "hashicorp/consul/aws",
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			repo, subdir, ref, ok := parseGitSource(tt.source)
+			assert.Equal(t, tt.repo, repo)
+			assert.Equal(t, tt.subdir, subdir)
+			assert.Equal(t, tt.ref, ref)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
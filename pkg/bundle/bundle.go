@@ -0,0 +1,186 @@
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"golang.org/x/crypto/scrypt"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Bundle package handles workspace bundles: self-contained exports of one or
+// more workspaces, from which they can be recreated in another namespace or
+// cluster. A bundle is gzipped JSON, optionally encrypted with a key derived
+// from a passphrase.
+
+const (
+	// Version of the bundle format
+	Version = 1
+
+	saltSize = 16
+)
+
+var (
+	// Prefix identifying an encrypted bundle
+	encryptedHeader = []byte("etok-bundle-encrypted\n")
+
+	ErrPassphraseRequired = errors.New("bundle is encrypted: a passphrase is required")
+	ErrDecrypt            = errors.New("unable to decrypt bundle: wrong passphrase or corrupt bundle")
+	ErrUnsupportedVersion = errors.New("unsupported bundle version")
+)
+
+// Bundle is the contents of a bundle
+type Bundle struct {
+	Version int `json:"version"`
+
+	Workspaces []Workspace `json:"workspaces"`
+}
+
+// Workspace is a workspace along with the resources necessary to recreate it
+type Workspace struct {
+	// The workspace, including its spec and variables. Its status, including
+	// outputs, is retained for reference.
+	Workspace v1alpha1.Workspace `json:"workspace"`
+
+	// The workspace's state secret. Nil if the workspace has no state.
+	State *corev1.Secret `json:"state,omitempty"`
+
+	// Secrets referenced by the workspace
+	Secrets []corev1.Secret `json:"secrets,omitempty"`
+
+	// Config map containing the archive of the workspace's most recent run
+	Archive *corev1.ConfigMap `json:"archive,omitempty"`
+
+	// Config map containing the lock file of the workspace's most recent run
+	// to write one
+	LockFile *corev1.ConfigMap `json:"lockFile,omitempty"`
+}
+
+// Write writes a bundle to w. If passphrase is non-empty then the bundle is
+// encrypted.
+func Write(w io.Writer, b *Bundle, passphrase []byte) error {
+	b.Version = Version
+
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	if err := json.NewEncoder(gw).Encode(b); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	data := buf.Bytes()
+	if len(passphrase) > 0 {
+		var err error
+		data, err = encrypt(data, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+// Read reads a bundle from r. The passphrase is only required if the bundle is
+// encrypted.
+func Read(r io.Reader, passphrase []byte) (*Bundle, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, encryptedHeader) {
+		if len(passphrase) == 0 {
+			return nil, ErrPassphraseRequired
+		}
+		data, err = decrypt(data[len(encryptedHeader):], passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read bundle: %w", err)
+	}
+
+	var b Bundle
+	if err := json.NewDecoder(gr).Decode(&b); err != nil {
+		return nil, fmt.Errorf("unable to read bundle: %w", err)
+	}
+	if b.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, b.Version)
+	}
+	return &b, nil
+}
+
+// encrypt encrypts data with AES-GCM, using a key derived from the passphrase.
+// The header, salt and nonce are prepended to the ciphertext.
+func encrypt(data, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, encryptedHeader...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return gcm.Seal(out, nonce, data, nil), nil
+}
+
+// decrypt decrypts data encrypted by encrypt, less its header
+func decrypt(data, passphrase []byte) ([]byte, error) {
+	if len(data) < saltSize {
+		return nil, ErrDecrypt
+	}
+	salt, data := data[:saltSize], data[saltSize:]
+
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, data := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+func newGCM(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
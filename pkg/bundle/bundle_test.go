@@ -0,0 +1,85 @@
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBundle(t *testing.T) {
+	tests := []struct {
+		name string
+		// Passphrase with which to write bundle
+		writePassphrase string
+		// Passphrase with which to read bundle
+		readPassphrase string
+		err            error
+	}{
+		{
+			name: "unencrypted",
+		},
+		{
+			name:            "encrypted",
+			writePassphrase: "secret",
+			readPassphrase:  "secret",
+		},
+		{
+			name:           "unencrypted with passphrase",
+			readPassphrase: "secret",
+		},
+		{
+			name:            "wrong passphrase",
+			writePassphrase: "secret",
+			readPassphrase:  "guess",
+			err:             ErrDecrypt,
+		},
+		{
+			name:            "missing passphrase",
+			writePassphrase: "secret",
+			err:             ErrPassphraseRequired,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			b := &Bundle{
+				Workspaces: []Workspace{
+					{
+						Workspace: *testobj.Workspace("default", "foo", testobj.WithVariables("region", "eu")),
+						State:     testobj.Secret("default", "tfstate-default-foo", testobj.WithData("tfstate", "state")),
+					},
+				},
+			}
+
+			buf := new(bytes.Buffer)
+			require.NoError(t, Write(buf, b, []byte(tt.writePassphrase)))
+
+			got, err := Read(buf, []byte(tt.readPassphrase))
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			assert.Equal(t, Version, got.Version)
+			assert.Equal(t, b.Workspaces, got.Workspaces)
+		})
+	}
+}
+
+func TestUnsupportedVersion(t *testing.T) {
+	buf := new(bytes.Buffer)
+	gw := gzip.NewWriter(buf)
+	require.NoError(t, json.NewEncoder(gw).Encode(&Bundle{Version: 99}))
+	require.NoError(t, gw.Close())
+
+	_, err := Read(buf, nil)
+	assert.True(t, errors.Is(err, ErrUnsupportedVersion))
+}
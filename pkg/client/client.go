@@ -1,11 +1,18 @@
 package client
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/pkg/k8s/etokclient"
 	etoktyped "github.com/leg100/etok/pkg/k8s/etokclient/typed/etok.dev/v1alpha1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
 	runtimeclient "sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -44,6 +51,32 @@ func (c *Client) WorkspacesClient(namespace string) etoktyped.WorkspaceInterface
 	return c.EtokClient.EtokV1alpha1().Workspaces(namespace)
 }
 
+func (c *Client) WorkspaceTemplatesClient(namespace string) etoktyped.WorkspaceTemplateInterface {
+	return c.EtokClient.EtokV1alpha1().WorkspaceTemplates(namespace)
+}
+
+func (c *Client) ClusterWorkspaceTemplatesClient() etoktyped.ClusterWorkspaceTemplateInterface {
+	return c.EtokClient.EtokV1alpha1().ClusterWorkspaceTemplates()
+}
+
+func (c *Client) VariableSetsClient(namespace string) etoktyped.VariableSetInterface {
+	return c.EtokClient.EtokV1alpha1().VariableSets(namespace)
+}
+
 func (c *Client) RunsClient(namespace string) etoktyped.RunInterface {
 	return c.EtokClient.EtokV1alpha1().Runs(namespace)
 }
+
+// ListVariableSets lists the variable sets in a namespace. A user lacking
+// permission to list variable sets, or a cluster lacking the variable set CRD,
+// gets no variable sets rather than an error.
+func (c *Client) ListVariableSets(ctx context.Context, namespace string) ([]v1alpha1.VariableSet, error) {
+	list, err := c.VariableSetsClient(namespace).List(ctx, metav1.ListOptions{})
+	if kerrors.IsForbidden(err) || kerrors.IsNotFound(err) {
+		klog.V(1).Infof("unable to list variable sets: %s", err.Error())
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to list variable sets: %w", err)
+	}
+	return list.Items, nil
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/testobj"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestListVariableSets(t *testing.T) {
+	resource := schema.GroupResource{Group: "etok.dev", Resource: "variablesets"}
+
+	tests := []struct {
+		name    string
+		listErr error
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "list",
+			want: 1,
+		},
+		{
+			name:    "forbidden",
+			listErr: kerrors.NewForbidden(resource, "", errors.New("denied")),
+		},
+		{
+			name:    "not found",
+			listErr: kerrors.NewNotFound(resource, ""),
+		},
+		{
+			name:    "other error",
+			listErr: kerrors.NewInternalError(errors.New("boom")),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := NewFakeClientCreator(testobj.VariableSet("default", "shared", v1alpha1.VariableSetSpec{})).(*FakeClientCreator)
+			if tt.listErr != nil {
+				creator.PrependReactor("list", "variablesets", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, tt.listErr
+				})
+			}
+			client, err := creator.Create("")
+			require.NoError(t, err)
+
+			sets, err := client.ListVariableSets(context.Background(), "default")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, len(sets))
+		})
+	}
+}
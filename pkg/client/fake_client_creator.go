@@ -24,7 +24,7 @@ func (f *FakeClientCreator) Create(kubeCtx string) (*Client, error) {
 	var kubeObjs, etokObjs []runtime.Object
 	for _, obj := range f.objs {
 		switch obj.(type) {
-		case *v1alpha1.Run, *v1alpha1.Workspace:
+		case *v1alpha1.Run, *v1alpha1.Workspace, *v1alpha1.WorkspaceTemplate, *v1alpha1.ClusterWorkspaceTemplate, *v1alpha1.VariableSet:
 			etokObjs = append(etokObjs, obj)
 		default:
 			kubeObjs = append(kubeObjs, obj)
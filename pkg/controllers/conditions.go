@@ -23,6 +23,15 @@ func workspacePending(message string) *metav1.Condition {
 	}
 }
 
+func workspaceDeleting(message string) *metav1.Condition {
+	return &metav1.Condition{
+		Type:    v1alpha1.WorkspaceReadyCondition,
+		Status:  metav1.ConditionFalse,
+		Reason:  v1alpha1.DeletionReason,
+		Message: message,
+	}
+}
+
 func workspaceUnknown(message string) *metav1.Condition {
 	return &metav1.Condition{
 		Type:    v1alpha1.WorkspaceReadyCondition,
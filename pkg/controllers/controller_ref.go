@@ -19,6 +19,22 @@ func isAlreadyOwner(owner, object controllerutil.Object, scheme *runtime.Scheme)
 	return true
 }
 
+// removeOwnerReference removes any reference to owner from the object's
+// ownerReferences, returning true if a reference was removed
+func removeOwnerReference(owner, object controllerutil.Object) bool {
+	var refs []metav1.OwnerReference
+	for _, ref := range object.GetOwnerReferences() {
+		if ref.UID != owner.GetUID() || ref.Name != owner.GetName() {
+			refs = append(refs, ref)
+		}
+	}
+	if len(refs) == len(object.GetOwnerReferences()) {
+		return false
+	}
+	object.SetOwnerReferences(refs)
+	return true
+}
+
 // indexOwnerRef returns the index of the owner reference in the slice if found,
 // or -1.
 func indexOwnerRef(ownerReferences []metav1.OwnerReference, ref metav1.OwnerReference) int {
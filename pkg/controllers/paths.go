@@ -27,4 +27,28 @@ const (
 	// backendPath is the filename in <WorkingDir> containing declaration of
 	// backend configuration.
 	backendPath = "_etok_backend.tf"
+
+	// tfvarsPath is the filename in <WorkingDir> containing the values of
+	// variables written in HCL. Terraform loads it automatically.
+	tfvarsPath = "_etok.auto.tfvars"
+
+	// cliConfigMountPath is the container path to the directory containing
+	// the rendered terraform CLI configuration file
+	cliConfigMountPath = "/cli-config"
+
+	// cliConfigFile is the filename of the rendered terraform CLI
+	// configuration, and the key of the secret containing it.
+	cliConfigFile = ".terraformrc"
+
+	// credentialsSecretsMountPath is the container path to the parent
+	// directory of secrets containing credentials mounted as files
+	credentialsSecretsMountPath = "/credentials/secrets"
+
+	// credentialsTokensMountPath is the container path to the directory
+	// containing projected service account tokens
+	credentialsTokensMountPath = "/credentials/tokens"
+
+	// policiesMountPath is the container path to the directory containing
+	// the rego modules of the workspace's policies
+	policiesMountPath = "/policies"
 )
@@ -3,6 +3,7 @@ package controllers
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
@@ -16,6 +17,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -44,19 +46,71 @@ type RunReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
 	Image  string
+
+	// Namespace in which to find cluster scoped policies
+	PoliciesNamespace string
+
+	// Reads the sources of variables directly from the API rather than from
+	// the cache, which would otherwise watch every kind of object read
+	APIReader client.Reader
+
+	// Maps the kinds of objects from which variables are sourced to their
+	// scope
+	RESTMapper meta.RESTMapper
+
+	// Kinds of objects from whose fields variables may be sourced
+	ObjectFieldKinds []schema.GroupKind
+}
+
+type RunReconcilerOption func(r *RunReconciler)
+
+func WithPoliciesNamespace(namespace string) RunReconcilerOption {
+	return func(r *RunReconciler) {
+		r.PoliciesNamespace = namespace
+	}
+}
+
+func WithAPIReader(reader client.Reader) RunReconcilerOption {
+	return func(r *RunReconciler) {
+		r.APIReader = reader
+	}
+}
+
+func WithRESTMapper(mapper meta.RESTMapper) RunReconcilerOption {
+	return func(r *RunReconciler) {
+		r.RESTMapper = mapper
+	}
+}
+
+func WithObjectFieldKinds(kinds []schema.GroupKind) RunReconcilerOption {
+	return func(r *RunReconciler) {
+		r.ObjectFieldKinds = kinds
+	}
 }
 
-func NewRunReconciler(c client.Client, image string) *RunReconciler {
+func NewRunReconciler(c client.Client, image string, opts ...RunReconcilerOption) *RunReconciler {
 	r := &RunReconciler{
-		Client: c,
-		Scheme: scheme.Scheme,
-		Image:  image,
+		Client:            c,
+		Scheme:            scheme.Scheme,
+		Image:             image,
+		PoliciesNamespace: defaultPoliciesNamespace,
+		APIReader:         c,
+		RESTMapper:        c.RESTMapper(),
+		ObjectFieldKinds:  defaultObjectFieldKinds,
+	}
+
+	for _, o := range opts {
+		o(r)
 	}
 
 	// Build chain of status updaters, to be called one after the other in a
 	// reconcile
 	runReconcileStatusChain = []runUpdater{}
+	runReconcileStatusChain = append(runReconcileStatusChain, checkWorkingTree)
+	runReconcileStatusChain = append(runReconcileStatusChain, checkCredentials)
 	runReconcileStatusChain = append(runReconcileStatusChain, r.manageQueue)
+	runReconcileStatusChain = append(runReconcileStatusChain, r.manageCLIConfig)
+	runReconcileStatusChain = append(runReconcileStatusChain, r.managePolicies)
 	runReconcileStatusChain = append(runReconcileStatusChain, r.managePod)
 
 	return r
@@ -65,6 +119,11 @@ func NewRunReconciler(c client.Client, image string) *RunReconciler {
 // +kubebuilder:rbac:groups=etok.dev,resources=runs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=etok.dev,resources=runs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=etok.dev,resources=variablesets,verbs=get;list;watch
+
+// Read objects of the kinds from whose fields variables may be sourced by
+// default
+// +kubebuilder:rbac:groups="",resources=services,verbs=get
 
 func (r *RunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	// set up a convenient log object so we don't have to type request over and
@@ -144,6 +203,19 @@ func (r *RunReconciler) updateStatus(ctx context.Context, req ctrl.Request, newS
 		return err
 	}
 
+	// Results of hooks and policies, the plan summary, receipt of the
+	// handshake, and the versions of terraform and providers are recorded by
+	// the runner, so don't overwrite them
+	newStatus.Hooks = run.Hooks
+	newStatus.Plan = run.Plan
+	newStatus.HandshakeReceived = run.HandshakeReceived
+	newStatus.TerraformVersion = run.TerraformVersion
+	newStatus.Providers = run.Providers
+	for _, cond := range run.Conditions {
+		if strings.HasPrefix(cond.Type, v1alpha1.PolicyConditionTypePrefix) {
+			meta.SetStatusCondition(&newStatus.Conditions, cond)
+		}
+	}
 	run.RunStatus = newStatus
 
 	return r.Status().Update(ctx, &run)
@@ -242,18 +314,21 @@ func (r *RunReconciler) manageQueue(ctx context.Context, run *v1alpha1.Run, ws v
 func (r *RunReconciler) managePod(ctx context.Context, run *v1alpha1.Run, ws v1alpha1.Workspace) (*metav1.Condition, error) {
 	log := log.FromContext(ctx)
 
-	// Check if optional secret "etok" is available
-	secretFound := true
-	err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: "etok"}, &corev1.Secret{})
-	if kerrors.IsNotFound(err) {
-		secretFound = false
-	} else if err != nil {
-		return nil, err
+	// Check if optional secret "etok" is available. Only necessary if the
+	// workspace doesn't specify its own credentials sources.
+	var secretFound bool
+	if len(ws.Spec.Credentials) == 0 {
+		err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: "etok"}, &corev1.Secret{})
+		if err == nil {
+			secretFound = true
+		} else if !kerrors.IsNotFound(err) {
+			return nil, err
+		}
 	}
 
 	// Check if optional service account "etok" is available
 	serviceAccountFound := true
-	err = r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: "etok"}, &corev1.ServiceAccount{})
+	err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: "etok"}, &corev1.ServiceAccount{})
 	if kerrors.IsNotFound(err) {
 		serviceAccountFound = false
 	} else if err != nil {
@@ -263,7 +338,23 @@ func (r *RunReconciler) managePod(ctx context.Context, run *v1alpha1.Run, ws v1a
 	var pod corev1.Pod
 	err = r.Get(ctx, requestFromObject(run).NamespacedName, &pod)
 	if kerrors.IsNotFound(err) {
-		pod = *runPod(run, &ws, secretFound, serviceAccountFound, r.Image)
+		// Merge workspace variables with those of variable sets
+		vars, err := workspaceVariables(ctx, r.Client, &ws)
+		if err != nil {
+			return nil, err
+		}
+
+		// Resolve variables sourced from workspace outputs and object fields,
+		// recording their sources on the run
+		vars, run.RunStatus.Variables, err = r.resolveVariables(ctx, run, vars)
+		var sourceErr *errVariableSource
+		if errors.As(err, &sourceErr) {
+			return runFailed(v1alpha1.VariableSourceErrorReason, sourceErr.Error()), nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		pod = *runPod(run, &ws, vars, secretFound, serviceAccountFound, r.Image)
 
 		// Make run owner of pod
 		if err := controllerutil.SetControllerReference(run, &pod, r.Scheme); err != nil {
@@ -327,7 +418,8 @@ func (r *RunReconciler) setOwnerOfArchive(ctx context.Context, run *v1alpha1.Run
 	log := log.FromContext(ctx)
 
 	var archive corev1.ConfigMap
-	if err := r.Get(ctx, requestFromObject(run).NamespacedName, &archive); err != nil {
+	// The archive may be shared by several runs, each of which is an owner
+	if err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: run.ConfigMap}, &archive); err != nil {
 		// Ignore not found errors and keep on reconciling - the client might
 		// not yet have created the config map
 		if !kerrors.IsNotFound(err) {
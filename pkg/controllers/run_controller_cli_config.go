@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/labels"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// manageCLIConfig renders the workspace's terraform CLI configuration into a
+// secret belonging to the run, for mounting on the run's pod. Registry tokens
+// are read from their referenced secrets at this point, and only ever
+// persisted in the run's secret. A non-nil condition is returned if the CLI
+// configuration cannot be rendered.
+func (r *RunReconciler) manageCLIConfig(ctx context.Context, run *v1alpha1.Run, ws v1alpha1.Workspace) (*metav1.Condition, error) {
+	log := log.FromContext(ctx)
+
+	if ws.Spec.CLIConfig == nil {
+		return nil, nil
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: run.CLIConfigSecretName()}, &corev1.Secret{})
+	if err == nil {
+		// Already rendered
+		return nil, nil
+	} else if !kerrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	// Retrieve tokens for each registry host
+	tokens := make(map[string]string)
+	for _, creds := range ws.Spec.CLIConfig.Credentials {
+		var secret corev1.Secret
+		err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: creds.SecretKeyRef.Name}, &secret)
+		if kerrors.IsNotFound(err) {
+			return runFailed(v1alpha1.CLIConfigErrorReason, fmt.Sprintf("Secret %s containing credentials for %s not found", creds.SecretKeyRef.Name, creds.Host)), nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		token, ok := secret.Data[creds.SecretKeyRef.Key]
+		if !ok {
+			return runFailed(v1alpha1.CLIConfigErrorReason, fmt.Sprintf("Key %s containing credentials for %s not found in secret %s", creds.SecretKeyRef.Key, creds.Host, creds.SecretKeyRef.Name)), nil
+		}
+		tokens[creds.Host] = string(token)
+	}
+
+	secret := cliConfigSecret(run, renderCLIConfig(ws.Spec.CLIConfig, tokens))
+
+	// Make run owner of secret, so if run is deleted so is its secret
+	if err := controllerutil.SetControllerReference(run, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	if err := r.Create(ctx, secret); err != nil {
+		log.Error(err, "unable to create secret for CLI config")
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// renderCLIConfig renders terraform CLI configuration, appending a credentials
+// block for each registry host and its token.
+func renderCLIConfig(config *v1alpha1.CLIConfig, tokens map[string]string) string {
+	b := new(strings.Builder)
+
+	if config.Inline != "" {
+		b.WriteString(strings.TrimSpace(config.Inline))
+		b.WriteString("\n")
+	}
+
+	// Maintain order of credentials as specified in workspace spec
+	for _, creds := range config.Credentials {
+		fmt.Fprintf(b, "\ncredentials %s {\n  token = %s\n}\n", hclQuote(creds.Host), hclQuote(tokens[creds.Host]))
+	}
+
+	return b.String()
+}
+
+// hclQuote returns a double-quoted HCL string literal, escaping characters that
+// would otherwise be interpreted by the HCL parser.
+func hclQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "${", "$${", "%{", "%%{")
+	return `"` + r.Replace(s) + `"`
+}
+
+func cliConfigSecret(run *v1alpha1.Run, config string) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      run.CLIConfigSecretName(),
+			Namespace: run.Namespace,
+		},
+		StringData: map[string]string{
+			cliConfigFile: config,
+		},
+	}
+
+	// Set etok's common labels
+	labels.SetCommonLabels(secret)
+	// Permit filtering secrets by workspace
+	labels.SetLabel(secret, labels.Workspace(run.Workspace))
+	// Permit filtering etok resources by component
+	labels.SetLabel(secret, labels.RunComponent)
+
+	return secret
+}
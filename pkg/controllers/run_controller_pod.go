@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
 	"strconv"
@@ -12,7 +14,7 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccountFound bool, image string) *corev1.Pod {
+func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, vars []*v1alpha1.Variable, secretFound, serviceAccountFound bool, image string) *corev1.Pod {
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      run.PodName(),
@@ -125,6 +127,12 @@ func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccou
 							MountPath: filepath.Join(workspaceDir, run.ConfigMapPath, backendPath),
 							SubPath:   backendPath,
 						},
+						{
+							Name: "builtins",
+							// <WorkingDir>/_etok.auto.tfvars
+							MountPath: filepath.Join(workspaceDir, run.ConfigMapPath, tfvarsPath),
+							SubPath:   tfvarsPath,
+						},
 					},
 					WorkingDir: filepath.Join(workspaceDir, run.ConfigMapPath),
 				},
@@ -176,7 +184,9 @@ func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccou
 		pod.Spec.ServiceAccountName = "etok"
 	}
 
-	if secretFound {
+	if len(ws.Spec.Credentials) > 0 {
+		setCredentials(pod, ws.Spec.Credentials)
+	} else if secretFound {
 		pod.Spec.Containers[0].EnvFrom = append(pod.Spec.Containers[0].EnvFrom, corev1.EnvFromSource{
 			SecretRef: &corev1.SecretEnvSource{
 				LocalObjectReference: corev1.LocalObjectReference{
@@ -186,8 +196,73 @@ func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccou
 		})
 	}
 
-	// Set workspace variables
-	for _, v := range ws.Spec.Variables {
+	if ws.Spec.CLIConfig != nil {
+		// Mount rendered terraform CLI configuration and point terraform to it
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "cliconfig",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: run.CLIConfigSecretName(),
+				},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "cliconfig",
+			MountPath: cliConfigMountPath,
+			ReadOnly:  true,
+		})
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "TF_CLI_CONFIG_FILE",
+			Value: filepath.Join(cliConfigMountPath, cliConfigFile),
+		})
+	}
+
+	if evaluatesPolicies(run, ws) {
+		// Mount policies and instruct runner to evaluate plan against them
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "policies",
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: run.PoliciesConfigMapName(),
+					},
+				},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "policies",
+			MountPath: policiesMountPath,
+			ReadOnly:  true,
+		})
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "ETOK_POLICIES",
+			Value: policiesMountPath,
+		})
+	}
+
+	// Pass hooks applicable to the run's command to the runner
+	var hooks []v1alpha1.Hook
+	for _, h := range ws.Spec.Hooks {
+		if h.AppliesTo(run.Command) {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) > 0 {
+		// Marshalling a slice of hooks cannot fail
+		encoded, _ := json.Marshal(hooks)
+		pod.Spec.Containers[0].Env = append(pod.Spec.Containers[0].Env, corev1.EnvVar{
+			Name:  "ETOK_HOOKS",
+			Value: string(encoded),
+		})
+	}
+
+	// Set workspace variables, including those of variable sets. Those written
+	// in HCL are instead passed in a tfvars file, unless sourced from elsewhere.
+	for _, v := range vars {
+		if v.HCL && !v.EnvironmentVariable && v.ValueFrom == nil {
+			continue
+		}
+
 		var ev corev1.EnvVar
 
 		if v.EnvironmentVariable {
@@ -196,8 +271,8 @@ func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccou
 			ev.Name = fmt.Sprintf("TF_VAR_%s", v.Key)
 		}
 
-		if ev.ValueFrom != nil {
-			ev.ValueFrom = v.ValueFrom
+		if v.ValueFrom != nil {
+			ev.ValueFrom = &v.ValueFrom.EnvVarSource
 		} else {
 			ev.Value = v.Value
 		}
@@ -207,3 +282,165 @@ func runPod(run *v1alpha1.Run, ws *v1alpha1.Workspace, secretFound, serviceAccou
 
 	return pod
 }
+
+// checkCredentials fails a run if any of the workspace's credentials sources
+// does not set exactly one source.
+func checkCredentials(ctx context.Context, run *v1alpha1.Run, ws v1alpha1.Workspace) (*metav1.Condition, error) {
+	for i, src := range ws.Spec.Credentials {
+		if (src.Secret == nil) == (src.ServiceAccountToken == nil) {
+			return runFailed(v1alpha1.CredentialsErrorReason, fmt.Sprintf("Credentials source %d must set exactly one of secret or serviceAccountToken", i)), nil
+		}
+	}
+	return nil, nil
+}
+
+// setCredentials makes the workspace's credentials sources available to the
+// run's pod, either as environment variables or as mounted files. For the
+// latter, environment variables are set to the paths of the mounted files.
+func setCredentials(pod *corev1.Pod, sources []v1alpha1.CredentialsSource) {
+	container := &pod.Spec.Containers[0]
+
+	var tokens []corev1.VolumeProjection
+
+	// Volumes of secrets mounted as files, keyed by secret name. A secret
+	// listed more than once is mounted once, with the keys of every listing.
+	secretVolumes := make(map[string]*corev1.Volume)
+	var secretNames []string
+	// Secrets of which all keys are mounted
+	allKeys := make(map[string]bool)
+
+	for i, src := range sources {
+		switch {
+		case src.Secret != nil && src.Secret.Mode == v1alpha1.CredentialsModeFile:
+			volume, ok := secretVolumes[src.Secret.Name]
+			if !ok {
+				volume = &corev1.Volume{
+					Name: fmt.Sprintf("credentials-%d", i),
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: src.Secret.Name,
+						},
+					},
+				}
+				secretVolumes[src.Secret.Name] = volume
+				secretNames = append(secretNames, src.Secret.Name)
+			}
+			mountPath := filepath.Join(credentialsSecretsMountPath, src.Secret.Name)
+
+			if len(src.Secret.Items) == 0 {
+				allKeys[src.Secret.Name] = true
+			}
+			for _, item := range src.Secret.Items {
+				if !hasKeyToPath(volume.Secret.Items, item.Key) {
+					volume.Secret.Items = append(volume.Secret.Items, corev1.KeyToPath{Key: item.Key, Path: item.Key})
+				}
+				container.Env = append(container.Env, corev1.EnvVar{
+					Name:  credentialsEnvVarName(item),
+					Value: filepath.Join(mountPath, item.Key),
+				})
+			}
+		case src.Secret != nil:
+			if len(src.Secret.Items) == 0 {
+				// Set all keys as environment variables
+				container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+					SecretRef: &corev1.SecretEnvSource{
+						LocalObjectReference: corev1.LocalObjectReference{
+							Name: src.Secret.Name,
+						},
+					},
+				})
+				continue
+			}
+			for _, item := range src.Secret.Items {
+				container.Env = append(container.Env, corev1.EnvVar{
+					Name: credentialsEnvVarName(item),
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: src.Secret.Name,
+							},
+							Key: item.Key,
+						},
+					},
+				})
+			}
+		case src.ServiceAccountToken != nil:
+			filename := fmt.Sprintf("token-%d", i)
+			tokens = append(tokens, corev1.VolumeProjection{
+				ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+					Audience:          src.ServiceAccountToken.Audience,
+					ExpirationSeconds: src.ServiceAccountToken.ExpirationSeconds,
+					Path:              filename,
+				},
+			})
+
+			path := filepath.Join(credentialsTokensMountPath, filename)
+			for _, name := range tokenEnvVarNames(src.ServiceAccountToken) {
+				container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: path})
+			}
+		}
+	}
+
+	for _, name := range secretNames {
+		volume := secretVolumes[name]
+		if allKeys[name] {
+			volume.Secret.Items = nil
+		}
+		pod.Spec.Volumes = append(pod.Spec.Volumes, *volume)
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      volume.Name,
+			MountPath: filepath.Join(credentialsSecretsMountPath, name),
+			ReadOnly:  true,
+		})
+	}
+
+	if len(tokens) > 0 {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "credentials-tokens",
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: tokens,
+				},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      "credentials-tokens",
+			MountPath: credentialsTokensMountPath,
+			ReadOnly:  true,
+		})
+	}
+}
+
+// credentialsEnvVarName returns the name of the environment variable for a
+// secret key, defaulting to the name of the key.
+func credentialsEnvVarName(item v1alpha1.SecretCredentialsItem) string {
+	if item.EnvVar != "" {
+		return item.EnvVar
+	}
+	return item.Key
+}
+
+// tokenEnvVarNames returns the names of the environment variables to be set to
+// the path of a projected service account token.
+func tokenEnvVarNames(token *v1alpha1.ServiceAccountTokenCredentials) (names []string) {
+	switch token.Provider {
+	case v1alpha1.CredentialsProviderAWS:
+		names = append(names, "AWS_WEB_IDENTITY_TOKEN_FILE")
+	case v1alpha1.CredentialsProviderAzure:
+		names = append(names, "AZURE_FEDERATED_TOKEN_FILE", "ARM_OIDC_TOKEN_FILE_PATH")
+	}
+	if token.EnvVar != "" {
+		names = append(names, token.EnvVar)
+	}
+	return names
+}
+
+// hasKeyToPath determines whether the secret key is among the items
+func hasKeyToPath(items []corev1.KeyToPath, key string) bool {
+	for _, item := range items {
+		if item.Key == key {
+			return true
+		}
+	}
+	return false
+}
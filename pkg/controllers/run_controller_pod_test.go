@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/pkg/testobj"
+	"github.com/leg100/etok/pkg/variables"
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
 )
@@ -14,6 +16,7 @@ func TestRunPod(t *testing.T) {
 		name                string
 		run                 *v1alpha1.Run
 		workspace           *v1alpha1.Workspace
+		variableSets        []v1alpha1.VariableSet
 		secretFound         bool
 		serviceAccountFound bool
 		assertions          func(*corev1.Pod)
@@ -85,6 +88,18 @@ func TestRunPod(t *testing.T) {
 				})
 			},
 		},
+		{
+			name:      "builtin tfvars volume mount",
+			run:       testobj.Run("default", "run-12345", "plan", testobj.WithConfigMapPath("subdir")),
+			workspace: testobj.Workspace("default", "foo"),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      "builtins",
+					MountPath: "/workspace/subdir/_etok.auto.tfvars",
+					SubPath:   "_etok.auto.tfvars",
+				})
+			},
+		},
 		{
 			name:      "builtin backend config volume mount",
 			run:       testobj.Run("default", "run-12345", "plan", testobj.WithConfigMapPath("subdir")),
@@ -123,6 +138,53 @@ func TestRunPod(t *testing.T) {
 				})
 			},
 		},
+		{
+			name:      "Set workspace variables from a source",
+			run:       testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithVariablesFromSecret("foo-variables", "password")),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name: "TF_VAR_password",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "foo-variables"},
+							Key:                  "password",
+						},
+					},
+				})
+			},
+		},
+		{
+			name:      "Set variables of variable sets",
+			run:       testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithVariables("region", "eu")),
+			variableSets: []v1alpha1.VariableSet{
+				*testobj.VariableSet("default", "shared", v1alpha1.VariableSetSpec{
+					Workspaces: []string{"foo"},
+					Variables: []*v1alpha1.Variable{
+						{Key: "region", Value: "us"},
+						{Key: "project", Value: "acme"},
+						{Key: "TF_LOG", Value: "DEBUG", EnvironmentVariable: true},
+					},
+				}),
+			},
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_region", Value: "eu"})
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_project", Value: "acme"})
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_LOG", Value: "DEBUG"})
+				assert.NotContains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_region", Value: "us"})
+			},
+		},
+		{
+			name:      "HCL variables are not set as environment variables",
+			run:       testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithHCLVariables("zones", `["a", "b"]`)),
+			assertions: func(pod *corev1.Pod) {
+				for _, ev := range pod.Spec.Containers[0].Env {
+					assert.NotEqual(t, "TF_VAR_zones", ev.Name)
+				}
+			},
+		},
 		{
 			name:      "Set workspace environment variables",
 			run:       testobj.Run("default", "run-12345", "plan"),
@@ -134,10 +196,244 @@ func TestRunPod(t *testing.T) {
 				})
 			},
 		},
+		{
+			name:      "CLI config",
+			run:       testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCLIConfig(&v1alpha1.CLIConfig{Inline: "disable_checkpoint = true"})),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "TF_CLI_CONFIG_FILE",
+					Value: "/cli-config/.terraformrc",
+				})
+				assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      "cliconfig",
+					MountPath: "/cli-config",
+					ReadOnly:  true,
+				})
+				assert.Contains(t, pod.Spec.Volumes, corev1.Volume{
+					Name: "cliconfig",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: "run-12345-cliconfig",
+						},
+					},
+				})
+			},
+		},
+		{
+			name:      "No CLI config",
+			run:       testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo"),
+			assertions: func(pod *corev1.Pod) {
+				for _, ev := range pod.Spec.Containers[0].Env {
+					assert.NotEqual(t, "TF_CLI_CONFIG_FILE", ev.Name)
+				}
+			},
+		},
+		{
+			name: "Credentials from secret as environment variables",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCredentials(v1alpha1.CredentialsSource{
+				Secret: &v1alpha1.SecretCredentials{Name: "aws-creds", Mode: v1alpha1.CredentialsModeEnv},
+			})),
+			secretFound: true,
+			assertions: func(pod *corev1.Pod) {
+				assert.Equal(t, []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "aws-creds",
+							},
+						},
+					},
+				}, pod.Spec.Containers[0].EnvFrom)
+			},
+		},
+		{
+			name: "Credentials from secret key as environment variable",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCredentials(v1alpha1.CredentialsSource{
+				Secret: &v1alpha1.SecretCredentials{
+					Name:  "azure-creds",
+					Mode:  v1alpha1.CredentialsModeEnv,
+					Items: []v1alpha1.SecretCredentialsItem{{Key: "secret", EnvVar: "ARM_CLIENT_SECRET"}},
+				},
+			})),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name: "ARM_CLIENT_SECRET",
+					ValueFrom: &corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "azure-creds"},
+							Key:                  "secret",
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "Credentials from secret as mounted files",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCredentials(v1alpha1.CredentialsSource{
+				Secret: &v1alpha1.SecretCredentials{
+					Name:  "gcp-creds",
+					Mode:  v1alpha1.CredentialsModeFile,
+					Items: []v1alpha1.SecretCredentialsItem{{Key: "key.json", EnvVar: "GOOGLE_APPLICATION_CREDENTIALS"}},
+				},
+			})),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "GOOGLE_APPLICATION_CREDENTIALS",
+					Value: "/credentials/secrets/gcp-creds/key.json",
+				})
+				assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      "credentials-0",
+					MountPath: "/credentials/secrets/gcp-creds",
+					ReadOnly:  true,
+				})
+				assert.Contains(t, pod.Spec.Volumes, corev1.Volume{
+					Name: "credentials-0",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: "gcp-creds",
+							Items:      []corev1.KeyToPath{{Key: "key.json", Path: "key.json"}},
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "Credentials from the same secret as mounted files are mounted once",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCredentials(
+				v1alpha1.CredentialsSource{
+					Secret: &v1alpha1.SecretCredentials{
+						Name:  "gcp-creds",
+						Mode:  v1alpha1.CredentialsModeFile,
+						Items: []v1alpha1.SecretCredentialsItem{{Key: "key.json", EnvVar: "GOOGLE_APPLICATION_CREDENTIALS"}},
+					},
+				},
+				v1alpha1.CredentialsSource{
+					Secret: &v1alpha1.SecretCredentials{
+						Name:  "gcp-creds",
+						Mode:  v1alpha1.CredentialsModeFile,
+						Items: []v1alpha1.SecretCredentialsItem{{Key: "key.json", EnvVar: "GOOGLE_CREDENTIALS"}, {Key: "other.json"}},
+					},
+				},
+			)),
+			assertions: func(pod *corev1.Pod) {
+				assert.Equal(t, []corev1.VolumeMount{{
+					Name:      "credentials-0",
+					MountPath: "/credentials/secrets/gcp-creds",
+					ReadOnly:  true,
+				}}, credentialsMounts(pod))
+				assert.Contains(t, pod.Spec.Volumes, corev1.Volume{
+					Name: "credentials-0",
+					VolumeSource: corev1.VolumeSource{
+						Secret: &corev1.SecretVolumeSource{
+							SecretName: "gcp-creds",
+							Items:      []corev1.KeyToPath{{Key: "key.json", Path: "key.json"}, {Key: "other.json", Path: "other.json"}},
+						},
+					},
+				})
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "GOOGLE_CREDENTIALS",
+					Value: "/credentials/secrets/gcp-creds/key.json",
+				})
+			},
+		},
+		{
+			name: "Credentials from projected service account token",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithCredentials(v1alpha1.CredentialsSource{
+				ServiceAccountToken: &v1alpha1.ServiceAccountTokenCredentials{
+					Audience: "sts.amazonaws.com",
+					Provider: v1alpha1.CredentialsProviderAWS,
+				},
+			})),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "AWS_WEB_IDENTITY_TOKEN_FILE",
+					Value: "/credentials/tokens/token-0",
+				})
+				assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      "credentials-tokens",
+					MountPath: "/credentials/tokens",
+					ReadOnly:  true,
+				})
+				assert.Contains(t, pod.Spec.Volumes, corev1.Volume{
+					Name: "credentials-tokens",
+					VolumeSource: corev1.VolumeSource{
+						Projected: &corev1.ProjectedVolumeSource{
+							Sources: []corev1.VolumeProjection{
+								{
+									ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+										Audience: "sts.amazonaws.com",
+										Path:     "token-0",
+									},
+								},
+							},
+						},
+					},
+				})
+			},
+		},
+		{
+			name: "Hooks",
+			run:  testobj.Run("default", "run-12345", "plan"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithHooks(
+				v1alpha1.Hook{Name: "lint", Commands: []string{"plan", "apply"}, Phase: v1alpha1.HookPhasePre, Script: "tflint"},
+				v1alpha1.Hook{Name: "notify", Commands: []string{"apply"}, Phase: v1alpha1.HookPhasePost, Script: "./notify.sh"},
+				v1alpha1.Hook{Name: "cleanup", Phase: v1alpha1.HookPhaseOnFailure, Script: "rm -rf tmp"},
+			)),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "ETOK_HOOKS",
+					Value: `[{"name":"lint","commands":["plan","apply"],"phase":"pre","script":"tflint"},{"name":"cleanup","phase":"on-failure","script":"rm -rf tmp"}]`,
+				})
+			},
+		},
+		{
+			name:      "Policies",
+			run:       testobj.Run("default", "run-12345", "apply"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithPolicies(v1alpha1.PolicyReference{Name: "tags"})),
+			assertions: func(pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{
+					Name:  "ETOK_POLICIES",
+					Value: "/policies",
+				})
+				assert.Contains(t, pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+					Name:      "policies",
+					MountPath: "/policies",
+					ReadOnly:  true,
+				})
+			},
+		},
+		{
+			name:      "No policies for commands that don't evaluate policies",
+			run:       testobj.Run("default", "run-12345", "init"),
+			workspace: testobj.Workspace("default", "foo", testobj.WithPolicies(v1alpha1.PolicyReference{Name: "tags"})),
+			assertions: func(pod *corev1.Pod) {
+				for _, ev := range pod.Spec.Containers[0].Env {
+					assert.NotEqual(t, "ETOK_POLICIES", ev.Name)
+				}
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.assertions(runPod(tt.run, tt.workspace, tt.secretFound, tt.serviceAccountFound, "etok:latest"))
+			vars := variables.Effective(tt.workspace, tt.variableSets)
+			tt.assertions(runPod(tt.run, tt.workspace, vars, tt.secretFound, tt.serviceAccountFound, "etok:latest"))
 		})
 	}
 }
+
+// credentialsMounts returns the pod's volume mounts of credentials
+func credentialsMounts(pod *corev1.Pod) (mounts []corev1.VolumeMount) {
+	for _, m := range pod.Spec.Containers[0].VolumeMounts {
+		if strings.HasPrefix(m.MountPath, "/credentials/") {
+			mounts = append(mounts, m)
+		}
+	}
+	return mounts
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/cmd/launcher"
+	"github.com/leg100/etok/pkg/labels"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+const (
+	// defaultPoliciesNamespace is the default namespace in which to find
+	// cluster scoped policies, i.e. the default namespace of the operator.
+	defaultPoliciesNamespace = "etok"
+)
+
+// managePolicies copies the rego modules of the workspace's policies into a
+// config map belonging to the run, for mounting on the run's pod. Policies are
+// copied at this point so that cluster scoped policies, which reside in
+// another namespace, can be mounted, and so that a run is unaffected by
+// changes to policies once created. A non-nil condition is returned if a
+// policy cannot be found.
+func (r *RunReconciler) managePolicies(ctx context.Context, run *v1alpha1.Run, ws v1alpha1.Workspace) (*metav1.Condition, error) {
+	log := log.FromContext(ctx)
+
+	if !evaluatesPolicies(run, &ws) {
+		return nil, nil
+	}
+
+	err := r.Get(ctx, types.NamespacedName{Namespace: run.Namespace, Name: run.PoliciesConfigMapName()}, &corev1.ConfigMap{})
+	if err == nil {
+		// Already copied
+		return nil, nil
+	} else if !kerrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	modules := make(map[string]string)
+	for _, policy := range ws.Spec.Policies {
+		namespace := run.Namespace
+		if policy.Scope == v1alpha1.PolicyScopeCluster {
+			namespace = r.PoliciesNamespace
+		}
+
+		var configMap corev1.ConfigMap
+		err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: policy.Name}, &configMap)
+		if kerrors.IsNotFound(err) {
+			return runFailed(v1alpha1.PolicyErrorReason, fmt.Sprintf("Config map %s/%s containing policy not found", namespace, policy.Name)), nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		var found bool
+		for key, module := range configMap.Data {
+			if strings.HasSuffix(key, ".rego") {
+				modules[v1alpha1.PolicyModuleKey(policy.PolicyName(), key)] = module
+				found = true
+			}
+		}
+		if !found {
+			return runFailed(v1alpha1.PolicyErrorReason, fmt.Sprintf("Config map %s/%s contains no rego modules", namespace, policy.Name)), nil
+		}
+	}
+
+	configMap := policiesConfigMap(run, modules)
+
+	// Make run owner of config map, so if run is deleted so is its config map
+	if err := controllerutil.SetControllerReference(run, configMap, r.Scheme); err != nil {
+		return nil, err
+	}
+
+	if err := r.Create(ctx, configMap); err != nil {
+		log.Error(err, "unable to create config map for policies")
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// evaluatesPolicies determines whether the run's plan is to be evaluated
+// against policies
+func evaluatesPolicies(run *v1alpha1.Run, ws *v1alpha1.Workspace) bool {
+	return len(ws.Spec.Policies) > 0 && launcher.EvaluatesPolicies(run.Command)
+}
+
+func policiesConfigMap(run *v1alpha1.Run, modules map[string]string) *corev1.ConfigMap {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      run.PoliciesConfigMapName(),
+			Namespace: run.Namespace,
+		},
+		Data: modules,
+	}
+
+	// Set etok's common labels
+	labels.SetCommonLabels(configMap)
+	// Permit filtering config maps by workspace
+	labels.SetLabel(configMap, labels.Workspace(run.Workspace))
+	// Permit filtering etok resources by component
+	labels.SetLabel(configMap, labels.RunComponent)
+
+	return configMap
+}
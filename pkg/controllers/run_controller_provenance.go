@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/util/slice"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Commands refused when created from a dirty working tree, if the workspace
+// so demands
+var refusedIfDirty = []string{"apply", "destroy"}
+
+// checkWorkingTree fails an apply or destroy run created from a git working
+// tree with uncommitted changes, if the workspace refuses such runs. A run
+// without a git commit in its provenance, e.g. one created with kubectl, from
+// outside of a git repository, or by an older client, cannot be shown to be
+// clean and is refused too.
+func checkWorkingTree(ctx context.Context, run *v1alpha1.Run, ws v1alpha1.Workspace) (*metav1.Condition, error) {
+	if !ws.Spec.RefuseDirtyApplies || !slice.ContainsString(refusedIfDirty, run.Command) {
+		return nil, nil
+	}
+
+	if run.Provenance == nil || run.Provenance.Commit == "" {
+		return runFailed(v1alpha1.DirtyWorkingTreeReason, "Workspace refuses "+run.Command+" without the provenance of a git commit"), nil
+	}
+
+	if run.Provenance.Dirty {
+		return runFailed(v1alpha1.DirtyWorkingTreeReason, "Workspace refuses "+run.Command+" from a git working tree with uncommitted changes"), nil
+	}
+
+	return nil, nil
+}
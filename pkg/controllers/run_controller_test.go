@@ -14,6 +14,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -27,7 +28,11 @@ func TestRunReconciler(t *testing.T) {
 		runAssertions       func(*testutil.T, *v1alpha1.Run)
 		podAssertions       func(*testutil.T, *corev1.Pod)
 		configMapAssertions func(*testutil.T, *corev1.ConfigMap)
+		cliConfigAssertions func(*testutil.T, *corev1.Secret)
+		policiesAssertions  func(*testutil.T, *corev1.ConfigMap)
 		reconcileError      bool
+		// Options with which to construct the reconciler
+		opts []RunReconcilerOption
 	}{
 		{
 			name: "Missing workspace",
@@ -162,6 +167,27 @@ func TestRunReconciler(t *testing.T) {
 				})
 			},
 		},
+		{
+			name: "Secret found but workspace specifies credentials sources",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithCredentials(v1alpha1.CredentialsSource{
+					Secret: &v1alpha1.SecretCredentials{Name: "creds", Mode: v1alpha1.CredentialsModeEnv},
+				})),
+				testobj.Secret("operator-test", "etok"),
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Equal(t, []corev1.EnvFromSource{
+					{
+						SecretRef: &corev1.SecretEnvSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: "creds",
+							},
+						},
+					},
+				}, pod.Spec.Containers[0].EnvFrom)
+			},
+		},
 		{
 			name: "service account found and set",
 			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
@@ -215,6 +241,22 @@ func TestRunReconciler(t *testing.T) {
 				assert.Equal(t, "plan-1", archive.OwnerReferences[0].Name)
 			},
 		},
+		{
+			name: "Run shares config map with another run",
+			run:  testobj.Run("operator-test", "plan-2", "plan", testobj.WithWorkspace("workspace-1"), testobj.WithConfigMap("archive-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-2")),
+				testobj.ConfigMap("operator-test", "archive-1", func(cm *corev1.ConfigMap) {
+					cm.OwnerReferences = []metav1.OwnerReference{{APIVersion: "etok.dev/v1alpha1", Kind: "Run", Name: "plan-1", UID: "uid-1"}}
+				}),
+			},
+			configMapAssertions: func(t *testutil.T, archive *corev1.ConfigMap) {
+				if assert.Len(t, archive.OwnerReferences, 2) {
+					assert.Equal(t, "plan-1", archive.OwnerReferences[0].Name)
+					assert.Equal(t, "plan-2", archive.OwnerReferences[1].Name)
+				}
+			},
+		},
 		{
 			name: "Exit code recorded in status",
 			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
@@ -227,6 +269,349 @@ func TestRunReconciler(t *testing.T) {
 				assert.Equal(t, 5, *run.RunStatus.ExitCode)
 			},
 		},
+		{
+			name: "Renders CLI config with registry credentials",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithCLIConfig(&v1alpha1.CLIConfig{
+					Inline: "plugin_cache_may_break_dependency_lock_file = true",
+					Credentials: []v1alpha1.RegistryCredentials{
+						{
+							Host: "registry.example.com",
+							SecretKeyRef: corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "registry-creds"},
+								Key:                  "token",
+							},
+						},
+					},
+				})),
+				testobj.Secret("operator-test", "registry-creds", testobj.WithData("token", "secret-token")),
+			},
+			cliConfigAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				assert.Equal(t, "plugin_cache_may_break_dependency_lock_file = true\n\ncredentials \"registry.example.com\" {\n  token = \"secret-token\"\n}\n", secret.StringData[".terraformrc"])
+				assert.Equal(t, "Run", secret.OwnerReferences[0].Kind)
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				assert.Equal(t, v1alpha1.RunPhaseProvisioning, run.Phase)
+			},
+		},
+		{
+			name: "Missing registry credentials secret",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithCLIConfig(&v1alpha1.CLIConfig{
+					Credentials: []v1alpha1.RegistryCredentials{
+						{
+							Host: "registry.example.com",
+							SecretKeyRef: corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "registry-creds"},
+								Key:                  "token",
+							},
+						},
+					},
+				})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.CLIConfigErrorReason, failed.Reason)
+				}
+			},
+		},
+		{
+			name: "Copies policies",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithPolicies(
+					v1alpha1.PolicyReference{Name: "tags", Scope: v1alpha1.PolicyScopeNamespace},
+					v1alpha1.PolicyReference{Name: "security", Scope: v1alpha1.PolicyScopeCluster},
+				)),
+				testobj.ConfigMap("operator-test", "tags", testobj.WithConfigMapData("tags.rego", "package main"), testobj.WithConfigMapData("README.md", "tags policy")),
+				testobj.ConfigMap("etok", "security", testobj.WithConfigMapData("security.rego", "package main")),
+			},
+			policiesAssertions: func(t *testutil.T, configMap *corev1.ConfigMap) {
+				assert.Equal(t, map[string]string{
+					"tags_tags.rego":                 "package main",
+					"cluster.security_security.rego": "package main",
+				}, configMap.Data)
+			},
+		},
+		{
+			name: "Does not copy policies for commands that don't evaluate policies",
+			run:  testobj.Run("operator-test", "plan-1", "init", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithPolicies(v1alpha1.PolicyReference{Name: "tags"})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				assert.Nil(t, meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition))
+			},
+		},
+		{
+			name: "Missing policy",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithPolicies(v1alpha1.PolicyReference{Name: "tags"})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.PolicyErrorReason, failed.Reason)
+				}
+			},
+		},
+		{
+			name: "Refuses apply from dirty working tree",
+			run:  testobj.Run("operator-test", "apply-1", "apply", testobj.WithWorkspace("workspace-1"), testobj.WithProvenance(&v1alpha1.Provenance{Commit: "abc123", Dirty: true})),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithRefuseDirtyApplies()),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.DirtyWorkingTreeReason, failed.Reason)
+				}
+			},
+		},
+		{
+			name: "Refuses apply without provenance",
+			run:  testobj.Run("operator-test", "apply-1", "apply", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithRefuseDirtyApplies()),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.DirtyWorkingTreeReason, failed.Reason)
+					assert.Equal(t, "Workspace refuses apply without the provenance of a git commit", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Refuses destroy from outside of a git repository",
+			run:  testobj.Run("operator-test", "destroy-1", "destroy", testobj.WithWorkspace("workspace-1"), testobj.WithProvenance(&v1alpha1.Provenance{ArchiveDigest: "abc"})),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithRefuseDirtyApplies()),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.DirtyWorkingTreeReason, failed.Reason)
+				}
+			},
+		},
+		{
+			name: "Invalid credentials source",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithCredentials(v1alpha1.CredentialsSource{
+					Secret:              &v1alpha1.SecretCredentials{Name: "creds"},
+					ServiceAccountToken: &v1alpha1.ServiceAccountTokenCredentials{Audience: "sts.amazonaws.com"},
+				})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.CredentialsErrorReason, failed.Reason)
+				}
+			},
+		},
+		{
+			name: "Resolves variable from workspace output",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("vpc_id", &v1alpha1.VariableSource{
+					WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Namespace: "networking", Workspace: "vpc", Key: "id"},
+				})),
+				testobj.Workspace("networking", "vpc", testobj.WithOutputs("id", "vpc-123"), testobj.WithShareOutputsWith("operator-test")),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				if assert.Equal(t, 1, len(run.RunStatus.Variables)) {
+					assert.Equal(t, "vpc_id", run.RunStatus.Variables[0].Key)
+					assert.Equal(t, "vpc", run.RunStatus.Variables[0].Source.WorkspaceOutput.Workspace)
+				}
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_vpc_id", Value: "vpc-123"})
+			},
+		},
+		{
+			name: "Resolves variable from workspace output in same namespace",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("vpc_id", &v1alpha1.VariableSource{
+					WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Workspace: "vpc", Key: "id"},
+				})),
+				testobj.Workspace("operator-test", "vpc", testobj.WithOutputs("id", "vpc-123")),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				if assert.Equal(t, 1, len(run.RunStatus.Variables)) {
+					assert.Equal(t, "operator-test", run.RunStatus.Variables[0].Source.WorkspaceOutput.Namespace)
+				}
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_vpc_id", Value: "vpc-123"})
+			},
+		},
+		{
+			name: "Resolves variable from object field",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("lb_ip", &v1alpha1.VariableSource{
+					ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "web", JSONPath: "{.status.loadBalancer.ingress[0].ip}"},
+				})),
+				&corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "operator-test", Name: "web"},
+					Status: corev1.ServiceStatus{
+						LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "10.0.0.1"}}},
+					},
+				},
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				if assert.Equal(t, 1, len(run.RunStatus.Variables)) {
+					assert.Equal(t, "Service", run.RunStatus.Variables[0].Source.ObjectField.Kind)
+				}
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Contains(t, pod.Spec.Containers[0].Env, corev1.EnvVar{Name: "TF_VAR_lb_ip", Value: "10.0.0.1"})
+			},
+		},
+		{
+			name: "Missing workspace output source",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("vpc_id", &v1alpha1.VariableSource{
+					WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Workspace: "vpc", Key: "id"},
+				})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable vpc_id: workspace operator-test/vpc not found", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Missing workspace output",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("vpc_id", &v1alpha1.VariableSource{
+					WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Workspace: "vpc", Key: "id"},
+				})),
+				testobj.Workspace("operator-test", "vpc"),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable vpc_id: output id not found in workspace operator-test/vpc", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Refuses workspace output not shared with namespace",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("vpc_id", &v1alpha1.VariableSource{
+					WorkspaceOutput: &v1alpha1.WorkspaceOutputSelector{Namespace: "networking", Workspace: "vpc", Key: "id"},
+				})),
+				testobj.Workspace("networking", "vpc", testobj.WithOutputs("id", "vpc-123"), testobj.WithShareOutputsWith("dev")),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable vpc_id: workspace networking/vpc not found or does not share its outputs with namespace operator-test", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Refuses object field of kind not permitted",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("region", &v1alpha1.VariableSource{
+					ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "ConfigMap", Name: "config", JSONPath: "{.data.region}"},
+				})),
+				testobj.ConfigMap("operator-test", "config"),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable region: kind ConfigMap is not permitted", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Refuses object field of cluster scoped kind",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("uid", &v1alpha1.VariableSource{
+					ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "Namespace", Name: "kube-system", JSONPath: "{.metadata.uid}"},
+				})),
+			},
+			opts: []RunReconcilerOption{WithObjectFieldKinds([]schema.GroupKind{{Kind: "Namespace"}})},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable uid: kind Namespace is not namespaced", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Missing object field source",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("lb_ip", &v1alpha1.VariableSource{
+					ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "web", JSONPath: "{.status.loadBalancer.ingress[0].ip}"},
+				})),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Equal(t, "Unable to resolve variable lb_ip: Service web not found", failed.Message)
+				}
+			},
+		},
+		{
+			name: "Missing object field",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithCombinedQueue("plan-1"), testobj.WithVariableSource("lb_ip", &v1alpha1.VariableSource{
+					ObjectField: &v1alpha1.ObjectFieldSelector{APIVersion: "v1", Kind: "Service", Name: "web", JSONPath: ".status.loadBalancer.ingress[0].ip"},
+				})),
+				&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "operator-test", Name: "web"}},
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				failed := meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition)
+				if assert.NotNil(t, failed) {
+					assert.Equal(t, v1alpha1.VariableSourceErrorReason, failed.Reason)
+					assert.Contains(t, failed.Message, "Unable to resolve variable lb_ip: field .status.loadBalancer.ingress[0].ip not found in Service web")
+				}
+			},
+		},
+		{
+			name: "Permits plan from dirty working tree",
+			run:  testobj.Run("operator-test", "plan-1", "plan", testobj.WithWorkspace("workspace-1"), testobj.WithProvenance(&v1alpha1.Provenance{Dirty: true})),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithRefuseDirtyApplies()),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				assert.Nil(t, meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition))
+			},
+		},
+		{
+			name: "Permits apply from clean working tree",
+			run:  testobj.Run("operator-test", "apply-1", "apply", testobj.WithWorkspace("workspace-1"), testobj.WithProvenance(&v1alpha1.Provenance{Commit: "abc123"})),
+			objs: []runtime.Object{
+				testobj.Workspace("operator-test", "workspace-1", testobj.WithRefuseDirtyApplies()),
+			},
+			runAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				assert.Nil(t, meta.FindStatusCondition(run.Conditions, v1alpha1.RunFailedCondition))
+			},
+		},
 	}
 	for _, tt := range tests {
 		testutil.Run(t, tt.name, func(t *testutil.T) {
@@ -240,7 +625,8 @@ func TestRunReconciler(t *testing.T) {
 				},
 			}
 
-			_, err := NewRunReconciler(cl, "a.b.c/d:v1").Reconcile(context.Background(), req)
+			opts := append([]RunReconcilerOption{WithRESTMapper(restMapper())}, tt.opts...)
+			_, err := NewRunReconciler(cl, "a.b.c/d:v1", opts...).Reconcile(context.Background(), req)
 			t.CheckError(tt.reconcileError, err)
 
 			if tt.runAssertions != nil {
@@ -259,10 +645,34 @@ func TestRunReconciler(t *testing.T) {
 
 			if tt.configMapAssertions != nil {
 				var archive corev1.ConfigMap
-				require.NoError(t, cl.Get(context.TODO(), req.NamespacedName, &archive))
+				require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: tt.run.Namespace, Name: tt.run.ConfigMap}, &archive))
 
 				tt.configMapAssertions(t, &archive)
 			}
+
+			if tt.cliConfigAssertions != nil {
+				var secret corev1.Secret
+				require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: tt.run.Namespace, Name: tt.run.CLIConfigSecretName()}, &secret))
+
+				tt.cliConfigAssertions(t, &secret)
+			}
+
+			if tt.policiesAssertions != nil {
+				var configMap corev1.ConfigMap
+				require.NoError(t, cl.Get(context.TODO(), types.NamespacedName{Namespace: tt.run.Namespace, Name: tt.run.PoliciesConfigMapName()}, &configMap))
+
+				tt.policiesAssertions(t, &configMap)
+			}
 		})
 	}
 }
+
+// restMapper maps the kinds of objects from which tests source variables to
+// their scope
+func restMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Service"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("ConfigMap"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	return mapper
+}
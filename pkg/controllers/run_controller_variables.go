@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// defaultObjectFieldKinds are the kinds of objects from whose fields variables
+// may be sourced unless the operator is configured otherwise. The operator's
+// cluster role grants permission to get them.
+var defaultObjectFieldKinds = []schema.GroupKind{{Kind: "Service"}}
+
+// errVariableSource is an error resolving the value of a variable from its
+// source that cannot be fixed by retrying, e.g. the source does not exist
+type errVariableSource struct {
+	msg string
+}
+
+func (e *errVariableSource) Error() string { return e.msg }
+
+func variableSourceError(v *v1alpha1.Variable, format string, args ...interface{}) error {
+	return &errVariableSource{msg: fmt.Sprintf("Unable to resolve variable %s: %s", v.Key, fmt.Sprintf(format, args...))}
+}
+
+// resolveVariables resolves the values of variables sourced from workspace
+// outputs and object fields. The resolved variables are returned in place of
+// the originals, along with a record of their sources. Other variables are
+// returned as they are. An errVariableSource is returned if a source is
+// missing.
+func (r *RunReconciler) resolveVariables(ctx context.Context, run *v1alpha1.Run, vars []*v1alpha1.Variable) ([]*v1alpha1.Variable, []v1alpha1.ResolvedVariable, error) {
+	var resolved []*v1alpha1.Variable
+	var provenance []v1alpha1.ResolvedVariable
+
+	for _, v := range vars {
+		if v.ValueFrom == nil || !v.ValueFrom.IsResolved() {
+			resolved = append(resolved, v)
+			continue
+		}
+
+		source := v.ValueFrom.DeepCopy()
+
+		var value, resourceVersion string
+		var err error
+		switch {
+		case source.WorkspaceOutput != nil:
+			if source.WorkspaceOutput.Namespace == "" {
+				source.WorkspaceOutput.Namespace = run.Namespace
+			}
+			value, resourceVersion, err = r.workspaceOutput(ctx, v, run.Namespace, source.WorkspaceOutput)
+		case source.ObjectField != nil:
+			value, resourceVersion, err = r.objectField(ctx, v, run.Namespace, source.ObjectField)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Resolved values are passed to terraform as environment variables,
+		// which terraform parses as HCL if the variable's type is complex
+		resolved = append(resolved, &v1alpha1.Variable{
+			Key:                 v.Key,
+			Value:               value,
+			EnvironmentVariable: v.EnvironmentVariable,
+		})
+		provenance = append(provenance, v1alpha1.ResolvedVariable{
+			Key:                 v.Key,
+			EnvironmentVariable: v.EnvironmentVariable,
+			Source:              *source,
+			ResourceVersion:     resourceVersion,
+		})
+	}
+
+	return resolved, provenance, nil
+}
+
+// workspaceOutput retrieves the value of a workspace's output, along with the
+// resource version of the workspace. A workspace in a namespace other than
+// that of the run must share its outputs with the run's namespace.
+func (r *RunReconciler) workspaceOutput(ctx context.Context, v *v1alpha1.Variable, namespace string, sel *v1alpha1.WorkspaceOutputSelector) (string, string, error) {
+	var ws v1alpha1.Workspace
+	err := r.APIReader.Get(ctx, types.NamespacedName{Namespace: sel.Namespace, Name: sel.Workspace}, &ws)
+	if err != nil && !kerrors.IsNotFound(err) {
+		return "", "", err
+	}
+	if sel.Namespace != namespace && (err != nil || !ws.SharesOutputsWith(namespace)) {
+		// Don't reveal whether a workspace exists in another namespace
+		return "", "", variableSourceError(v, "workspace %s/%s not found or does not share its outputs with namespace %s", sel.Namespace, sel.Workspace, namespace)
+	}
+	if err != nil {
+		return "", "", variableSourceError(v, "workspace %s/%s not found", sel.Namespace, sel.Workspace)
+	}
+
+	for _, o := range ws.Status.Outputs {
+		if o.Key == sel.Key {
+			return o.Value, ws.ResourceVersion, nil
+		}
+	}
+	return "", "", variableSourceError(v, "output %s not found in workspace %s/%s", sel.Key, sel.Namespace, sel.Workspace)
+}
+
+// objectField retrieves the value of the field of an object in the namespace,
+// along with the resource version of the object. The object's kind must be
+// permitted, and namespaced.
+func (r *RunReconciler) objectField(ctx context.Context, v *v1alpha1.Variable, namespace string, sel *v1alpha1.ObjectFieldSelector) (string, string, error) {
+	gv, err := schema.ParseGroupVersion(sel.APIVersion)
+	if err != nil {
+		return "", "", variableSourceError(v, "invalid api version %s: %s", sel.APIVersion, err.Error())
+	}
+
+	gk := gv.WithKind(sel.Kind).GroupKind()
+	if !r.permitsObjectFieldKind(gk) {
+		return "", "", variableSourceError(v, "kind %s is not permitted", gk)
+	}
+	mapping, err := r.RESTMapper.RESTMapping(gk, gv.Version)
+	if meta.IsNoMatchError(err) {
+		return "", "", variableSourceError(v, "unknown kind %s in %s", sel.Kind, sel.APIVersion)
+	} else if err != nil {
+		return "", "", err
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return "", "", variableSourceError(v, "kind %s is not namespaced", gk)
+	}
+
+	path := sel.JSONPath
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+	jp := jsonpath.New(v.Key)
+	if err := jp.Parse(path); err != nil {
+		return "", "", variableSourceError(v, "invalid jsonpath %s: %s", sel.JSONPath, err.Error())
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gv.WithKind(sel.Kind))
+	err = r.APIReader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: sel.Name}, obj)
+	if kerrors.IsNotFound(err) {
+		return "", "", variableSourceError(v, "%s %s not found", sel.Kind, sel.Name)
+	} else if meta.IsNoMatchError(err) {
+		return "", "", variableSourceError(v, "unknown kind %s in %s", sel.Kind, sel.APIVersion)
+	} else if err != nil {
+		return "", "", err
+	}
+
+	buf := new(bytes.Buffer)
+	if err := jp.Execute(buf, obj.Object); err != nil {
+		return "", "", variableSourceError(v, "field %s not found in %s %s: %s", sel.JSONPath, sel.Kind, sel.Name, err.Error())
+	}
+	return buf.String(), obj.GetResourceVersion(), nil
+}
+
+// permitsObjectFieldKind determines whether variables may be sourced from the
+// fields of objects of the kind
+func (r *RunReconciler) permitsObjectFieldKind(gk schema.GroupKind) bool {
+	for _, permitted := range r.ObjectFieldKinds {
+		if permitted == gk {
+			return true
+		}
+	}
+	return false
+}
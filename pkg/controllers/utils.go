@@ -1,8 +1,11 @@
 package controllers
 
 import (
+	"context"
 	"io/ioutil"
 
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/variables"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
@@ -29,3 +32,13 @@ func makeCopyOfMap(orig map[string]string) map[string]string {
 	}
 	return cp
 }
+
+// workspaceVariables returns the variables of the workspace merged with those
+// of the variable sets in its namespace that apply to it
+func workspaceVariables(ctx context.Context, c client.Client, ws *v1alpha1.Workspace) ([]*v1alpha1.Variable, error) {
+	var sets v1alpha1.VariableSetList
+	if err := c.List(ctx, &sets, client.InNamespace(ws.Namespace)); err != nil {
+		return nil, err
+	}
+	return variables.Effective(ws, sets.Items), nil
+}
@@ -17,10 +17,13 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/leg100/etok/pkg/scheme"
+	"github.com/leg100/etok/pkg/variables"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
@@ -86,6 +89,7 @@ func NewWorkspaceReconciler(cl client.Client, image string, opts ...WorkspaceRec
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.handleDeletion)
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.manageQueue)
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.manageBuiltins)
+	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.manageVariables)
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.manageRBACForNamespace)
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.manageState)
 	workspaceReconcileStatusChain = append(workspaceReconcileStatusChain, r.managePVC)
@@ -101,15 +105,22 @@ func NewWorkspaceReconciler(cl client.Client, image string, opts ...WorkspaceRec
 // +kubebuilder:rbac:groups="rbac.authorization.k8s.io",resources=rolebindings,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
+// Determine whether a cache's storage class permits expanding it
+// +kubebuilder:rbac:groups="storage.k8s.io",resources=storageclasses,verbs=get;list;watch
+
 // Manage configmaps for terraform variables
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 
 // Read terraform state files
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
+// Read variable sets
+// +kubebuilder:rbac:groups="etok.dev",resources=variablesets,verbs=get;list;watch
+
 // Operator grants these permissions to workspace service accounts, therefore it
 // too needs these permissions.
 // +kubebuilder:rbac:groups="etok.dev",resources=runs,verbs=get
+// +kubebuilder:rbac:groups="etok.dev",resources=runs/status,verbs=patch
 // +kubebuilder:rbac:groups="",resources=configmaps,verbs=create
 // +kubebuilder:rbac:groups="coordination.k8s.io",resources=leases,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
@@ -142,10 +153,9 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// Set garbage collection to use foreground deletion in the event the
-	// workspace is deleted
-	if !controllerutil.ContainsFinalizer(&ws, metav1.FinalizerDeleteDependents) {
-		controllerutil.AddFinalizer(&ws, metav1.FinalizerDeleteDependents)
+	// Set finalizers according to the deletion policy. Finalizers cannot be
+	// added once the workspace is being deleted.
+	if ws.GetDeletionTimestamp().IsZero() && setFinalizers(&ws) {
 		if err := r.Update(ctx, &ws); err != nil {
 			return ctrl.Result{}, err
 		}
@@ -173,7 +183,9 @@ func (r *WorkspaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 		ws.Status.Phase = setPhase(ready.Reason)
 
 		if err := r.updateStatus(ctx, req, ws.Status); err != nil {
-			return ctrl.Result{}, err
+			// Workspace may have been deleted once its deletion policy was
+			// enforced
+			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
 	}
 
@@ -253,17 +265,30 @@ func setPhase(reason string) v1alpha1.WorkspacePhase {
 	}
 }
 
-// Determine if workspace is being deleted
+// Determine if workspace is being deleted, and if so, enforce its deletion
+// policy before permitting its deletion
 func (r *WorkspaceReconciler) handleDeletion(ctx context.Context, ws *v1alpha1.Workspace) (*metav1.Condition, error) {
-	if !ws.GetDeletionTimestamp().IsZero() {
-		return &metav1.Condition{
-			Type:    v1alpha1.WorkspaceReadyCondition,
-			Status:  metav1.ConditionFalse,
-			Reason:  v1alpha1.DeletionReason,
-			Message: "Workspace is being deleted",
-		}, nil
+	if ws.GetDeletionTimestamp().IsZero() {
+		return nil, nil
 	}
-	return nil, nil
+
+	if controllerutil.ContainsFinalizer(ws, v1alpha1.DeletionPolicyFinalizer) {
+		blocked, err := r.enforceDeletionPolicy(ctx, ws)
+		if err != nil {
+			return nil, err
+		}
+		if blocked != "" {
+			return workspaceDeleting(blocked), nil
+		}
+
+		// Policy is enforced, so permit deletion
+		controllerutil.RemoveFinalizer(ws, v1alpha1.DeletionPolicyFinalizer)
+		if err := r.Update(ctx, ws); err != nil {
+			return nil, err
+		}
+	}
+
+	return workspaceDeleting("Workspace is being deleted"), nil
 }
 
 func (r *WorkspaceReconciler) manageState(ctx context.Context, ws *v1alpha1.Workspace) (*metav1.Condition, error) {
@@ -280,14 +305,24 @@ func (r *WorkspaceReconciler) manageState(ctx context.Context, ws *v1alpha1.Work
 		log.Error(err, "unable to get state secret")
 		return nil, err
 	default:
-		// Make workspace owner of state secret, so that if workspace is deleted
-		// so is the state
-		if err := controllerutil.SetOwnerReference(ws, &secret, r.Scheme); err != nil {
-			log.Error(err, "unable to set state secret ownership")
-			return nil, err
-		}
-		if err := r.Update(ctx, &secret); err != nil {
-			return nil, err
+		if ws.Spec.DeletionPolicy == v1alpha1.DeletionPolicyRetain {
+			// Orphan state secret, so that if workspace is deleted the state
+			// is retained
+			if removeOwnerReference(ws, &secret) {
+				if err := r.Update(ctx, &secret); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			// Make workspace owner of state secret, so that if workspace is
+			// deleted so is the state
+			if err := controllerutil.SetOwnerReference(ws, &secret, r.Scheme); err != nil {
+				log.Error(err, "unable to set state secret ownership")
+				return nil, err
+			}
+			if err := r.Update(ctx, &secret); err != nil {
+				return nil, err
+			}
 		}
 
 		// Retrieve state file secret
@@ -319,13 +354,25 @@ func (r *WorkspaceReconciler) manageState(ctx context.Context, ws *v1alpha1.Work
 	return nil, nil
 }
 
-func (r *WorkspaceReconciler) addFinalizers(ctx context.Context, ws v1alpha1.Workspace) (v1alpha1.Workspace, error) {
-	// Set garbage collection to use foreground deletion in the event the
-	// workspace is deleted
-	if !controllerutil.ContainsFinalizer(&ws, metav1.FinalizerDeleteDependents) {
-		controllerutil.AddFinalizer(&ws, metav1.FinalizerDeleteDependents)
-	}
-	return ws, nil
+// setFinalizers sets the finalizers appropriate to the workspace's deletion
+// policy, returning true if they have changed. The Delete policy uses
+// foreground deletion, whereby garbage collection deletes the workspace's
+// dependents, including its state, before the workspace itself. Other policies
+// instead use a finalizer that is only removed once the operator has enforced
+// the policy, until which time dependents are left alone.
+func setFinalizers(ws *v1alpha1.Workspace) bool {
+	add, remove := metav1.FinalizerDeleteDependents, v1alpha1.DeletionPolicyFinalizer
+	switch ws.Spec.DeletionPolicy {
+	case v1alpha1.DeletionPolicyProtect, v1alpha1.DeletionPolicyRetain, v1alpha1.DeletionPolicyDestroy:
+		add, remove = remove, add
+	}
+
+	if controllerutil.ContainsFinalizer(ws, add) && !controllerutil.ContainsFinalizer(ws, remove) {
+		return false
+	}
+	controllerutil.AddFinalizer(ws, add)
+	controllerutil.RemoveFinalizer(ws, remove)
+	return true
 }
 
 // Prune invalid approval annotations. Invalid approvals are those that belong
@@ -497,11 +544,24 @@ func (r *WorkspaceReconciler) handleStorageError(err error, ws *v1alpha1.Workspa
 func (r *WorkspaceReconciler) manageBuiltins(ctx context.Context, ws *v1alpha1.Workspace) (*metav1.Condition, error) {
 	log := log.FromContext(ctx)
 
+	// Variables written in HCL are rendered to a tfvars file in the builtins
+	vars, err := workspaceVariables(ctx, r.Client, ws)
+	if err != nil {
+		log.Error(err, "unable to retrieve variables")
+		return nil, err
+	}
+	tfvars, err := variables.TFVars(vars)
+	if err != nil {
+		// Retrying won't fix an invalid variable, so fail the workspace
+		// rather than render a file that breaks every run
+		return workspaceFailure(err.Error()), nil
+	}
+
 	// Manage ConfigMap containing built-in terraform config for workspace
 	var builtins corev1.ConfigMap
-	err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.BuiltinsConfigMapName()}, &builtins)
+	err = r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.BuiltinsConfigMapName()}, &builtins)
 	if kerrors.IsNotFound(err) {
-		builtins := *newBuiltinsForWS(ws)
+		builtins := *newBuiltinsForWS(ws, tfvars)
 
 		if err := controllerutil.SetControllerReference(ws, &builtins, r.Scheme); err != nil {
 			log.Error(err, "unable to set config map ownership")
@@ -517,6 +577,44 @@ func (r *WorkspaceReconciler) manageBuiltins(ctx context.Context, ws *v1alpha1.W
 		log.Error(err, "unable to get configmap for builtins")
 		return nil, err
 	}
+
+	// Update builtins if they differ, e.g. following an upgrade
+	if want := newBuiltinsForWS(ws, tfvars); !reflect.DeepEqual(builtins.Data, want.Data) {
+		builtins.Data = want.Data
+		if err := r.Update(ctx, &builtins); err != nil {
+			log.Error(err, "unable to update configmap for builtins")
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// manageVariables makes the workspace the owner of the secret containing the
+// values of its sensitive variables, if it exists, so that if the workspace is
+// deleted so is the secret
+func (r *WorkspaceReconciler) manageVariables(ctx context.Context, ws *v1alpha1.Workspace) (*metav1.Condition, error) {
+	log := log.FromContext(ctx)
+
+	var secret corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.VariablesSecretName()}, &secret)
+	if kerrors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		log.Error(err, "unable to get variables secret")
+		return nil, err
+	}
+
+	owners := append([]metav1.OwnerReference{}, secret.OwnerReferences...)
+	if err := controllerutil.SetOwnerReference(ws, &secret, r.Scheme); err != nil {
+		log.Error(err, "unable to set variables secret ownership")
+		return nil, err
+	}
+	if !reflect.DeepEqual(owners, secret.OwnerReferences) {
+		if err := r.Update(ctx, &secret); err != nil {
+			log.Error(err, "unable to update variables secret")
+			return nil, err
+		}
+	}
 	return nil, nil
 }
 
@@ -566,6 +664,18 @@ func (r *WorkspaceReconciler) managePod(ctx context.Context, ws *v1alpha1.Worksp
 		return nil, err
 	}
 
+	recreate, err := r.detectPodDrift(ctx, ws, &pod)
+	if err != nil {
+		return nil, err
+	}
+	if recreate {
+		if err := r.Delete(ctx, &pod); err != nil {
+			log.Error(err, "unable to delete pod")
+			return nil, err
+		}
+		return workspacePending("Recreating pod to apply changes"), nil
+	}
+
 	switch phase := pod.Status.Phase; phase {
 	case corev1.PodRunning:
 		// TODO: event
@@ -582,6 +692,53 @@ func (r *WorkspaceReconciler) managePod(ctx context.Context, ws *v1alpha1.Worksp
 	return nil, nil
 }
 
+// detectPodDrift determines whether the pod has drifted from the workspace's
+// spec, in which case it is to be recreated, but only if no run is active or
+// queued, because such runs may depend upon it. A pod lacking a spec hash, i.e.
+// one created by an earlier version of the operator, is adopted as is. A pod
+// that is already terminating is left alone.
+func (r *WorkspaceReconciler) detectPodDrift(ctx context.Context, ws *v1alpha1.Workspace, pod *corev1.Pod) (bool, error) {
+	log := log.FromContext(ctx)
+
+	if pod.DeletionTimestamp != nil {
+		return false, nil
+	}
+
+	want, err := workspacePod(ws, r.Image)
+	if err != nil {
+		log.Error(err, "unable to construct pod")
+		return false, err
+	}
+	hash := want.Annotations[specHashAnnotation]
+
+	current, ok := pod.Annotations[specHashAnnotation]
+	if !ok {
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations[specHashAnnotation] = hash
+		if err := r.Update(ctx, pod); err != nil {
+			log.Error(err, "unable to annotate pod")
+			return false, err
+		}
+		return false, nil
+	}
+	if current == hash {
+		return false, nil
+	}
+
+	if ws.Status.Active != "" {
+		r.recorder.Eventf(ws, "Normal", "PodOutOfDate", "Pod will be recreated once run %s completes", ws.Status.Active)
+		return false, nil
+	}
+	if len(ws.Status.Queue) > 0 {
+		r.recorder.Event(ws, "Normal", "PodOutOfDate", "Pod will be recreated once queued runs complete")
+		return false, nil
+	}
+	r.recorder.Event(ws, "Normal", "RecreatingPod", "Recreating pod to apply changes to workspace")
+	return true, nil
+}
+
 // manageRBACForNamespace creates RBAC resources in the Workspace's namespace if
 // they don't already exist. They don't belong to the Workspace nor does the
 // Workspace rely on them. But a Run in the namespace does; its Pod relies on
@@ -670,12 +827,66 @@ func (r *WorkspaceReconciler) managePVC(ctx context.Context, ws *v1alpha1.Worksp
 	case corev1.ClaimPending:
 		return workspacePending("Cache's PVC in pending state"), nil
 	case corev1.ClaimBound:
-		return nil, nil
+		return nil, r.resizePVC(ctx, ws, &pvc)
 	default:
 		return workspaceUnknown("Cache PVC status unknown"), nil
 	}
 }
 
+// resizePVC expands the PVC if the workspace's cache size has been increased,
+// provided its storage class permits expansion. A PVC cannot be shrunk.
+func (r *WorkspaceReconciler) resizePVC(ctx context.Context, ws *v1alpha1.Workspace, pvc *corev1.PersistentVolumeClaim) error {
+	log := log.FromContext(ctx)
+
+	want, err := resource.ParseQuantity(ws.Spec.Cache.Size)
+	if err != nil {
+		return err
+	}
+	current, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if !ok {
+		return nil
+	}
+
+	switch want.Cmp(current) {
+	case 0:
+		return nil
+	case -1:
+		r.recorder.Eventf(ws, "Warning", "CacheResizeUnsupported", "Cache cannot be shrunk from %s to %s", current.String(), want.String())
+		return nil
+	}
+
+	expandable, err := r.allowsVolumeExpansion(ctx, pvc.Spec.StorageClassName)
+	if err != nil {
+		return err
+	}
+	if !expandable {
+		r.recorder.Eventf(ws, "Warning", "CacheResizeUnsupported", "Cache's storage class does not permit expanding it to %s", want.String())
+		return nil
+	}
+
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = want
+	if err := r.Update(ctx, pvc); err != nil {
+		log.Error(err, "unable to resize PVC")
+		return err
+	}
+	r.recorder.Eventf(ws, "Normal", "CacheResized", "Cache expanded from %s to %s", current.String(), want.String())
+	return nil
+}
+
+// allowsVolumeExpansion determines whether the storage class permits expanding
+// volumes
+func (r *WorkspaceReconciler) allowsVolumeExpansion(ctx context.Context, class *string) (bool, error) {
+	if class == nil || *class == "" {
+		return false, nil
+	}
+
+	var sc storagev1.StorageClass
+	if err := r.Get(ctx, types.NamespacedName{Name: *class}, &sc); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return sc.AllowVolumeExpansion != nil && *sc.AllowVolumeExpansion, nil
+}
+
 func (r *WorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	blder := ctrl.NewControllerManagedBy(mgr)
 
@@ -705,6 +916,19 @@ func (r *WorkspaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		return []ctrl.Request{requestFromObject(o)}
 	}))
 
+	// Watch variable sets and requeue the workspaces in the same namespace
+	blder = blder.Watches(&source.Kind{Type: &v1alpha1.VariableSet{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []ctrl.Request {
+		var workspaces v1alpha1.WorkspaceList
+		if err := r.List(context.Background(), &workspaces, client.InNamespace(o.GetNamespace())); err != nil {
+			return []ctrl.Request{}
+		}
+		requests := []ctrl.Request{}
+		for i := range workspaces.Items {
+			requests = append(requests, requestFromObject(&workspaces.Items[i]))
+		}
+		return requests
+	}))
+
 	// Watch for changes to run resources and requeue the associated Workspace.
 	blder = blder.Watches(&source.Kind{Type: &v1alpha1.Run{}}, handler.EnqueueRequestsFromMapFunc(func(o client.Object) []ctrl.Request {
 		run := o.(*v1alpha1.Run)
@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
 
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
 	"github.com/leg100/etok/pkg/labels"
@@ -12,6 +15,10 @@ import (
 const (
 	InstallerContainerName = "installer"
 	idlerCommand           = "trap \"exit 0\" SIGTERM; while true; do sleep 1; done"
+
+	// Annotation recording the hash of the spec from which the workspace pod
+	// was constructed
+	specHashAnnotation = "etok.dev/spec-hash"
 )
 
 // workspacePod returns a pod on which to setup a new etok workspace, optionally
@@ -72,6 +79,12 @@ func workspacePod(ws *v1alpha1.Workspace, image string) (*corev1.Pod, error) {
 		},
 	}
 
+	hash, err := podSpecHash(&pod.Spec)
+	if err != nil {
+		return nil, err
+	}
+	pod.Annotations = map[string]string{specHashAnnotation: hash}
+
 	// Set etok's common labels
 	labels.SetCommonLabels(pod)
 	// Permit filtering pods by workspace
@@ -81,3 +94,15 @@ func workspacePod(ws *v1alpha1.Workspace, image string) (*corev1.Pod, error) {
 
 	return pod, nil
 }
+
+// podSpecHash returns a hash of a pod spec, to detect whether a workspace's pod
+// has drifted from the workspace's spec
+func podSpecHash(spec *corev1.PodSpec) (string, error) {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return fmt.Sprintf("%x", h.Sum64()), nil
+}
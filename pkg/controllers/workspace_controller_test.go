@@ -15,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -25,6 +26,7 @@ import (
 
 func TestReconcileWorkspace(t *testing.T) {
 	var localPathStorageClass string = "local-path"
+	var allowVolumeExpansion = true
 
 	tests := []struct {
 		name                  string
@@ -36,6 +38,8 @@ func TestReconcileWorkspace(t *testing.T) {
 		pvcAssertions         func(*testutil.T, *corev1.PersistentVolumeClaim)
 		configMapAssertions   func(*testutil.T, *corev1.ConfigMap)
 		stateAssertions       func(*testutil.T, *corev1.Secret)
+		variablesAssertions   func(*testutil.T, *corev1.Secret)
+		destroyRunAssertions  func(*testutil.T, *v1alpha1.Run)
 		storageAssertions     func(*testutil.T, *storage.Client)
 		disableRBACAssertions bool
 		wantErr               bool
@@ -135,6 +139,156 @@ func TestReconcileWorkspace(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:      "Default deletion policy uses foreground deletion",
+			workspace: testobj.Workspace("", "workspace-1"),
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{metav1.FinalizerDeleteDependents}, ws.Finalizers)
+			},
+		},
+		{
+			name:      "Deletion policy finalizer replaces foreground deletion",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyProtect), testobj.WithFinalizers(metav1.FinalizerDeleteDependents)),
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+			},
+		},
+		{
+			name:      "Retain deletion policy orphans state",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyRetain)),
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json"), withOwner("workspace-1")),
+			},
+			stateAssertions: func(t *testutil.T, state *corev1.Secret) {
+				assert.Equal(t, 0, len(state.OwnerReferences))
+			},
+		},
+		{
+			name:                  "Retain deletion policy permits deletion",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyRetain), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json"), withOwner("workspace-1")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 0, len(ws.Finalizers))
+			},
+			stateAssertions: func(t *testutil.T, state *corev1.Secret) {
+				assert.Equal(t, 0, len(state.OwnerReferences))
+			},
+		},
+		{
+			name:                  "Protect deletion policy refuses deletion",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyProtect), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+				assert.Equal(t, v1alpha1.WorkspacePhaseDeleting, ws.Status.Phase)
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.Equal(t, "Deletion refused: state records 1 resources. Set annotation etok.dev/force-delete=true to force deletion", ready.Message)
+				}
+			},
+		},
+		{
+			name:                  "Protect deletion policy with force delete annotation",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyProtect), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer), testobj.WithAnnotations(v1alpha1.ForceDeleteAnnotationKey, "true")),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 0, len(ws.Finalizers))
+			},
+		},
+		{
+			name:                  "Protect deletion policy without state",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyProtect), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 0, len(ws.Finalizers))
+			},
+		},
+		{
+			name:                  "Destroy deletion policy creates destroy run",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyDestroy), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer), testobj.WithPrivilegedCommands("destroy")),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Run("", "plan-1", "plan", testobj.WithWorkspace("workspace-1"), testobj.WithConfigMapPath("subdir")),
+				testobj.ConfigMap("", "plan-1"),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+				assert.Equal(t, "approved", ws.Annotations[v1alpha1.ApprovedAnnotationKey("workspace-1-destroy")])
+			},
+			destroyRunAssertions: func(t *testutil.T, run *v1alpha1.Run) {
+				assert.Equal(t, "destroy", run.Command)
+				assert.Equal(t, []string{"-auto-approve"}, run.Args)
+				assert.Equal(t, "plan-1", run.ConfigMap)
+				assert.Equal(t, "subdir", run.ConfigMapPath)
+			},
+		},
+		{
+			name:                  "Destroy deletion policy without configuration",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyDestroy), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Run("", "plan-1", "plan", testobj.WithWorkspace("workspace-1")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.Equal(t, "Unable to destroy resources: no configuration found. Set annotation etok.dev/force-delete=true to force deletion", ready.Message)
+				}
+			},
+		},
+		{
+			name:                  "Destroy deletion policy queues destroy run",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyDestroy), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Run("", "workspace-1-destroy", "destroy", testobj.WithWorkspace("workspace-1")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, "workspace-1-destroy", ws.Status.Active)
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+			},
+		},
+		{
+			name:                  "Destroy deletion policy permits deletion once run succeeds",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyDestroy), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Run("", "workspace-1-destroy", "destroy", testobj.WithWorkspace("workspace-1"), testobj.WithCondition(v1alpha1.RunCompleteCondition), testobj.WithRunExitCode(0)),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, 0, len(ws.Finalizers))
+			},
+		},
+		{
+			name:                  "Destroy deletion policy blocks deletion when run fails",
+			workspace:             testobj.Workspace("", "workspace-1", testobj.WithDeleteTimestamp(), testobj.WithDeletionPolicy(v1alpha1.DeletionPolicyDestroy), testobj.WithFinalizers(v1alpha1.DeletionPolicyFinalizer)),
+			disableRBACAssertions: true,
+			objs: []runtime.Object{
+				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Run("", "workspace-1-destroy", "destroy", testobj.WithWorkspace("workspace-1"), testobj.WithCondition(v1alpha1.RunCompleteCondition), testobj.WithRunExitCode(1)),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{v1alpha1.DeletionPolicyFinalizer}, ws.Finalizers)
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.Equal(t, "Run workspace-1-destroy failed to destroy resources. Delete the run to retry, or set annotation etok.dev/force-delete=true to force deletion", ready.Message)
+				}
+			},
+		},
 		{
 			name:      "Pod succeeded",
 			workspace: testobj.Workspace("", "workspace-1"),
@@ -182,6 +336,7 @@ func TestReconcileWorkspace(t *testing.T) {
 			workspace: testobj.Workspace("", "workspace-1", testobj.WithStorageClass(&localPathStorageClass)),
 			objs: []runtime.Object{
 				testobj.Secret("", "tfstate-default-workspace-1", testobj.WithCompressedDataFromFile("tfstate", "testdata/tfstate.json")),
+				testobj.Secret("", "workspace-1-variables", testobj.WithData("password", "secret")),
 			},
 			configMapAssertions: func(t *testutil.T, vars *corev1.ConfigMap) {
 				assert.Equal(t, "Workspace", vars.OwnerReferences[0].Kind)
@@ -199,6 +354,160 @@ func TestReconcileWorkspace(t *testing.T) {
 				assert.Equal(t, "Workspace", state.OwnerReferences[0].Kind)
 				assert.Equal(t, "workspace-1", state.OwnerReferences[0].Name)
 			},
+			variablesAssertions: func(t *testutil.T, secret *corev1.Secret) {
+				if assert.Equal(t, 1, len(secret.OwnerReferences)) {
+					assert.Equal(t, "Workspace", secret.OwnerReferences[0].Kind)
+					assert.Equal(t, "workspace-1", secret.OwnerReferences[0].Name)
+				}
+			},
+		},
+		{
+			name:      "Recreate out-of-date pod",
+			workspace: testobj.Workspace("", "workspace-1"),
+			objs: []runtime.Object{
+				testobj.WorkspacePod("", "workspace-1", testobj.WithPhase(corev1.PodRunning), withSpecHash("out-of-date")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.Equal(t, v1alpha1.PendingReason, ready.Reason)
+					assert.Equal(t, "Recreating pod to apply changes", ready.Message)
+				}
+			},
+		},
+		{
+			name:      "Out-of-date pod is not recreated while run is active",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithCombinedQueue("apply-1")),
+			objs: []runtime.Object{
+				testobj.WorkspacePod("", "workspace-1", testobj.WithPhase(corev1.PodRunning), withSpecHash("out-of-date")),
+				testobj.Run("", "apply-1", "apply", testobj.WithWorkspace("workspace-1")),
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Equal(t, "out-of-date", pod.Annotations[specHashAnnotation])
+			},
+		},
+		{
+			name:      "Out-of-date pod is not recreated while runs are queued",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithAnnotations(v1alpha1.QueueBlockedAnnotationKey, "true")),
+			objs: []runtime.Object{
+				testobj.WorkspacePod("", "workspace-1", testobj.WithPhase(corev1.PodRunning), withSpecHash("out-of-date")),
+				testobj.Run("", "apply-1", "apply", testobj.WithWorkspace("workspace-1")),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, []string{"apply-1"}, ws.Status.Queue)
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.Equal(t, "out-of-date", pod.Annotations[specHashAnnotation])
+			},
+		},
+		{
+			name:      "Terminating out-of-date pod is not deleted again",
+			workspace: testobj.Workspace("", "workspace-1"),
+			objs: []runtime.Object{
+				testobj.WorkspacePod("", "workspace-1", testobj.WithPhase(corev1.PodRunning), withSpecHash("out-of-date"), withDeletionTimestamp()),
+			},
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.NotEqual(t, "Recreating pod to apply changes", ready.Message)
+				}
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.NotNil(t, pod.DeletionTimestamp)
+			},
+		},
+		{
+			name:      "Pod without spec hash is adopted",
+			workspace: testobj.Workspace("", "workspace-1"),
+			objs: []runtime.Object{
+				testobj.WorkspacePod("", "workspace-1", testobj.WithPhase(corev1.PodRunning)),
+			},
+			podAssertions: func(t *testutil.T, pod *corev1.Pod) {
+				assert.NotEmpty(t, pod.Annotations[specHashAnnotation])
+			},
+		},
+		{
+			name:      "Cache: Expand",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithCacheSize("2Gi")),
+			objs: []runtime.Object{
+				testobj.PVC("", "workspace-1", testobj.WithPVCPhase(corev1.ClaimBound), testobj.WithPVCSize("1Gi"), testobj.WithPVCStorageClass("local-path")),
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "local-path"}, AllowVolumeExpansion: &allowVolumeExpansion},
+			},
+			pvcAssertions: func(t *testutil.T, pvc *corev1.PersistentVolumeClaim) {
+				size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+				assert.Equal(t, "2Gi", size.String())
+			},
+		},
+		{
+			name:      "Cache: Storage class does not permit expansion",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithCacheSize("2Gi")),
+			objs: []runtime.Object{
+				testobj.PVC("", "workspace-1", testobj.WithPVCPhase(corev1.ClaimBound), testobj.WithPVCSize("1Gi"), testobj.WithPVCStorageClass("local-path")),
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "local-path"}},
+			},
+			pvcAssertions: func(t *testutil.T, pvc *corev1.PersistentVolumeClaim) {
+				size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+				assert.Equal(t, "1Gi", size.String())
+			},
+		},
+		{
+			name:      "Cache: Cannot shrink",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithCacheSize("1Gi")),
+			objs: []runtime.Object{
+				testobj.PVC("", "workspace-1", testobj.WithPVCPhase(corev1.ClaimBound), testobj.WithPVCSize("2Gi"), testobj.WithPVCStorageClass("local-path")),
+				&storagev1.StorageClass{ObjectMeta: metav1.ObjectMeta{Name: "local-path"}, AllowVolumeExpansion: &allowVolumeExpansion},
+			},
+			pvcAssertions: func(t *testutil.T, pvc *corev1.PersistentVolumeClaim) {
+				size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+				assert.Equal(t, "2Gi", size.String())
+			},
+		},
+		{
+			name:      "Builtin configuration is updated",
+			workspace: testobj.Workspace("", "workspace-1"),
+			objs: []runtime.Object{
+				testobj.ConfigMap("", v1alpha1.WorkspaceBuiltinsConfigMapName("workspace-1")),
+			},
+			configMapAssertions: func(t *testutil.T, vars *corev1.ConfigMap) {
+				assert.Equal(t, builtinVariables, vars.Data[variablesPath])
+				assert.Equal(t, builtinConfig, vars.Data[backendPath])
+			},
+		},
+		{
+			name:      "HCL variables are written to tfvars",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithVariables("region", "eu"), testobj.WithHCLVariables("zones", `["a", "b"]`)),
+			configMapAssertions: func(t *testutil.T, vars *corev1.ConfigMap) {
+				assert.Equal(t, "zones = [\"a\", \"b\"]\n", vars.Data[tfvarsPath])
+			},
+		},
+		{
+			name:      "HCL variables of variable sets are written to tfvars",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithHCLVariables("zones", `["a", "b"]`)),
+			objs: []runtime.Object{
+				testobj.VariableSet("", "shared", v1alpha1.VariableSetSpec{
+					Selector: &metav1.LabelSelector{},
+					Variables: []*v1alpha1.Variable{
+						{Key: "zones", Value: `["c"]`, HCL: true},
+						{Key: "tags", Value: `{ env = "prod" }`, HCL: true},
+					},
+				}),
+			},
+			configMapAssertions: func(t *testutil.T, vars *corev1.ConfigMap) {
+				assert.Equal(t, "zones = [\"a\", \"b\"]\ntags = { env = \"prod\" }\n", vars.Data[tfvarsPath])
+			},
+		},
+		{
+			name:      "Invalid HCL variable",
+			workspace: testobj.Workspace("", "workspace-1", testobj.WithHCLVariables("zones", "[\"a\"]\nregion = \"us\"")),
+			workspaceAssertions: func(t *testutil.T, ws *v1alpha1.Workspace) {
+				assert.Equal(t, v1alpha1.WorkspacePhaseError, ws.Status.Phase)
+				ready := meta.FindStatusCondition(ws.Status.Conditions, v1alpha1.WorkspaceReadyCondition)
+				if assert.NotNil(t, ready) {
+					assert.Contains(t, ready.Message, "invalid variable value: zones")
+				}
+			},
+			wantErr:               true,
+			disableRBACAssertions: true,
 		},
 		{
 			name:      "Builtin configuration is present",
@@ -317,6 +626,18 @@ func TestReconcileWorkspace(t *testing.T) {
 				tt.stateAssertions(t, &state)
 			}
 
+			if tt.variablesAssertions != nil {
+				secret := corev1.Secret{}
+				require.NoError(t, r.Get(context.TODO(), types.NamespacedName{Namespace: tt.workspace.Namespace, Name: tt.workspace.VariablesSecretName()}, &secret))
+				tt.variablesAssertions(t, &secret)
+			}
+
+			if tt.destroyRunAssertions != nil {
+				run := v1alpha1.Run{}
+				require.NoError(t, r.Get(context.TODO(), types.NamespacedName{Namespace: tt.workspace.Namespace, Name: tt.workspace.DestroyRunName()}, &run))
+				tt.destroyRunAssertions(t, &run)
+			}
+
 			if tt.configMapAssertions != nil {
 				vars := corev1.ConfigMap{}
 				require.NoError(t, r.Get(context.TODO(), types.NamespacedName{Namespace: tt.workspace.Namespace, Name: tt.workspace.BuiltinsConfigMapName()}, &vars))
@@ -354,3 +675,33 @@ func TestReconcileWorkspace(t *testing.T) {
 		})
 	}
 }
+
+// withOwner makes the named workspace the owner of a secret
+func withOwner(workspace string) func(*corev1.Secret) {
+	return func(secret *corev1.Secret) {
+		secret.OwnerReferences = append(secret.OwnerReferences, metav1.OwnerReference{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "Workspace",
+			Name:       workspace,
+		})
+	}
+}
+
+// withDeletionTimestamp marks a pod as terminating
+func withDeletionTimestamp() func(*corev1.Pod) {
+	return func(pod *corev1.Pod) {
+		now := metav1.Now()
+		pod.DeletionTimestamp = &now
+	}
+}
+
+// withSpecHash sets the hash of the spec from which a workspace pod was
+// constructed
+func withSpecHash(hash string) func(*corev1.Pod) {
+	return func(pod *corev1.Pod) {
+		if pod.Annotations == nil {
+			pod.Annotations = make(map[string]string)
+		}
+		pod.Annotations[specHashAnnotation] = hash
+	}
+}
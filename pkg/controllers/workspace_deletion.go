@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// enforceDeletionPolicy enforces the deletion policy of a workspace that is
+// being deleted. If deletion is to be blocked then a message explaining why is
+// returned, otherwise an empty string is returned.
+func (r *WorkspaceReconciler) enforceDeletionPolicy(ctx context.Context, ws *v1alpha1.Workspace) (string, error) {
+	switch ws.Spec.DeletionPolicy {
+	case v1alpha1.DeletionPolicyRetain:
+		return "", r.orphanState(ctx, ws)
+	case v1alpha1.DeletionPolicyProtect, v1alpha1.DeletionPolicyDestroy:
+		if ws.IsForceDeleted() {
+			r.recorder.Eventf(ws, "Warning", "ForceDeleted", "Deletion forced without destroying resources")
+			return "", nil
+		}
+
+		resources, err := r.managedResources(ctx, ws)
+		if err != nil {
+			return "", err
+		}
+		if resources == 0 {
+			return "", nil
+		}
+
+		if ws.Spec.DeletionPolicy == v1alpha1.DeletionPolicyProtect {
+			return fmt.Sprintf("Deletion refused: state records %d resources. Set annotation %s=true to force deletion", resources, v1alpha1.ForceDeleteAnnotationKey), nil
+		}
+		return r.destroy(ctx, ws)
+	}
+	return "", nil
+}
+
+// orphanState removes the workspace's ownership of its state secret, so that
+// garbage collection does not delete it along with the workspace
+func (r *WorkspaceReconciler) orphanState(ctx context.Context, ws *v1alpha1.Workspace) error {
+	var secret corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.StateSecretName()}, &secret)
+	if kerrors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if removeOwnerReference(ws, &secret) {
+		if err := r.Update(ctx, &secret); err != nil {
+			return err
+		}
+	}
+
+	r.recorder.Eventf(ws, "Normal", "StateRetained", "Retained state secret %s", secret.Name)
+	return nil
+}
+
+// managedResources returns the number of managed resources recorded in the
+// workspace's state
+func (r *WorkspaceReconciler) managedResources(ctx context.Context, ws *v1alpha1.Workspace) (int, error) {
+	var secret corev1.Secret
+	err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.StateSecretName()}, &secret)
+	if kerrors.IsNotFound(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	state, err := readState(ctx, &secret)
+	if err != nil {
+		return 0, err
+	}
+	return state.managedResources(), nil
+}
+
+// destroy manages a run that destroys the resources recorded in the workspace's
+// state. A message describing the progress of the run is returned, or an empty
+// string once the run has succeeded.
+func (r *WorkspaceReconciler) destroy(ctx context.Context, ws *v1alpha1.Workspace) (string, error) {
+	var run v1alpha1.Run
+	err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: ws.DestroyRunName()}, &run)
+	switch {
+	case kerrors.IsNotFound(err):
+		return r.createDestroyRun(ctx, ws)
+	case err != nil:
+		return "", err
+	}
+
+	if !run.IsDone() {
+		// The destroy run is queued behind any existing runs
+		if _, err := r.manageQueue(ctx, ws); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Destroying resources with run %s", run.Name), nil
+	}
+
+	if run.ExitCode != nil && *run.ExitCode == 0 {
+		r.recorder.Eventf(ws, "Normal", "DestroySuccessful", "Destroyed resources with run %s", run.Name)
+		return "", nil
+	}
+
+	return fmt.Sprintf("Run %s failed to destroy resources. Delete the run to retry, or set annotation %s=true to force deletion", run.Name, v1alpha1.ForceDeleteAnnotationKey), nil
+}
+
+// createDestroyRun creates a run that destroys the resources recorded in the
+// workspace's state, using the configuration of the workspace's most recent run
+// whose archive still exists. The run is approved, in case destroy is a
+// privileged command, because the deletion policy deems it so.
+func (r *WorkspaceReconciler) createDestroyRun(ctx context.Context, ws *v1alpha1.Workspace) (string, error) {
+	log := log.FromContext(ctx)
+
+	runlist := &v1alpha1.RunList{}
+	if err := r.List(ctx, runlist, client.InNamespace(ws.Namespace)); err != nil {
+		return "", err
+	}
+	// Newest first
+	sort.SliceStable(runlist.Items, func(i, j int) bool {
+		return runlist.Items[j].CreationTimestamp.Before(&runlist.Items[i].CreationTimestamp)
+	})
+
+	var source *v1alpha1.Run
+	for i, run := range runlist.Items {
+		if run.Workspace != ws.Name {
+			continue
+		}
+		err := r.Get(ctx, types.NamespacedName{Namespace: ws.Namespace, Name: run.ConfigMap}, &corev1.ConfigMap{})
+		if kerrors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		source = &runlist.Items[i]
+		break
+	}
+	if source == nil {
+		return fmt.Sprintf("Unable to destroy resources: no configuration found. Set annotation %s=true to force deletion", v1alpha1.ForceDeleteAnnotationKey), nil
+	}
+
+	run := &v1alpha1.Run{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: ws.Namespace,
+			Name:      ws.DestroyRunName(),
+		},
+		RunSpec: v1alpha1.RunSpec{
+			Command:       "destroy",
+			Args:          []string{"-auto-approve"},
+			ConfigMap:     source.ConfigMap,
+			ConfigMapKey:  source.ConfigMapKey,
+			ConfigMapPath: source.ConfigMapPath,
+			Workspace:     ws.Name,
+			Verbosity:     ws.Spec.Verbosity,
+		},
+	}
+	if source.Provenance != nil {
+		provenance := *source.Provenance
+		provenance.Message = "Destroy resources before deleting workspace"
+		run.Provenance = &provenance
+	}
+
+	if err := r.Create(ctx, run); err != nil {
+		log.Error(err, "unable to create destroy run")
+		return "", err
+	}
+
+	if ws.Annotations == nil {
+		ws.Annotations = make(map[string]string)
+	}
+	ws.Annotations[run.ApprovedAnnotationKey()] = "approved"
+	if err := r.Update(ctx, ws); err != nil {
+		return "", err
+	}
+
+	r.recorder.Eventf(ws, "Normal", "DestroyRunCreated", "Created run %s to destroy resources from configuration of run %s", run.Name, source.Name)
+	return fmt.Sprintf("Destroying resources with run %s", run.Name), nil
+}
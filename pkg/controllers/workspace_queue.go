@@ -9,7 +9,8 @@ import (
 // updateCombinedQueue updates a workspace's combined queue (the active run +
 // the queue) with the given list of runs.  Runs in the existing queue are
 // expunged if they meet certain criteria.  If they are not expunged they
-// mantain their position.
+// mantain their position. If the workspace's queue is blocked then no run is
+// made active in place of the current active run.
 func updateCombinedQueue(ws *v1alpha1.Workspace, runs []v1alpha1.Run) {
 	newQ := []string{}
 	currQ := append([]string{ws.Status.Active}, ws.Status.Queue...)
@@ -59,9 +60,12 @@ func updateCombinedQueue(ws *v1alpha1.Workspace, runs []v1alpha1.Run) {
 	}
 
 	// Update workspace with new (combined) queue
-	if len(newQ) > 0 {
-		ws.Status.Active, ws.Status.Queue = newQ[0], newQ[1:]
-	} else {
+	switch {
+	case len(newQ) == 0:
 		ws.Status.Active, ws.Status.Queue = "", []string(nil)
+	case ws.IsQueueBlocked() && newQ[0] != ws.Status.Active:
+		ws.Status.Active, ws.Status.Queue = "", newQ
+	default:
+		ws.Status.Active, ws.Status.Queue = newQ[0], newQ[1:]
 	}
 }
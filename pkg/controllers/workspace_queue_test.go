@@ -97,6 +97,25 @@ func TestUpdateCombinedQueue(t *testing.T) {
 			wantActive: "apply-1",
 			wantQueue:  []string{},
 		},
+		{
+			name:      "Blocked queue",
+			workspace: testobj.Workspace("default", "workspace-1", testobj.WithAnnotations(v1alpha1.QueueBlockedAnnotationKey, "true")),
+			runs: []v1alpha1.Run{
+				*testobj.Run("default", "apply-1", "apply", testobj.WithWorkspace("workspace-1")),
+				*testobj.Run("default", "apply-2", "apply", testobj.WithWorkspace("workspace-1")),
+			},
+			wantQueue: []string{"apply-1", "apply-2"},
+		},
+		{
+			name:      "Blocked queue retains active run",
+			workspace: testobj.Workspace("default", "workspace-1", testobj.WithCombinedQueue("apply-1"), testobj.WithAnnotations(v1alpha1.QueueBlockedAnnotationKey, "true")),
+			runs: []v1alpha1.Run{
+				*testobj.Run("default", "apply-1", "apply", testobj.WithWorkspace("workspace-1")),
+				*testobj.Run("default", "apply-2", "apply", testobj.WithWorkspace("workspace-1")),
+			},
+			wantActive: "apply-1",
+			wantQueue:  []string{"apply-2"},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
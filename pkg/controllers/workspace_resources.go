@@ -22,7 +22,7 @@ terraform {
 `
 )
 
-func newBuiltinsForWS(ws *v1alpha1.Workspace) *corev1.ConfigMap {
+func newBuiltinsForWS(ws *v1alpha1.Workspace, tfvars string) *corev1.ConfigMap {
 	builtins := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      ws.BuiltinsConfigMapName(),
@@ -31,6 +31,7 @@ func newBuiltinsForWS(ws *v1alpha1.Workspace) *corev1.ConfigMap {
 		Data: map[string]string{
 			variablesPath: builtinVariables,
 			backendPath:   builtinConfig,
+			tfvarsPath:    tfvars,
 		},
 	}
 
@@ -89,6 +90,12 @@ func newRoleForNamespace(ws *v1alpha1.Workspace) *rbacv1.Role {
 				Verbs:     []string{"get"},
 				APIGroups: []string{"etok.dev"},
 			},
+			// Runner records the results of hooks in the run's status
+			{
+				Resources: []string{"runs/status"},
+				Verbs:     []string{"patch"},
+				APIGroups: []string{"etok.dev"},
+			},
 			// Terraform state backend mgmt
 			{
 				Resources: []string{"secrets"},
@@ -11,8 +11,24 @@ import (
 )
 
 type state struct {
-	Serial  int
-	Outputs map[string]output
+	Serial    int
+	Outputs   map[string]output
+	Resources []stateResource
+}
+
+type stateResource struct {
+	Mode string
+}
+
+// managedResources returns the number of managed resources, i.e. not data
+// sources, recorded in the state
+func (s *state) managedResources() (n int) {
+	for _, res := range s.Resources {
+		if res.Mode == "managed" {
+			n++
+		}
+	}
+	return n
 }
 
 type output struct {
@@ -0,0 +1,134 @@
+// Package events provides a machine-readable stream of the lifecycle events of
+// a run, for consumption by CI systems and other tooling. Events are encoded
+// as newline-delimited JSON.
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Type is the type of a lifecycle event. The set of types, and the fields of
+// an event, constitute a stable schema: fields may be added but not removed or
+// renamed.
+type Type string
+
+const (
+	// Run and its config map have been created
+	Created Type = "created"
+	// Run has been reconciled by the operator for the first time
+	Reconciled Type = "reconciled"
+	// Run is queued behind the active run on the workspace. Emitted whenever
+	// its position in the queue changes.
+	Queued Type = "queued"
+	// Run with a privileged command has been approved
+	Approved Type = "approved"
+	// Run's pod is being provisioned
+	Provisioning Type = "provisioning"
+	// Run's pod is running
+	Running Type = "running"
+	// Chunk of output has been received from the run's pod
+	Log Type = "log"
+	// Run's command has completed
+	Completed Type = "completed"
+	// Lock file has been written to the local disk
+	LockFileWritten Type = "lockFileWritten"
+)
+
+// Event is a lifecycle event of a run
+type Event struct {
+	// Type of event
+	Type Type `json:"type"`
+	// Time the event was emitted, in RFC3339 format
+	Time time.Time `json:"time"`
+	// Namespace of the run
+	Namespace string `json:"namespace"`
+	// Workspace of the run
+	Workspace string `json:"workspace"`
+	// Name of the run
+	Run string `json:"run"`
+
+	// Position in the workspace queue, starting at 1 (queued)
+	Position int `json:"position,omitempty"`
+	// Name of the active run on the workspace (queued)
+	Active string `json:"active,omitempty"`
+	// Number of bytes of output received (log)
+	Bytes int `json:"bytes,omitempty"`
+	// Exit code of the run's command (completed)
+	ExitCode *int `json:"exitCode,omitempty"`
+	// Path to file (lockFileWritten)
+	Path string `json:"path,omitempty"`
+}
+
+// Emitter emits lifecycle events
+type Emitter interface {
+	Emit(Event)
+}
+
+// NopEmitter discards events
+type NopEmitter struct{}
+
+func (NopEmitter) Emit(Event) {}
+
+// JSONEmitter writes events as newline-delimited JSON, populating the fields
+// common to all events. It is safe for concurrent use.
+type JSONEmitter struct {
+	w io.Writer
+
+	namespace string
+	workspace string
+	run       string
+
+	// Substitutable for testing
+	now func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewJSONEmitter(w io.Writer, namespace, workspace, run string) *JSONEmitter {
+	return &JSONEmitter{
+		w:         w,
+		namespace: namespace,
+		workspace: workspace,
+		run:       run,
+		now:       time.Now,
+	}
+}
+
+func (e *JSONEmitter) Emit(ev Event) {
+	ev.Time = e.now().UTC()
+	ev.Namespace = e.namespace
+	ev.Workspace = e.workspace
+	ev.Run = e.run
+
+	// Encoding an event cannot fail
+	encoded, _ := json.Marshal(ev)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.w.Write(append(encoded, '\n'))
+}
+
+// logWriter emits a log event for each chunk of output written to the
+// underlying writer
+type logWriter struct {
+	w io.Writer
+	e Emitter
+}
+
+// NewLogWriter returns a writer that writes to w, emitting a log event for
+// each chunk written
+func NewLogWriter(w io.Writer, e Emitter) io.Writer {
+	return &logWriter{w: w, e: e}
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	n, err := lw.w.Write(p)
+	if n > 0 {
+		lw.e.Emit(Event{Type: Log, Bytes: n})
+	}
+	return n, err
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONEmitter(t *testing.T) {
+	out := new(bytes.Buffer)
+	e := NewJSONEmitter(out, "default", "dev", "run-12345")
+	e.now = func() time.Time { return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	code := 0
+	e.Emit(Event{Type: Queued, Position: 2, Active: "run-abcde"})
+	e.Emit(Event{Type: Completed, ExitCode: &code})
+
+	assert.Equal(t, `{"type":"queued","time":"2021-01-02T03:04:05Z","namespace":"default","workspace":"dev","run":"run-12345","position":2,"active":"run-abcde"}
+{"type":"completed","time":"2021-01-02T03:04:05Z","namespace":"default","workspace":"dev","run":"run-12345","exitCode":0}
+`, out.String())
+}
+
+func TestLogWriter(t *testing.T) {
+	out := new(bytes.Buffer)
+	events := new(bytes.Buffer)
+	e := NewJSONEmitter(events, "default", "dev", "run-12345")
+	e.now = func() time.Time { return time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	w := NewLogWriter(out, e)
+	w.Write([]byte("Plan: 1 to add\n"))
+
+	assert.Equal(t, "Plan: 1 to add\n", out.String())
+	assert.Equal(t, `{"type":"log","time":"2021-01-02T03:04:05Z","namespace":"default","workspace":"dev","run":"run-12345","bytes":15}
+`, events.String())
+}
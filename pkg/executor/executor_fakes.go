@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os/exec"
 )
 
 type FakeExecutor struct{}
@@ -36,3 +37,61 @@ func (fe *FakeExecutorMissingWorkspace) Execute(ctx context.Context, args []stri
 
 	return nil
 }
+
+// Fake that records args, and writes a plan in JSON to stdout when a saved
+// plan is shown
+type FakeExecutorPlan struct {
+	Plan string
+	Args [][]string
+
+	// Error returned when a saved plan is shown
+	ShowErr error
+}
+
+// FakeTerraformVersion is the version reported by fake executors
+const FakeTerraformVersion = "0.14.3"
+
+func (fe *FakeExecutorPlan) Execute(ctx context.Context, args []string, opts ...ExecOption) error {
+	fe.Args = append(fe.Args, args)
+
+	if len(args) > 1 && args[0] == "terraform" {
+		cmd := &exec.Cmd{}
+		for _, o := range opts {
+			o(cmd)
+		}
+		switch args[1] {
+		case "show":
+			if fe.ShowErr != nil {
+				return fe.ShowErr
+			}
+			// Only the plan exported in JSON is captured
+			if cmd.Stdout != nil {
+				fmt.Fprint(cmd.Stdout, fe.Plan)
+			}
+		case "version":
+			fmt.Fprintf(cmd.Stdout, `{"terraform_version":%q}`, FakeTerraformVersion)
+		}
+	}
+
+	return nil
+}
+
+// Fake that records args, and writes state to stdout when state is pulled
+type FakeExecutorState struct {
+	State string
+	Args  [][]string
+}
+
+func (fe *FakeExecutorState) Execute(ctx context.Context, args []string, opts ...ExecOption) error {
+	fe.Args = append(fe.Args, args)
+
+	if len(args) > 2 && args[0] == "terraform" && args[1] == "state" && args[2] == "pull" {
+		cmd := &exec.Cmd{}
+		for _, o := range opts {
+			o(cmd)
+		}
+		fmt.Fprint(cmd.Stdout, fe.State)
+	}
+
+	return nil
+}
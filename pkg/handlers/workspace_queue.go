@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"fmt"
+	"io"
 
 	"github.com/fatih/color"
 	"github.com/leg100/etok/api/etok.dev/v1alpha1"
@@ -11,7 +12,25 @@ import (
 )
 
 // Log queue position until run is at front of queue
-func LogQueuePosition(runName string) watchtools.ConditionFunc {
+func LogQueuePosition(out io.Writer, runName string) watchtools.ConditionFunc {
+	return QueuePosition(runName, func(ws *v1alpha1.Workspace, _ int) {
+		boldCyan := color.New(color.FgCyan, color.Bold).SprintFunc()
+		var printedQueue []string
+		for _, run := range ws.Status.Queue {
+			if run == runName {
+				printedQueue = append(printedQueue, boldCyan(run))
+			} else {
+				printedQueue = append(printedQueue, run)
+			}
+		}
+		fmt.Fprintf(out, "Queued behind active run %s: %v\n", ws.Status.Active, printedQueue)
+	})
+}
+
+// QueuePosition calls f with the run's position in the queue, starting at 1,
+// whenever the workspace is updated and the run is queued, until the run is at
+// front of the queue
+func QueuePosition(runName string, f func(ws *v1alpha1.Workspace, position int)) watchtools.ConditionFunc {
 	return workspaceHandlerWrapper(func(ws *v1alpha1.Workspace) (bool, error) {
 		if ws.Status.Active == runName {
 			// We're active, proceed
@@ -19,16 +38,7 @@ func LogQueuePosition(runName string) watchtools.ConditionFunc {
 		}
 
 		if pos := slice.StringIndex(ws.Status.Queue, runName); pos >= 0 {
-			boldCyan := color.New(color.FgCyan, color.Bold).SprintFunc()
-			var printedQueue []string
-			for _, run := range ws.Status.Queue {
-				if run == runName {
-					printedQueue = append(printedQueue, boldCyan(run))
-				} else {
-					printedQueue = append(printedQueue, run)
-				}
-			}
-			fmt.Printf("Queued behind active run %s: %v\n", ws.Status.Active, printedQueue)
+			f(ws, pos+1)
 		}
 		return false, nil
 	})
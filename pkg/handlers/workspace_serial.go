@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// WorkspaceSerial returns true when a workspace reports the given serial number
+// for its state file.
+func WorkspaceSerial(serial int) watchtools.ConditionFunc {
+	return workspaceHandlerWrapper(func(ws *v1alpha1.Workspace) (bool, error) {
+		if ws.Status.Serial == nil {
+			return false, nil
+		}
+		return *ws.Status.Serial == serial, nil
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright © 2020 Louis Garman <louisgarman@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
+	scheme "github.com/leg100/etok/pkg/k8s/etokclient/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ClusterWorkspaceTemplatesGetter has a method to return a ClusterWorkspaceTemplateInterface.
+// A group's client should implement this interface.
+type ClusterWorkspaceTemplatesGetter interface {
+	ClusterWorkspaceTemplates() ClusterWorkspaceTemplateInterface
+}
+
+// ClusterWorkspaceTemplateInterface has methods to work with ClusterWorkspaceTemplate resources.
+type ClusterWorkspaceTemplateInterface interface {
+	Create(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.CreateOptions) (*v1alpha1.ClusterWorkspaceTemplate, error)
+	Update(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.UpdateOptions) (*v1alpha1.ClusterWorkspaceTemplate, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.ClusterWorkspaceTemplate, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.ClusterWorkspaceTemplateList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.ClusterWorkspaceTemplate, err error)
+	ClusterWorkspaceTemplateExpansion
+}
+
+// clusterWorkspaceTemplates implements ClusterWorkspaceTemplateInterface
+type clusterWorkspaceTemplates struct {
+	client rest.Interface
+}
+
+// newClusterWorkspaceTemplates returns a ClusterWorkspaceTemplates
+func newClusterWorkspaceTemplates(c *EtokV1alpha1Client) *clusterWorkspaceTemplates {
+	return &clusterWorkspaceTemplates{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the clusterWorkspaceTemplate, and returns the corresponding clusterWorkspaceTemplate object, and an error if there is any.
+func (c *clusterWorkspaceTemplates) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	result = &v1alpha1.ClusterWorkspaceTemplate{}
+	err = c.client.Get().
+		Resource("clusterworkspacetemplates").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ClusterWorkspaceTemplates that match those selectors.
+func (c *clusterWorkspaceTemplates) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.ClusterWorkspaceTemplateList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.ClusterWorkspaceTemplateList{}
+	err = c.client.Get().
+		Resource("clusterworkspacetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested clusterWorkspaceTemplates.
+func (c *clusterWorkspaceTemplates) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("clusterworkspacetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a clusterWorkspaceTemplate and creates it.  Returns the server's representation of the clusterWorkspaceTemplate, and an error, if there is any.
+func (c *clusterWorkspaceTemplates) Create(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.CreateOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	result = &v1alpha1.ClusterWorkspaceTemplate{}
+	err = c.client.Post().
+		Resource("clusterworkspacetemplates").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(clusterWorkspaceTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a clusterWorkspaceTemplate and updates it. Returns the server's representation of the clusterWorkspaceTemplate, and an error, if there is any.
+func (c *clusterWorkspaceTemplates) Update(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.UpdateOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	result = &v1alpha1.ClusterWorkspaceTemplate{}
+	err = c.client.Put().
+		Resource("clusterworkspacetemplates").
+		Name(clusterWorkspaceTemplate.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(clusterWorkspaceTemplate).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the clusterWorkspaceTemplate and deletes it. Returns an error if one occurs.
+func (c *clusterWorkspaceTemplates) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("clusterworkspacetemplates").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *clusterWorkspaceTemplates) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("clusterworkspacetemplates").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched clusterWorkspaceTemplate.
+func (c *clusterWorkspaceTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	result = &v1alpha1.ClusterWorkspaceTemplate{}
+	err = c.client.Patch(pt).
+		Resource("clusterworkspacetemplates").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
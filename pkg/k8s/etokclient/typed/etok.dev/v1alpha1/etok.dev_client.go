@@ -24,8 +24,11 @@ import (
 
 type EtokV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	ClusterWorkspaceTemplatesGetter
 	RunsGetter
+	VariableSetsGetter
 	WorkspacesGetter
+	WorkspaceTemplatesGetter
 }
 
 // EtokV1alpha1Client is used to interact with features provided by the etok.dev group.
@@ -33,14 +36,26 @@ type EtokV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *EtokV1alpha1Client) ClusterWorkspaceTemplates() ClusterWorkspaceTemplateInterface {
+	return newClusterWorkspaceTemplates(c)
+}
+
 func (c *EtokV1alpha1Client) Runs(namespace string) RunInterface {
 	return newRuns(c, namespace)
 }
 
+func (c *EtokV1alpha1Client) VariableSets(namespace string) VariableSetInterface {
+	return newVariableSets(c, namespace)
+}
+
 func (c *EtokV1alpha1Client) Workspaces(namespace string) WorkspaceInterface {
 	return newWorkspaces(c, namespace)
 }
 
+func (c *EtokV1alpha1Client) WorkspaceTemplates(namespace string) WorkspaceTemplateInterface {
+	return newWorkspaceTemplates(c, namespace)
+}
+
 // NewForConfig creates a new EtokV1alpha1Client for the given config.
 func NewForConfig(c *rest.Config) (*EtokV1alpha1Client, error) {
 	config := *c
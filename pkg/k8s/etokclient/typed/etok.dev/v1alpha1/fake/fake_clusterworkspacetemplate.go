@@ -0,0 +1,127 @@
+// Copyright © 2020 Louis Garman <louisgarman@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeClusterWorkspaceTemplates implements ClusterWorkspaceTemplateInterface
+type FakeClusterWorkspaceTemplates struct {
+	Fake *FakeEtokV1alpha1
+}
+
+var clusterworkspacetemplatesResource = schema.GroupVersionResource{Group: "etok.dev", Version: "v1alpha1", Resource: "clusterworkspacetemplates"}
+
+var clusterworkspacetemplatesKind = schema.GroupVersionKind{Group: "etok.dev", Version: "v1alpha1", Kind: "ClusterWorkspaceTemplate"}
+
+// Get takes name of the clusterWorkspaceTemplate, and returns the corresponding clusterWorkspaceTemplate object, and an error if there is any.
+func (c *FakeClusterWorkspaceTemplates) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(clusterworkspacetemplatesResource, name), &v1alpha1.ClusterWorkspaceTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterWorkspaceTemplate), err
+}
+
+// List takes label and field selectors, and returns the list of ClusterWorkspaceTemplates that match those selectors.
+func (c *FakeClusterWorkspaceTemplates) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.ClusterWorkspaceTemplateList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(clusterworkspacetemplatesResource, clusterworkspacetemplatesKind, opts), &v1alpha1.ClusterWorkspaceTemplateList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.ClusterWorkspaceTemplateList{ListMeta: obj.(*v1alpha1.ClusterWorkspaceTemplateList).ListMeta}
+	for _, item := range obj.(*v1alpha1.ClusterWorkspaceTemplateList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested clusterWorkspaceTemplates.
+func (c *FakeClusterWorkspaceTemplates) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(clusterworkspacetemplatesResource, opts))
+
+}
+
+// Create takes the representation of a clusterWorkspaceTemplate and creates it.  Returns the server's representation of the clusterWorkspaceTemplate, and an error, if there is any.
+func (c *FakeClusterWorkspaceTemplates) Create(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.CreateOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(clusterworkspacetemplatesResource, clusterWorkspaceTemplate), &v1alpha1.ClusterWorkspaceTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterWorkspaceTemplate), err
+}
+
+// Update takes the representation of a clusterWorkspaceTemplate and updates it. Returns the server's representation of the clusterWorkspaceTemplate, and an error, if there is any.
+func (c *FakeClusterWorkspaceTemplates) Update(ctx context.Context, clusterWorkspaceTemplate *v1alpha1.ClusterWorkspaceTemplate, opts v1.UpdateOptions) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(clusterworkspacetemplatesResource, clusterWorkspaceTemplate), &v1alpha1.ClusterWorkspaceTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterWorkspaceTemplate), err
+}
+
+// Delete takes name of the clusterWorkspaceTemplate and deletes it. Returns an error if one occurs.
+func (c *FakeClusterWorkspaceTemplates) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(clusterworkspacetemplatesResource, name), &v1alpha1.ClusterWorkspaceTemplate{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeClusterWorkspaceTemplates) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(clusterworkspacetemplatesResource, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.ClusterWorkspaceTemplateList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched clusterWorkspaceTemplate.
+func (c *FakeClusterWorkspaceTemplates) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.ClusterWorkspaceTemplate, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(clusterworkspacetemplatesResource, name, pt, data, subresources...), &v1alpha1.ClusterWorkspaceTemplate{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ClusterWorkspaceTemplate), err
+}
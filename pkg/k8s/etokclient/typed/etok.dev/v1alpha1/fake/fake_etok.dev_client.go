@@ -26,14 +26,26 @@ type FakeEtokV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeEtokV1alpha1) ClusterWorkspaceTemplates() v1alpha1.ClusterWorkspaceTemplateInterface {
+	return &FakeClusterWorkspaceTemplates{c}
+}
+
 func (c *FakeEtokV1alpha1) Runs(namespace string) v1alpha1.RunInterface {
 	return &FakeRuns{c, namespace}
 }
 
+func (c *FakeEtokV1alpha1) VariableSets(namespace string) v1alpha1.VariableSetInterface {
+	return &FakeVariableSets{c, namespace}
+}
+
 func (c *FakeEtokV1alpha1) Workspaces(namespace string) v1alpha1.WorkspaceInterface {
 	return &FakeWorkspaces{c, namespace}
 }
 
+func (c *FakeEtokV1alpha1) WorkspaceTemplates(namespace string) v1alpha1.WorkspaceTemplateInterface {
+	return &FakeWorkspaceTemplates{c, namespace}
+}
+
 // RESTClient returns a RESTClient that is used to communicate
 // with API server by this client implementation.
 func (c *FakeEtokV1alpha1) RESTClient() rest.Interface {
@@ -0,0 +1,128 @@
+// Copyright © 2020 Louis Garman <louisgarman@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeVariableSets implements VariableSetInterface
+type FakeVariableSets struct {
+	Fake *FakeEtokV1alpha1
+	ns   string
+}
+
+var variablesetsResource = schema.GroupVersionResource{Group: "etok.dev", Version: "v1alpha1", Resource: "variablesets"}
+
+var variablesetsKind = schema.GroupVersionKind{Group: "etok.dev", Version: "v1alpha1", Kind: "VariableSet"}
+
+// Get takes name of the variableSet, and returns the corresponding variableSet object, and an error if there is any.
+func (c *FakeVariableSets) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.VariableSet, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(variablesetsResource, c.ns, name), &v1alpha1.VariableSet{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VariableSet), err
+}
+
+// List takes label and field selectors, and returns the list of VariableSets that match those selectors.
+func (c *FakeVariableSets) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.VariableSetList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(variablesetsResource, variablesetsKind, c.ns, opts), &v1alpha1.VariableSetList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.VariableSetList{ListMeta: obj.(*v1alpha1.VariableSetList).ListMeta}
+	for _, item := range obj.(*v1alpha1.VariableSetList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested variableSets.
+func (c *FakeVariableSets) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(variablesetsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a variableSet and creates it.  Returns the server's representation of the variableSet, and an error, if there is any.
+func (c *FakeVariableSets) Create(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.CreateOptions) (result *v1alpha1.VariableSet, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(variablesetsResource, c.ns, variableSet), &v1alpha1.VariableSet{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VariableSet), err
+}
+
+// Update takes the representation of a variableSet and updates it. Returns the server's representation of the variableSet, and an error, if there is any.
+func (c *FakeVariableSets) Update(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.UpdateOptions) (result *v1alpha1.VariableSet, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(variablesetsResource, c.ns, variableSet), &v1alpha1.VariableSet{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VariableSet), err
+}
+
+// Delete takes name of the variableSet and deletes it. Returns an error if one occurs.
+func (c *FakeVariableSets) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(variablesetsResource, c.ns, name), &v1alpha1.VariableSet{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeVariableSets) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(variablesetsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.VariableSetList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched variableSet.
+func (c *FakeVariableSets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VariableSet, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(variablesetsResource, c.ns, name, pt, data, subresources...), &v1alpha1.VariableSet{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.VariableSet), err
+}
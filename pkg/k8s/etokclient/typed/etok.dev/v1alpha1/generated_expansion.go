@@ -16,6 +16,12 @@
 
 package v1alpha1
 
+type ClusterWorkspaceTemplateExpansion interface{}
+
 type RunExpansion interface{}
 
+type VariableSetExpansion interface{}
+
 type WorkspaceExpansion interface{}
+
+type WorkspaceTemplateExpansion interface{}
@@ -0,0 +1,176 @@
+// Copyright © 2020 Louis Garman <louisgarman@gmail.com>
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "github.com/leg100/etok/api/etok.dev/v1alpha1"
+	scheme "github.com/leg100/etok/pkg/k8s/etokclient/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// VariableSetsGetter has a method to return a VariableSetInterface.
+// A group's client should implement this interface.
+type VariableSetsGetter interface {
+	VariableSets(namespace string) VariableSetInterface
+}
+
+// VariableSetInterface has methods to work with VariableSet resources.
+type VariableSetInterface interface {
+	Create(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.CreateOptions) (*v1alpha1.VariableSet, error)
+	Update(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.UpdateOptions) (*v1alpha1.VariableSet, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.VariableSet, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.VariableSetList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VariableSet, err error)
+	VariableSetExpansion
+}
+
+// variableSets implements VariableSetInterface
+type variableSets struct {
+	client rest.Interface
+	ns     string
+}
+
+// newVariableSets returns a VariableSets
+func newVariableSets(c *EtokV1alpha1Client, namespace string) *variableSets {
+	return &variableSets{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the variableSet, and returns the corresponding variableSet object, and an error if there is any.
+func (c *variableSets) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.VariableSet, err error) {
+	result = &v1alpha1.VariableSet{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("variablesets").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of VariableSets that match those selectors.
+func (c *variableSets) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.VariableSetList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.VariableSetList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("variablesets").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested variableSets.
+func (c *variableSets) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("variablesets").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a variableSet and creates it.  Returns the server's representation of the variableSet, and an error, if there is any.
+func (c *variableSets) Create(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.CreateOptions) (result *v1alpha1.VariableSet, err error) {
+	result = &v1alpha1.VariableSet{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("variablesets").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(variableSet).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a variableSet and updates it. Returns the server's representation of the variableSet, and an error, if there is any.
+func (c *variableSets) Update(ctx context.Context, variableSet *v1alpha1.VariableSet, opts v1.UpdateOptions) (result *v1alpha1.VariableSet, err error) {
+	result = &v1alpha1.VariableSet{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("variablesets").
+		Name(variableSet.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(variableSet).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the variableSet and deletes it. Returns an error if one occurs.
+func (c *variableSets) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("variablesets").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *variableSets) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("variablesets").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched variableSet.
+func (c *variableSets) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.VariableSet, err error) {
+	result = &v1alpha1.VariableSet{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("variablesets").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
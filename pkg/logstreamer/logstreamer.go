@@ -1,15 +1,31 @@
 package logstreamer
 
 import (
+	"bufio"
 	"context"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 
+	"github.com/leg100/etok/pkg/k8s"
 	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/klog/v2"
 
 	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+var (
+	// Delay before reconnecting to a log stream
+	ReconnectDelay = time.Second
+
+	// Maximum number of consecutive failed attempts to reconnect to a log
+	// stream
+	MaxReconnectAttempts = 10
+)
+
 // Substitutable for testing
 type GetLogsFunc func(context.Context, Options) (io.ReadCloser, error)
 
@@ -19,21 +35,193 @@ type Options struct {
 	PodLogOptions *corev1.PodLogOptions
 }
 
+// Stream streams the logs of a pod's container to out until the container
+// terminates. If the stream is disconnected before then, it reconnects,
+// requesting only logs since the last line received, and suppressing lines
+// that have already been received.
 func Stream(ctx context.Context, f GetLogsFunc, out io.Writer, podsClient typedv1.PodInterface, podName, containerName string) error {
 	klog.V(1).Info("Streaming logs")
-	stream, err := f(ctx, Options{
-		PodsClient:    podsClient,
-		PodName:       podName,
-		PodLogOptions: &corev1.PodLogOptions{Follow: true, Container: containerName},
+
+	s := &streamer{
+		getLogs:       f,
+		out:           out,
+		podsClient:    podsClient,
+		podName:       podName,
+		containerName: containerName,
+	}
+
+	var attempts int
+	for {
+		// Check whether the container has terminated before connecting: if
+		// it has then the stream contains the remainder of its logs and
+		// there is no need to reconnect.
+		terminated, err := s.terminated(ctx)
+		if err != nil {
+			return err
+		}
+
+		opened, err := s.stream(ctx)
+		if err != nil {
+			// Only retry failing to connect once a stream has been
+			// established, i.e. upon reconnecting
+			if !s.connected || ctx.Err() != nil {
+				return err
+			}
+			klog.V(1).Infof("log stream disconnected: %s", err.Error())
+		}
+
+		if opened && err == nil && !terminated {
+			// A stream ending cleanly usually means the container has
+			// terminated, in which case the stream contained the remainder
+			// of its logs and there is no need to reconnect.
+			terminated, err = s.terminated(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		if terminated {
+			// Write any remaining partial line
+			s.flush()
+			return nil
+		}
+
+		if opened {
+			attempts = 0
+		} else if attempts++; attempts > MaxReconnectAttempts {
+			return fmt.Errorf("unable to reconnect to log stream: %w", err)
+		}
+
+		klog.V(1).Info("Reconnecting to log stream")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(ReconnectDelay):
+		}
+	}
+}
+
+func GetLogs(ctx context.Context, opts Options) (io.ReadCloser, error) {
+	return opts.PodsClient.GetLogs(opts.PodName, opts.PodLogOptions).Stream(ctx)
+}
+
+// streamer streams logs, keeping track of the lines it has written so that it
+// can resume from where it left off.
+type streamer struct {
+	getLogs       GetLogsFunc
+	out           io.Writer
+	podsClient    typedv1.PodInterface
+	podName       string
+	containerName string
+
+	// Whether a stream has been successfully established
+	connected bool
+	// Timestamp of the last line written
+	last time.Time
+	// Number of lines written with the timestamp of the last line written
+	written int
+	// Incomplete line received before a stream ended. It is only written if
+	// no further logs are forthcoming, otherwise the complete line is expected
+	// to be received upon reconnecting.
+	partial string
+}
+
+// stream streams logs once, returning true if the stream was opened
+func (s *streamer) stream(ctx context.Context) (bool, error) {
+	opts := &corev1.PodLogOptions{Follow: true, Container: s.containerName, Timestamps: true}
+	if !s.last.IsZero() {
+		// Only second precision is supported, so lines received previously
+		// within the same second are received again and are skipped below
+		since := metav1.NewTime(s.last)
+		opts.SinceTime = &since
+	}
+
+	stream, err := s.getLogs(ctx, Options{
+		PodsClient:    s.podsClient,
+		PodName:       s.podName,
+		PodLogOptions: opts,
 	})
 	if err != nil {
-		return err
+		return false, err
 	}
 	defer stream.Close()
-	_, err = io.Copy(out, stream)
-	return err
+
+	s.connected = true
+	s.partial = ""
+
+	// Number of lines to skip that share the timestamp of the last line
+	// written
+	skip := s.written
+
+	reader := bufio.NewReader(stream)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			s.partial = line
+			if err == io.EOF {
+				err = nil
+			}
+			return true, err
+		}
+
+		ts, content, ok := splitTimestamp(line)
+		if ok {
+			if ts.Before(s.last) {
+				continue
+			}
+			if ts.Equal(s.last) {
+				if skip > 0 {
+					skip--
+					continue
+				}
+				s.written++
+			} else {
+				s.last = ts
+				s.written = 1
+				skip = 0
+			}
+		}
+
+		if _, err := io.WriteString(s.out, content); err != nil {
+			return true, err
+		}
+	}
 }
 
-func GetLogs(ctx context.Context, opts Options) (io.ReadCloser, error) {
-	return opts.PodsClient.GetLogs(opts.PodName, opts.PodLogOptions).Stream(ctx)
+// flush writes the incomplete line received before the stream ended
+func (s *streamer) flush() {
+	if s.partial == "" {
+		return
+	}
+	_, content, _ := splitTimestamp(s.partial)
+	io.WriteString(s.out, content)
+	s.partial = ""
+}
+
+// terminated determines whether the container has terminated. A pod that no
+// longer exists is deemed to have terminated.
+func (s *streamer) terminated(ctx context.Context) (bool, error) {
+	pod, err := s.podsClient.Get(ctx, s.podName, metav1.GetOptions{})
+	if kerrors.IsNotFound(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	status := k8s.ContainerStatusByName(pod, s.containerName)
+	return status != nil && status.State.Terminated != nil, nil
+}
+
+// splitTimestamp splits a log line into its timestamp and its content. If the
+// line does not begin with a timestamp then the line is returned unaltered.
+func splitTimestamp(line string) (time.Time, string, bool) {
+	parts := strings.SplitN(line, " ", 2)
+	if len(parts) != 2 {
+		return time.Time{}, line, false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, line, false
+	}
+	return ts, parts[1], true
 }
@@ -0,0 +1,164 @@
+package logstreamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// disconnect is a reader that returns an error, mocking a dropped connection
+type disconnect struct{}
+
+func (disconnect) Read(p []byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
+
+// response is a mocked response to a request for logs
+type response struct {
+	// Logs to return
+	logs string
+	// Disconnect after returning logs
+	disconnect bool
+	// Fail to connect
+	err error
+	// Mock the container having terminated after the request
+	terminate bool
+}
+
+func TestStream(t *testing.T) {
+	var fakeError = errors.New("fake error")
+
+	tests := []struct {
+		name      string
+		responses []response
+		out       string
+		err       error
+		// Assert the SinceTime of each request
+		since []string
+	}{
+		{
+			name: "no disconnects",
+			responses: []response{
+				{logs: "2021-01-01T00:00:00.1Z line1\n2021-01-01T00:00:00.2Z line2\n", terminate: true},
+			},
+			out:   "line1\nline2\n",
+			since: []string{""},
+		},
+		{
+			name: "reconnect after disconnect upon termination",
+			responses: []response{
+				{logs: "2021-01-01T00:00:00.1Z line1\n", disconnect: true, terminate: true},
+				{logs: "2021-01-01T00:00:00.1Z line1\n2021-01-01T00:00:01.1Z line2\n"},
+			},
+			out:   "line1\nline2\n",
+			since: []string{"", "2021-01-01T00:00:00Z"},
+		},
+		{
+			name: "reconnect after disconnect",
+			responses: []response{
+				{logs: "2021-01-01T00:00:00.1Z line1\n2021-01-01T00:00:01.1Z line2\n2021-01-01T00:00:01.1Z line3\n2021-01-01T00:00:02.1Z li", disconnect: true},
+				{logs: "2021-01-01T00:00:01.1Z line2\n2021-01-01T00:00:01.1Z line3\n2021-01-01T00:00:02.1Z line4\n"},
+				{err: fakeError},
+				{logs: "2021-01-01T00:00:02.1Z line4\n2021-01-01T00:00:03.1Z line5\n2021-01-01T00:00:04.1Z line6", terminate: true},
+			},
+			out:   "line1\nline2\nline3\nline4\nline5\nline6",
+			since: []string{"", "2021-01-01T00:00:01Z", "2021-01-01T00:00:02Z", "2021-01-01T00:00:02Z"},
+		},
+		{
+			name: "fail to connect",
+			responses: []response{
+				{err: fakeError},
+			},
+			err: fakeError,
+		},
+		{
+			name: "exceed reconnect attempts",
+			responses: []response{
+				{logs: "2021-01-01T00:00:00.1Z line1\n", disconnect: true},
+				{err: fakeError},
+				{err: fakeError},
+				{err: fakeError},
+			},
+			out: "line1\n",
+			err: fakeError,
+		},
+	}
+
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			delay, maxAttempts := ReconnectDelay, MaxReconnectAttempts
+			t.Cleanup(func() {
+				ReconnectDelay, MaxReconnectAttempts = delay, maxAttempts
+			})
+			ReconnectDelay = 0
+			MaxReconnectAttempts = 2
+
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod-1", Namespace: "default"},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{
+						{
+							Name: "runner",
+							State: corev1.ContainerState{
+								Running: &corev1.ContainerStateRunning{},
+							},
+						},
+					},
+				},
+			}
+			podsClient := fake.NewSimpleClientset(pod).CoreV1().Pods("default")
+
+			var requests int
+			var since []string
+			getLogs := func(ctx context.Context, opts Options) (io.ReadCloser, error) {
+				require.True(t, requests < len(tt.responses), "unexpected request for logs")
+				resp := tt.responses[requests]
+				requests++
+
+				if opts.PodLogOptions.SinceTime != nil {
+					since = append(since, opts.PodLogOptions.SinceTime.UTC().Format("2006-01-02T15:04:05Z"))
+				} else {
+					since = append(since, "")
+				}
+
+				if resp.terminate {
+					pod.Status.ContainerStatuses[0].State = corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{},
+					}
+					_, err := podsClient.UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+					require.NoError(t, err)
+				}
+
+				if resp.err != nil {
+					return nil, resp.err
+				}
+
+				var r io.Reader = strings.NewReader(resp.logs)
+				if resp.disconnect {
+					r = io.MultiReader(r, disconnect{})
+				}
+				return ioutil.NopCloser(r), nil
+			}
+
+			out := new(bytes.Buffer)
+			err := Stream(context.Background(), getLogs, out, podsClient, "pod-1", "runner")
+			assert.True(t, errors.Is(err, tt.err), "unexpected error: %v", err)
+
+			assert.Equal(t, tt.out, out.String())
+			if tt.since != nil {
+				assert.Equal(t, tt.since, since)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package project
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/util/git"
+	"github.com/leg100/etok/pkg/util/path"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Project package handles the project config file, etok.yaml, which is
+// committed alongside terraform config to share defaults with everyone working
+// on it. It is found in the directory of the root module or in one of its
+// parents, up to the root of the git repository.
+
+const (
+	ConfigFile = "etok.yaml"
+)
+
+var (
+	errReservedFlag = errors.New("flag cannot be set in flags")
+)
+
+// Flags that are set at the top level of the config file rather than in its
+// flags
+var reservedFlags = []string{"namespace", "workspace", "context", "path"}
+
+// Defaults are the namespace, workspace and kube context to use by default
+type Defaults struct {
+	Namespace string `json:"namespace,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+	Context   string `json:"context,omitempty"`
+}
+
+// Config is the contents of the project config file
+type Config struct {
+	Defaults
+
+	// Defaults for other flags, keyed by flag name. A list sets a flag that
+	// can be specified multiple times.
+	Flags map[string]interface{} `json:"flags,omitempty"`
+
+	// Paths to files and directories to upload along with the config,
+	// relative to the config file
+	Include []string `json:"include,omitempty"`
+
+	// Patterns of paths not to upload, in the syntax of .terraformignore
+	Exclude []string `json:"exclude,omitempty"`
+
+	// Defaults for root modules in directories, keyed by path relative to the
+	// config file. Those of the most specific directory containing a root
+	// module take precedence over those of the directories containing it.
+	Directories map[string]Defaults `json:"directories,omitempty"`
+
+	// Directory in which the config file is found
+	dir string
+}
+
+// Load finds and reads the config file for the root module at path. If there
+// is no config file then nil is returned.
+func Load(path string) (*Config, error) {
+	fpath, err := find(path)
+	if err != nil {
+		return nil, err
+	}
+	if fpath == "" {
+		return nil, nil
+	}
+	klog.V(1).Infof("found project config file: %s", fpath)
+
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %w", fpath, err)
+	}
+
+	for _, name := range reservedFlags {
+		if _, ok := cfg.Flags[name]; ok {
+			return nil, fmt.Errorf("%s: %w: %s", fpath, errReservedFlag, name)
+		}
+	}
+
+	cfg.dir = filepath.Dir(fpath)
+	for i, inc := range cfg.Include {
+		if !filepath.IsAbs(inc) {
+			cfg.Include[i] = filepath.Join(cfg.dir, inc)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// find returns the path to the config file in the directory path or in one of
+// its parents, stopping at the root of the git repository. If the path is not
+// within a git repository then only the directory itself is checked. An empty
+// string is returned if no config file is found.
+func find(dir string) (string, error) {
+	dir, err := path.EnsureAbs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := git.GetRepoRoot(dir)
+	if err != nil {
+		if !errors.Is(err, git.ErrNotRepo) {
+			return "", err
+		}
+		root = dir
+	}
+
+	for {
+		fpath := filepath.Join(dir, ConfigFile)
+		if _, err := os.Stat(fpath); err == nil {
+			return fpath, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		if dir == root {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// DefaultsFor returns the defaults for the root module mod. Those of the
+// directories containing it override those at the top level, the most
+// specific directory taking precedence.
+func (c *Config) DefaultsFor(mod string) (Defaults, error) {
+	defaults := c.Defaults
+
+	mod, err := path.EnsureAbs(mod)
+	if err != nil {
+		return defaults, err
+	}
+	rel, err := filepath.Rel(c.dir, mod)
+	if err != nil {
+		return defaults, err
+	}
+
+	// Find directories containing the module
+	var matches []string
+	for dir := range c.Directories {
+		clean := filepath.Clean(dir)
+		if rel == clean || strings.HasPrefix(rel, clean+string(filepath.Separator)) {
+			matches = append(matches, dir)
+		}
+	}
+	// Order from least to most specific
+	sort.Slice(matches, func(i, j int) bool {
+		return len(filepath.Clean(matches[i])) < len(filepath.Clean(matches[j]))
+	})
+
+	for _, dir := range matches {
+		d := c.Directories[dir]
+		if d.Namespace != "" {
+			defaults.Namespace = d.Namespace
+		}
+		if d.Workspace != "" {
+			defaults.Workspace = d.Workspace
+		}
+		if d.Context != "" {
+			defaults.Context = d.Context
+		}
+	}
+	return defaults, nil
+}
+
+// Current returns the namespace and workspace selected for the root module at
+// path: those in its environment file, otherwise those in the config file.
+// Either may be empty if neither file sets it.
+func Current(path string) (*env.Env, error) {
+	etokenv, err := env.Read(path)
+	if err == nil {
+		return etokenv, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return &env.Env{}, nil
+	}
+
+	defaults, err := cfg.DefaultsFor(path)
+	if err != nil {
+		return nil, err
+	}
+	return &env.Env{Namespace: defaults.Namespace, Workspace: defaults.Workspace}, nil
+}
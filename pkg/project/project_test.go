@@ -0,0 +1,206 @@
+package project
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/pkg/env"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const monorepoConfig = `
+namespace: dev
+context: dev-cluster
+flags:
+  no-tty: true
+  pod-timeout: 30m
+  include:
+  - vars
+include:
+- shared
+exclude:
+- "*.tfstate"
+directories:
+  infra/prod:
+    namespace: prod
+    workspace: prod
+  infra/prod/eu:
+    workspace: prod-eu
+`
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		// Files to write to the temp dir
+		files map[string][]byte
+		// Path to root module, relative to temp dir
+		path string
+		// Make temp dir a git repo
+		git bool
+		// Want config file found in this dir, relative to temp dir; empty
+		// means none found
+		want string
+		// Want an error, and optionally a specific error
+		wantErr bool
+		err     error
+	}{
+		{
+			name:  "in root module",
+			files: map[string][]byte{"etok.yaml": []byte("namespace: dev")},
+			path:  ".",
+			want:  ".",
+		},
+		{
+			name:  "in parent within git repo",
+			files: map[string][]byte{"etok.yaml": []byte("namespace: dev"), "infra/prod/main.tf": nil},
+			path:  "infra/prod",
+			git:   true,
+			want:  ".",
+		},
+		{
+			name:  "nearest to root module",
+			files: map[string][]byte{"etok.yaml": []byte("namespace: dev"), "infra/etok.yaml": []byte("namespace: infra"), "infra/prod/main.tf": nil},
+			path:  "infra/prod",
+			git:   true,
+			want:  "infra",
+		},
+		{
+			name:  "not in parent outside git repo",
+			files: map[string][]byte{"etok.yaml": []byte("namespace: dev"), "infra/prod/main.tf": nil},
+			path:  "infra/prod",
+		},
+		{
+			name:  "no config file",
+			files: map[string][]byte{"main.tf": nil},
+			path:  ".",
+			git:   true,
+		},
+		{
+			name:    "unknown field",
+			files:   map[string][]byte{"etok.yaml": []byte("namespaec: dev")},
+			path:    ".",
+			wantErr: true,
+		},
+		{
+			name:    "reserved flag",
+			files:   map[string][]byte{"etok.yaml": []byte("flags:\n  workspace: dev")},
+			path:    ".",
+			wantErr: true,
+			err:     errReservedFlag,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			dir := t.NewTempDir().WriteFiles(tt.files)
+			if tt.git {
+				dir.Mkdir(".git")
+			}
+
+			cfg, err := Load(dir.Path(tt.path))
+			if tt.wantErr {
+				require.Error(t, err)
+				if tt.err != nil {
+					assert.True(t, errors.Is(err, tt.err))
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.want == "" {
+				assert.Nil(t, cfg)
+				return
+			}
+			require.NotNil(t, cfg)
+			assert.Equal(t, dir.Path(tt.want), cfg.dir)
+		})
+	}
+}
+
+func TestDefaultsFor(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want Defaults
+	}{
+		{
+			name: "top level",
+			path: "infra/dev",
+			want: Defaults{Namespace: "dev", Context: "dev-cluster"},
+		},
+		{
+			name: "directory",
+			path: "infra/prod",
+			want: Defaults{Namespace: "prod", Workspace: "prod", Context: "dev-cluster"},
+		},
+		{
+			name: "most specific directory",
+			path: "infra/prod/eu/network",
+			want: Defaults{Namespace: "prod", Workspace: "prod-eu", Context: "dev-cluster"},
+		},
+		{
+			name: "directory sharing prefix",
+			path: "infra/production",
+			want: Defaults{Namespace: "dev", Context: "dev-cluster"},
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			dir := t.NewTempDir().Write("etok.yaml", []byte(monorepoConfig)).Mkdir(".git").Mkdir(tt.path)
+
+			cfg, err := Load(dir.Path(tt.path))
+			require.NoError(t, err)
+
+			got, err := cfg.DefaultsFor(dir.Path(tt.path))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			assert.Equal(t, []string{dir.Path("shared")}, cfg.Include)
+			assert.Equal(t, []string{"*.tfstate"}, cfg.Exclude)
+			assert.Equal(t, map[string]interface{}{"no-tty": true, "pod-timeout": "30m", "include": []interface{}{"vars"}}, cfg.Flags)
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	tests := []struct {
+		name string
+		// Contents of etok.yaml; empty means none
+		config string
+		// Contents of .terraform/environment; nil means none
+		env  *env.Env
+		want *env.Env
+	}{
+		{
+			name: "neither",
+			want: &env.Env{},
+		},
+		{
+			name:   "config file",
+			config: "namespace: dev\nworkspace: networking",
+			want:   &env.Env{Namespace: "dev", Workspace: "networking"},
+		},
+		{
+			name:   "environment file takes precedence",
+			config: "namespace: dev\nworkspace: networking",
+			env:    &env.Env{Namespace: "prod", Workspace: "default"},
+			want:   &env.Env{Namespace: "prod", Workspace: "default"},
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			dir := t.NewTempDir()
+			if tt.config != "" {
+				dir.Write(ConfigFile, []byte(tt.config))
+			}
+			if tt.env != nil {
+				require.NoError(t, tt.env.Write(dir.Root()))
+			}
+
+			got, err := Current(dir.Root())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
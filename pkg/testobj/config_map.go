@@ -18,3 +18,21 @@ func ConfigMap(namespace, name string, opts ...func(*corev1.ConfigMap)) *corev1.
 
 	return configMap
 }
+
+func WithConfigMapData(k, v string) func(*corev1.ConfigMap) {
+	return func(configMap *corev1.ConfigMap) {
+		if configMap.Data == nil {
+			configMap.Data = make(map[string]string)
+		}
+		configMap.Data[k] = v
+	}
+}
+
+func WithBinaryData(k string, v []byte) func(*corev1.ConfigMap) {
+	return func(configMap *corev1.ConfigMap) {
+		if configMap.BinaryData == nil {
+			configMap.BinaryData = make(map[string][]byte)
+		}
+		configMap.BinaryData[k] = v
+	}
+}
@@ -52,7 +52,7 @@ func WithPrivilegedCommands(cmds ...string) func(*v1alpha1.Workspace) {
 func WithVariables(keyValues ...string) func(*v1alpha1.Workspace) {
 	return func(ws *v1alpha1.Workspace) {
 		for i := 0; i < len(keyValues); i += 2 {
-			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: keyValues[0], Value: keyValues[1]})
+			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: keyValues[i], Value: keyValues[i+1]})
 		}
 	}
 }
@@ -72,7 +72,33 @@ func WithBackupBucket(bucket string) func(*v1alpha1.Workspace) {
 func WithEnvironmentVariables(keyValues ...string) func(*v1alpha1.Workspace) {
 	return func(ws *v1alpha1.Workspace) {
 		for i := 0; i < len(keyValues); i += 2 {
-			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: keyValues[0], Value: keyValues[1], EnvironmentVariable: true})
+			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: keyValues[i], Value: keyValues[i+1], EnvironmentVariable: true})
+		}
+	}
+}
+
+func WithHCLVariables(keyValues ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		for i := 0; i < len(keyValues); i += 2 {
+			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: keyValues[i], Value: keyValues[i+1], HCL: true})
+		}
+	}
+}
+
+func WithVariablesFromSecret(secret string, keys ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		for _, k := range keys {
+			ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{
+				Key: k,
+				ValueFrom: &v1alpha1.VariableSource{
+					EnvVarSource: corev1.EnvVarSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: secret},
+							Key:                  k,
+						},
+					},
+				},
+			})
 		}
 	}
 }
@@ -86,18 +112,92 @@ func WithCombinedQueue(run ...string) func(*v1alpha1.Workspace) {
 	}
 }
 
+func WithSerial(serial int) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Status.Serial = &serial
+	}
+}
+
+func WithVariableSource(key string, source *v1alpha1.VariableSource) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.Variables = append(ws.Spec.Variables, &v1alpha1.Variable{Key: key, ValueFrom: source})
+	}
+}
+
+func WithOutputs(keyValues ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		for i := 0; i < len(keyValues); i += 2 {
+			ws.Status.Outputs = append(ws.Status.Outputs, &v1alpha1.Output{Key: keyValues[i], Value: keyValues[i+1]})
+		}
+	}
+}
+
 func WithStorageClass(class *string) func(*v1alpha1.Workspace) {
 	return func(ws *v1alpha1.Workspace) {
 		ws.Spec.Cache.StorageClass = class
 	}
 }
 
+func WithCacheSize(size string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.Cache.Size = size
+	}
+}
+
 func WithTerraformVersion(version string) func(*v1alpha1.Workspace) {
 	return func(ws *v1alpha1.Workspace) {
 		ws.Spec.TerraformVersion = version
 	}
 }
 
+func WithCLIConfig(config *v1alpha1.CLIConfig) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.CLIConfig = config
+	}
+}
+
+func WithCredentials(sources ...v1alpha1.CredentialsSource) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.Credentials = sources
+	}
+}
+
+func WithHooks(hooks ...v1alpha1.Hook) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.Hooks = hooks
+	}
+}
+
+func WithPolicies(policies ...v1alpha1.PolicyReference) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.Policies = policies
+	}
+}
+
+func WithRefuseDirtyApplies() func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.RefuseDirtyApplies = true
+	}
+}
+
+func WithShareOutputsWith(namespaces ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.ShareOutputsWith = namespaces
+	}
+}
+
+func WithDeletionPolicy(policy v1alpha1.DeletionPolicy) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Spec.DeletionPolicy = policy
+	}
+}
+
+func WithFinalizers(finalizers ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		ws.Finalizers = append(ws.Finalizers, finalizers...)
+	}
+}
+
 func WithApprovals(run ...string) func(*v1alpha1.Workspace) {
 	return func(ws *v1alpha1.Workspace) {
 		if ws.Annotations == nil {
@@ -120,6 +220,46 @@ func WithAnnotations(keyValues ...string) func(*v1alpha1.Workspace) {
 	}
 }
 
+func WithLabels(keyValues ...string) func(*v1alpha1.Workspace) {
+	return func(ws *v1alpha1.Workspace) {
+		if ws.Labels == nil {
+			ws.Labels = make(map[string]string)
+		}
+		for i := 0; i < len(keyValues); i += 2 {
+			ws.Labels[keyValues[i]] = keyValues[i+1]
+		}
+	}
+}
+
+func WorkspaceTemplate(namespace, name string, spec v1alpha1.WorkspaceSpec) *v1alpha1.WorkspaceTemplate {
+	return &v1alpha1.WorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: spec,
+	}
+}
+
+func ClusterWorkspaceTemplate(name string, spec v1alpha1.WorkspaceSpec) *v1alpha1.ClusterWorkspaceTemplate {
+	return &v1alpha1.ClusterWorkspaceTemplate{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: spec,
+	}
+}
+
+func VariableSet(namespace, name string, spec v1alpha1.VariableSetSpec) *v1alpha1.VariableSet {
+	return &v1alpha1.VariableSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: spec,
+	}
+}
+
 func RunPod(namespace, name string, opts ...func(*corev1.Pod)) *corev1.Pod {
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
@@ -265,6 +405,18 @@ func WithArgs(args ...string) func(*v1alpha1.Run) {
 	}
 }
 
+func WithProvenance(provenance *v1alpha1.Provenance) func(*v1alpha1.Run) {
+	return func(run *v1alpha1.Run) {
+		run.Provenance = provenance
+	}
+}
+
+func WithConfigMap(name string) func(*v1alpha1.Run) {
+	return func(run *v1alpha1.Run) {
+		run.ConfigMap = name
+	}
+}
+
 func WithConfigMapPath(path string) func(*v1alpha1.Run) {
 	return func(run *v1alpha1.Run) {
 		run.ConfigMapPath = path
@@ -294,6 +446,15 @@ func WithStringData(k, v string) func(*corev1.Secret) {
 	}
 }
 
+func WithData(k, v string) func(*corev1.Secret) {
+	return func(secret *corev1.Secret) {
+		if secret.Data == nil {
+			secret.Data = make(map[string][]byte)
+		}
+		secret.Data[k] = []byte(v)
+	}
+}
+
 func WithDataFromFile(k, path string) func(*corev1.Secret) {
 	return func(secret *corev1.Secret) {
 		if secret.Data == nil {
@@ -2,6 +2,7 @@ package testobj
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,3 +29,17 @@ func WithPVCPhase(phase corev1.PersistentVolumeClaimPhase) func(*corev1.Persiste
 		}
 	}
 }
+
+func WithPVCSize(size string) func(*corev1.PersistentVolumeClaim) {
+	return func(pvc *corev1.PersistentVolumeClaim) {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{
+			corev1.ResourceStorage: resource.MustParse(size),
+		}
+	}
+}
+
+func WithPVCStorageClass(class string) func(*corev1.PersistentVolumeClaim) {
+	return func(pvc *corev1.PersistentVolumeClaim) {
+		pvc.Spec.StorageClassName = &class
+	}
+}
@@ -0,0 +1,72 @@
+package git
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Info describes the state of a git working tree
+type Info struct {
+	// SHA of the commit checked out
+	Commit string
+	// Branch checked out. Empty if HEAD is detached.
+	Branch string
+	// Whether the working tree has uncommitted changes, including untracked
+	// files
+	Dirty bool
+	// Author of the commit, in the form 'name <email>'
+	Author string
+}
+
+// GetInfo describes the state of the git working tree in which path is found.
+// ErrNotRepo is returned if path is not within a git repository.
+func GetInfo(path string) (*Info, error) {
+	if _, err := GetRepoRoot(path); err != nil {
+		return nil, err
+	}
+
+	var info Info
+	var err error
+
+	info.Commit, err = runGit(path, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	branch, err := runGit(path, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	if branch != "HEAD" {
+		info.Branch = branch
+	}
+
+	status, err := runGit(path, "status", "--porcelain")
+	if err != nil {
+		return nil, err
+	}
+	info.Dirty = status != ""
+
+	info.Author, err = runGit(path, "log", "-1", "--format=%an <%ae>")
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// runGit runs a git command in the given directory, returning its trimmed
+// output
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(exiterr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
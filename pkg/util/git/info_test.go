@@ -0,0 +1,69 @@
+package git
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInfo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	testutil.Run(t, "clean working tree", func(t *testutil.T) {
+		repo := newRepo(t)
+
+		info, err := GetInfo(repo.Root())
+		require.NoError(t, err)
+
+		assert.Len(t, info.Commit, 40)
+		assert.Equal(t, "main", info.Branch)
+		assert.False(t, info.Dirty)
+		assert.Equal(t, "etok <etok@example.com>", info.Author)
+	})
+
+	testutil.Run(t, "dirty working tree", func(t *testutil.T) {
+		repo := newRepo(t)
+		repo.Write("main.tf", []byte("# changed"))
+
+		info, err := GetInfo(repo.Root())
+		require.NoError(t, err)
+
+		assert.True(t, info.Dirty)
+	})
+
+	testutil.Run(t, "detached head", func(t *testutil.T) {
+		repo := newRepo(t)
+		_, err := runGit(repo.Root(), "checkout", "--quiet", "--detach")
+		require.NoError(t, err)
+
+		info, err := GetInfo(repo.Root())
+		require.NoError(t, err)
+
+		assert.Equal(t, "", info.Branch)
+	})
+
+	testutil.Run(t, "outside git repo", func(t *testutil.T) {
+		_, err := GetInfo(t.NewTempDir().Root())
+		require.Equal(t, ErrNotRepo, err)
+	})
+}
+
+// newRepo creates a git repository with a single commit
+func newRepo(t *testutil.T) *testutil.TempDir {
+	repo := t.NewTempDir().Write("main.tf", []byte("# main"))
+	for _, args := range [][]string{
+		{"init", "--quiet"},
+		{"checkout", "--quiet", "-b", "main"},
+		{"add", "."},
+		{"-c", "user.name=etok", "-c", "user.email=etok@example.com", "commit", "--quiet", "-m", "initial commit"},
+	} {
+		_, err := runGit(repo.Root(), args...)
+		require.NoError(t, err)
+	}
+	return repo
+}
@@ -112,17 +112,17 @@ func RemoveNestedPaths(paths []string) (unnested []string) {
 func updateUnnested(c string, paths []string) (updated []string) {
 	for _, p := range paths {
 		if c == p {
-			// Candidate is identical to a path so it cannot be nested
-			// within any other path, and is thus deemed unnested too
-			return append(paths, p)
+			// Candidate is identical to a path already deemed unnested,
+			// so return paths un-updated rather than add a duplicate
+			return paths
 		}
-		if strings.HasPrefix(c, p) {
+		if isNested(c, p) {
 			// Candidate has path as its prefix, so candidate must be
 			// nested; return paths un-updated
 			return paths
 		}
 
-		if strings.HasPrefix(p, c) {
+		if isNested(p, c) {
 			// Path has candidate as its prefix, so path can no longer
 			// be deemed unnested, so leave it out of updated list.
 			// Candidate might be nesting other paths so keep
@@ -136,3 +136,9 @@ func updateUnnested(c string, paths []string) (updated []string) {
 	// so add it to updated list of unnested paths.
 	return append(updated, c)
 }
+
+// isNested determines whether path c is nested within path p. Unlike a simple
+// prefix check, /a/bc is not deemed nested within /a/b.
+func isNested(c, p string) bool {
+	return strings.HasPrefix(c, strings.TrimSuffix(p, string(os.PathSeparator))+string(os.PathSeparator))
+}
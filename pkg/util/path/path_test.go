@@ -22,3 +22,19 @@ func TestCommonPrefix(t *testing.T) {
 
 	assert.Equal(t, "/home/user1/tmp", prefix)
 }
+
+func TestRemoveNestedPaths(t *testing.T) {
+	paths := []string{
+		"/home/user1/mod",
+		"/home/user1/mod/sub",
+		"/home/user1/mod2.tfvars",
+		"/home/user1/envs/prod.tfvars",
+		"/home/user1",
+	}
+
+	assert.Equal(t, []string{"/home/user1"}, RemoveNestedPaths(paths))
+	assert.Equal(t, []string{"/home/user1/mod", "/home/user1/mod2.tfvars", "/home/user1/envs/prod.tfvars"}, RemoveNestedPaths(paths[:4]))
+
+	// Duplicate paths are removed
+	assert.Equal(t, []string{"/home/user1/mod", "/home/user1/envs"}, RemoveNestedPaths([]string{"/home/user1/mod", "/home/user1/envs", "/home/user1/mod"}))
+}
@@ -0,0 +1,253 @@
+package variables
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/hashicorp/hcl/v2/json"
+	"github.com/hashicorp/terraform-config-inspect/tfconfig"
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+	"k8s.io/klog/v2"
+)
+
+// Variables package handles the values of terraform variables: parsing typed
+// values written in HCL, reading variable files, rendering variables to a
+// tfvars file, checking values against the types of the variables declared in
+// a terraform module, and merging the variables of variable sets with those of
+// a workspace.
+
+var (
+	ErrInvalidKey      = errors.New("invalid variable key")
+	ErrInvalidValue    = errors.New("invalid variable value")
+	ErrInvalidFile     = errors.New("invalid variable file")
+	ErrUnsupportedFile = errors.New("variable file must have extension .tfvars or .tfvars.json")
+)
+
+// Parse parses the value of a variable written as an HCL expression, e.g.
+// ["a", "b"]. The expression must be a literal value: it cannot reference
+// other variables nor call functions.
+func Parse(key, value string) (cty.Value, error) {
+	expr, diags := hclsyntax.ParseExpression([]byte(value), key, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%w: %s: %s", ErrInvalidValue, key, diags.Error())
+	}
+
+	val, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		return cty.NilVal, fmt.Errorf("%w: %s: %s", ErrInvalidValue, key, diags.Error())
+	}
+	return val, nil
+}
+
+// Format returns the canonical HCL representation of a value
+func Format(val cty.Value) string {
+	return string(hclwrite.TokensForValue(val).Bytes())
+}
+
+// ReadFile reads terraform variables from a variable file, either a .tfvars
+// file written in HCL or a .tfvars.json file. Their values are returned as HCL
+// expressions, in order of key.
+func ReadFile(path string) ([]*v1alpha1.Variable, error) {
+	var parse func([]byte, string) (*hcl.File, hcl.Diagnostics)
+	switch {
+	case strings.HasSuffix(path, ".tfvars.json"):
+		parse = json.Parse
+	case strings.HasSuffix(path, ".tfvars"):
+		parse = func(src []byte, filename string) (*hcl.File, hcl.Diagnostics) {
+			return hclsyntax.ParseConfig(src, filename, hcl.Pos{Line: 1, Column: 1})
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFile, path)
+	}
+
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, diags := parse(src, path)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, diags.Error())
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidFile, diags.Error())
+	}
+
+	var vars []*v1alpha1.Variable
+	for key, attr := range attrs {
+		val, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFile, diags.Error())
+		}
+		vars = append(vars, &v1alpha1.Variable{Key: key, Value: Format(val), HCL: true})
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Key < vars[j].Key
+	})
+
+	return vars, nil
+}
+
+// TFVars renders the terraform variables whose values are HCL expressions as
+// the contents of a tfvars file. Variables whose values are sourced from
+// elsewhere are skipped. Each key must be a valid identifier and each value is
+// parsed and rendered in its canonical form, so that neither can introduce
+// further content to the file.
+func TFVars(vars []*v1alpha1.Variable) (string, error) {
+	b := new(strings.Builder)
+	for _, v := range vars {
+		if !v.HCL || v.EnvironmentVariable || v.ValueFrom != nil {
+			continue
+		}
+		if !hclsyntax.ValidIdentifier(v.Key) {
+			return "", fmt.Errorf("%w: %q", ErrInvalidKey, v.Key)
+		}
+		val, err := Parse(v.Key, v.Value)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(b, "%s = %s\n", v.Key, Format(val))
+	}
+	return b.String(), nil
+}
+
+// Check checks the values of terraform variables against the types of the
+// variables declared in the module at path. Variables that are not declared,
+// and variables whose values are sourced from elsewhere, are skipped.
+func Check(vars []*v1alpha1.Variable, path string) error {
+	mod, diags := tfconfig.LoadModule(path)
+	if diags.HasErrors() {
+		return fmt.Errorf("unable to load module: %w", diags.Err())
+	}
+
+	for _, v := range vars {
+		if v.EnvironmentVariable || v.ValueFrom != nil {
+			continue
+		}
+
+		decl, ok := mod.Variables[v.Key]
+		if !ok {
+			continue
+		}
+
+		// Without a type constraint a variable accepts any value
+		ty := cty.DynamicPseudoType
+		if decl.Type != "" {
+			expr, diags := hclsyntax.ParseExpression([]byte(decl.Type), v.Key, hcl.Pos{Line: 1, Column: 1})
+			if diags.HasErrors() {
+				// Leave it to terraform to report an invalid type
+				continue
+			}
+			ty, diags = typeexpr.TypeConstraint(expr)
+			if diags.HasErrors() {
+				continue
+			}
+		}
+
+		val, err := value(v, decl.Type == "" || ty.IsPrimitiveType())
+		if err != nil {
+			return err
+		}
+
+		if _, err := convert.Convert(val, ty); err != nil {
+			return fmt.Errorf("%w: %s: expected %s: %s", ErrInvalidValue, v.Key, decl.Type, err.Error())
+		}
+	}
+	return nil
+}
+
+// value returns the value of a variable as terraform would see it. A value that
+// is not written in HCL is passed to terraform as an environment variable,
+// which terraform takes literally only if the variable's type is primitive or
+// unspecified, and otherwise parses as HCL.
+func value(v *v1alpha1.Variable, literal bool) (cty.Value, error) {
+	if !v.HCL && literal {
+		return cty.StringVal(v.Value), nil
+	}
+	return Parse(v.Key, v.Value)
+}
+
+// Variable is a variable along with the name of the variable set from which it
+// is taken, which is empty if the variable is set on the workspace itself
+type Variable struct {
+	*v1alpha1.Variable
+	VariableSet string
+}
+
+// Merge merges the variables of the variable sets that apply to the workspace
+// with the workspace's own variables. A workspace's own variable takes
+// precedence over that of a variable set with the same key and kind. Where
+// variable sets conflict, the set whose name comes later in alphabetical order
+// takes precedence. The workspace's variables come first, followed by those of
+// the variable sets. A variable set with an invalid selector is skipped, so
+// that it does not affect the other workspaces in its namespace.
+func Merge(ws *v1alpha1.Workspace, sets []v1alpha1.VariableSet) []Variable {
+	type id struct {
+		key string
+		env bool
+	}
+
+	var merged []Variable
+	seen := make(map[id]bool)
+	for _, v := range ws.Spec.Variables {
+		merged = append(merged, Variable{Variable: v})
+		seen[id{v.Key, v.EnvironmentVariable}] = true
+	}
+
+	sorted := append([]v1alpha1.VariableSet{}, sets...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	// Variables of the sets, in order of first appearance, each taking the
+	// value of the set of highest precedence
+	var order []id
+	fromSets := make(map[id]Variable)
+	for i := range sorted {
+		selected, err := sorted[i].Selects(ws)
+		if err != nil {
+			klog.Warningf("skipping variable set %s/%s: invalid selector: %s", sorted[i].Namespace, sorted[i].Name, err.Error())
+			continue
+		}
+		if !selected {
+			continue
+		}
+		for _, v := range sorted[i].Spec.Variables {
+			vid := id{v.Key, v.EnvironmentVariable}
+			if seen[vid] {
+				continue
+			}
+			if _, ok := fromSets[vid]; !ok {
+				order = append(order, vid)
+			}
+			fromSets[vid] = Variable{Variable: v, VariableSet: sorted[i].Name}
+		}
+	}
+	for _, vid := range order {
+		merged = append(merged, fromSets[vid])
+	}
+
+	return merged
+}
+
+// Effective returns the variables that apply to the workspace, merging those
+// of the variable sets that apply to it with its own variables
+func Effective(ws *v1alpha1.Workspace, sets []v1alpha1.VariableSet) []*v1alpha1.Variable {
+	merged := Merge(ws, sets)
+	vars := make([]*v1alpha1.Variable, 0, len(merged))
+	for _, v := range merged {
+		vars = append(vars, v.Variable)
+	}
+	return vars
+}
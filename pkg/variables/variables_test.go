@@ -0,0 +1,296 @@
+package variables
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/leg100/etok/api/etok.dev/v1alpha1"
+	"github.com/leg100/etok/pkg/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     []*v1alpha1.Variable
+		err      error
+	}{
+		{
+			name:     "tfvars",
+			filename: "test.tfvars",
+			content:  "region = \"eu\"\nzones = [\"a\", \"b\"]\ntags = { env = \"prod\" }\ncount = 3\n",
+			want: []*v1alpha1.Variable{
+				{Key: "count", Value: "3", HCL: true},
+				{Key: "region", Value: `"eu"`, HCL: true},
+				{Key: "tags", Value: `{ env = "prod" }`, HCL: true},
+				{Key: "zones", Value: `["a", "b"]`, HCL: true},
+			},
+		},
+		{
+			name:     "tfvars json",
+			filename: "test.tfvars.json",
+			content:  `{"region": "eu", "zones": ["a", "b"], "enabled": true}`,
+			want: []*v1alpha1.Variable{
+				{Key: "enabled", Value: "true", HCL: true},
+				{Key: "region", Value: `"eu"`, HCL: true},
+				{Key: "zones", Value: `["a", "b"]`, HCL: true},
+			},
+		},
+		{
+			name:     "invalid tfvars",
+			filename: "test.tfvars",
+			content:  "region = [\"eu\"",
+			err:      ErrInvalidFile,
+		},
+		{
+			name:     "references are not permitted",
+			filename: "test.tfvars",
+			content:  "region = var.region",
+			err:      ErrInvalidFile,
+		},
+		{
+			name:     "unsupported extension",
+			filename: "test.yaml",
+			content:  "region: eu",
+			err:      ErrUnsupportedFile,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			t.NewTempDir().Chdir().Write(tt.filename, []byte(tt.content))
+
+			got, err := ReadFile(tt.filename)
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestTFVars(t *testing.T) {
+	vars := []*v1alpha1.Variable{
+		{Key: "region", Value: "eu"},
+		{Key: "zones", Value: `["a", "b"]`, HCL: true},
+		{Key: "TF_LOG", Value: "DEBUG", EnvironmentVariable: true},
+		{Key: "tags", Value: `{env = "prod"}`, HCL: true},
+		{Key: "vpc_id", HCL: true, ValueFrom: &v1alpha1.VariableSource{}},
+	}
+	got, err := TFVars(vars)
+	require.NoError(t, err)
+	assert.Equal(t, "zones = [\"a\", \"b\"]\ntags = { env = \"prod\" }\n", got)
+}
+
+func TestTFVarsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		vars []*v1alpha1.Variable
+		err  error
+	}{
+		{
+			name: "invalid value",
+			vars: []*v1alpha1.Variable{{Key: "zones", Value: `["a"`, HCL: true}},
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "value injecting another variable",
+			vars: []*v1alpha1.Variable{{Key: "zones", Value: "[\"a\"]\nregion = \"us\"", HCL: true}},
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "key injecting another variable",
+			vars: []*v1alpha1.Variable{{Key: "region = \"us\"\nzones", Value: `["a"]`, HCL: true}},
+			err:  ErrInvalidKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := TFVars(tt.vars)
+			assert.True(t, errors.Is(err, tt.err))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := `
+variable "region" {}
+variable "count" {
+  type = number
+}
+variable "zones" {
+  type = list(string)
+}
+variable "tags" {
+  type = map(string)
+}
+`
+
+	tests := []struct {
+		name string
+		vars []*v1alpha1.Variable
+		err  error
+	}{
+		{
+			name: "valid",
+			vars: []*v1alpha1.Variable{
+				{Key: "region", Value: "eu"},
+				{Key: "count", Value: "3"},
+				{Key: "zones", Value: `["a", "b"]`, HCL: true},
+				{Key: "tags", Value: `{env = "prod"}`},
+			},
+		},
+		{
+			name: "untyped variable accepts any value",
+			vars: []*v1alpha1.Variable{{Key: "region", Value: `["eu"]`, HCL: true}},
+		},
+		{
+			name: "undeclared variable is skipped",
+			vars: []*v1alpha1.Variable{{Key: "undeclared", Value: "foo"}},
+		},
+		{
+			name: "environment variable is skipped",
+			vars: []*v1alpha1.Variable{{Key: "count", Value: "foo", EnvironmentVariable: true}},
+		},
+		{
+			name: "value from a source is skipped",
+			vars: []*v1alpha1.Variable{{Key: "count", ValueFrom: &v1alpha1.VariableSource{}}},
+		},
+		{
+			name: "number",
+			vars: []*v1alpha1.Variable{{Key: "count", Value: "three"}},
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "list",
+			vars: []*v1alpha1.Variable{{Key: "zones", Value: `{a = "b"}`, HCL: true}},
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "non-HCL value of complex type is parsed as HCL",
+			vars: []*v1alpha1.Variable{{Key: "zones", Value: "a,b"}},
+			err:  ErrInvalidValue,
+		},
+		{
+			name: "invalid HCL",
+			vars: []*v1alpha1.Variable{{Key: "region", Value: `["eu"`, HCL: true}},
+			err:  ErrInvalidValue,
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			path := t.NewTempDir().Write("variables.tf", []byte(config)).Root()
+
+			err := Check(tt.vars, path)
+			if !assert.True(t, errors.Is(err, tt.err)) {
+				t.Logf("wanted %v but got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	ws := &v1alpha1.Workspace{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "networking", Labels: map[string]string{"env": "prod"}},
+		Spec: v1alpha1.WorkspaceSpec{
+			Variables: []*v1alpha1.Variable{
+				{Key: "region", Value: "eu"},
+			},
+		},
+	}
+
+	set := func(namespace, name string, spec v1alpha1.VariableSetSpec) v1alpha1.VariableSet {
+		return v1alpha1.VariableSet{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}, Spec: spec}
+	}
+
+	tests := []struct {
+		name string
+		sets []v1alpha1.VariableSet
+		want []Variable
+	}{
+		{
+			name: "no sets",
+			want: []Variable{
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "eu"}},
+			},
+		},
+		{
+			name: "workspace variable takes precedence",
+			sets: []v1alpha1.VariableSet{
+				set("default", "shared", v1alpha1.VariableSetSpec{
+					Workspaces: []string{"networking"},
+					Variables: []*v1alpha1.Variable{
+						{Key: "region", Value: "us"},
+						{Key: "region", Value: "us", EnvironmentVariable: true},
+					},
+				}),
+			},
+			want: []Variable{
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "eu"}},
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "us", EnvironmentVariable: true}, VariableSet: "shared"},
+			},
+		},
+		{
+			name: "later set takes precedence",
+			sets: []v1alpha1.VariableSet{
+				set("default", "prod", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme-prod"}},
+				}),
+				set("default", "defaults", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme"}, {Key: "zones", Value: `["a"]`, HCL: true}},
+				}),
+			},
+			want: []Variable{
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "eu"}},
+				{Variable: &v1alpha1.Variable{Key: "project", Value: "acme-prod"}, VariableSet: "prod"},
+				{Variable: &v1alpha1.Variable{Key: "zones", Value: `["a"]`, HCL: true}, VariableSet: "defaults"},
+			},
+		},
+		{
+			name: "unselected sets are ignored",
+			sets: []v1alpha1.VariableSet{
+				set("default", "dev", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"env": "dev"}},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme-dev"}},
+				}),
+				set("default", "nothing", v1alpha1.VariableSetSpec{
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme"}},
+				}),
+				set("other", "everything", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme-other"}},
+				}),
+			},
+			want: []Variable{
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "eu"}},
+			},
+		},
+		{
+			name: "set with invalid selector is skipped",
+			sets: []v1alpha1.VariableSet{
+				set("default", "invalid", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "env", Operator: "Between"}}},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme-invalid"}},
+				}),
+				set("default", "prod", v1alpha1.VariableSetSpec{
+					Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+					Variables: []*v1alpha1.Variable{{Key: "project", Value: "acme-prod"}},
+				}),
+			},
+			want: []Variable{
+				{Variable: &v1alpha1.Variable{Key: "region", Value: "eu"}},
+				{Variable: &v1alpha1.Variable{Key: "project", Value: "acme-prod"}, VariableSet: "prod"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		testutil.Run(t, tt.name, func(t *testutil.T) {
+			assert.Equal(t, tt.want, Merge(ws, tt.sets))
+		})
+	}
+}